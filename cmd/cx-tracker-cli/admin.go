@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// adminTokenEnv is the environment variable which contains the admin bearer
+// token of the tracker.
+const adminTokenEnv = "CX_TRACKER_ADMIN_TOKEN"
+
+func adminBackup(ctx context.Context, e *env, args []string) error {
+	var tokenFile string
+
+	fs := newFlagSet(e)
+	fs.StringVar(&tokenFile, "token-file", "", "`FILEPATH` of the admin bearer token (env: "+adminTokenEnv+")")
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	token, err := adminToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	filename := args[0]
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) //nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	// Backups can be large, so the request does not time out.
+	info, err := e.client(true).Backup(ctx, token, f)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		if rmErr := os.Remove(filename); rmErr != nil {
+			fmt.Fprintf(e.errOut, "Failed to remove incomplete backup file '%s': %v\n", filename, rmErr)
+		}
+		return err
+	}
+
+	out := struct {
+		File   string `json:"file"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}{File: filename, Size: info.Size, SHA256: info.Checksum}
+
+	return e.printer().print(out, func(t *table) {
+		t.row("FILE", out.File)
+		t.row("SIZE", out.Size)
+		t.row("SHA256", out.SHA256)
+	})
+}
+
+// adminToken reads the admin bearer token from 'tokenFile', or from the
+// environment if 'tokenFile' is empty.
+func adminToken(tokenFile string) (string, error) {
+	if tokenFile == "" {
+		if token := os.Getenv(adminTokenEnv); token != "" {
+			return token, nil
+		}
+		return "", errors.New("either -token-file or " + adminTokenEnv + " should be provided")
+	}
+
+	b, err := ioutil.ReadFile(tokenFile) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
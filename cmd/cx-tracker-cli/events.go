@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/skycoin/cx-tracker/pkg/events"
+)
+
+// eventsRetry is the duration before reconnecting a dropped event stream.
+const eventsRetry = 3 * time.Second
+
+func watchEvents(ctx context.Context, e *env, args []string) error {
+	var (
+		chains  stringsFlag
+		types   stringsFlag
+		lastID  string
+		noRetry bool
+	)
+
+	fs := newFlagSet(e)
+	fs.Var(&chains, "chain", "only watch events of chain `GENESIS_HASH` (repeatable)")
+	fs.Var(&types, "type", "only watch events of `TYPE` (repeatable, one of "+eventTypes()+")")
+	fs.StringVar(&lastID, "last-event-id", "", "resume after the event of `ID`")
+	fs.BoolVar(&noRetry, "no-retry", false, "exit when the event stream is dropped instead of reconnecting")
+
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var f events.Filter
+	for _, s := range chains {
+		hash, err := parseGenesisHash(s)
+		if err != nil {
+			return err
+		}
+		f.Chains = append(f.Chains, hash.Hex())
+	}
+	for _, s := range types {
+		t, err := events.ParseType(s)
+		if err != nil {
+			return err
+		}
+		f.Types = append(f.Types, t)
+	}
+
+	c := e.client(true)
+	w := newEventWriter(e)
+
+	for {
+		stream, err := c.Events(ctx, f, lastID)
+		if err != nil {
+			return err
+		}
+
+		err = readEvents(ctx, stream, w)
+		lastID = stream.LastEventID()
+		_ = stream.Close() //nolint:errcheck
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if noRetry {
+			return err
+		}
+
+		fmt.Fprintf(e.errOut, "Event stream dropped (%v), reconnecting in %s...\n", err, eventsRetry)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(eventsRetry):
+		}
+	}
+}
+
+// readEvents writes the events of 'stream' until the stream ends.
+func readEvents(ctx context.Context, stream eventStream, w *eventWriter) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	// Next blocks until the stream is closed.
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = stream.Close() //nolint:errcheck
+		case <-done:
+		}
+	}()
+
+	for {
+		ev, err := stream.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("stream closed by tracker")
+			}
+			return err
+		}
+		if err := w.write(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// eventStream is implemented by api.EventStream.
+type eventStream interface {
+	Next() (events.Event, error)
+	Close() error
+}
+
+// eventRowFormat is the format of event table rows. Rows are written as
+// events arrive, so columns have fixed widths.
+const eventRowFormat = "%-20s  %-12s  %-64s  %s\n"
+
+// eventWriter writes events as table rows, or as one JSON object per line.
+type eventWriter struct {
+	format outputFormat
+	out    io.Writer
+	header bool
+}
+
+func newEventWriter(e *env) *eventWriter {
+	return &eventWriter{format: e.format, out: e.out}
+}
+
+func (w *eventWriter) write(ev events.Event) error {
+	if w.format == formatJSON {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w.out, string(b))
+		return err
+	}
+
+	if !w.header {
+		if _, err := fmt.Fprintf(w.out, eventRowFormat, "TIME", "TYPE", "CHAIN", "ID"); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	_, err := fmt.Fprintf(w.out, eventRowFormat, formatUnix(ev.Time), ev.Type, ev.Chain, ev.ID)
+	return err
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+// String implements flag.Value.
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+// Set implements flag.Value.
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func eventTypes() string {
+	strs := make([]string, len(events.Types))
+	for i, t := range events.Types {
+		strs[i] = string(t)
+	}
+	return strings.Join(strs, "|")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+)
+
+// readSpecFile reads a chain spec file. The file either contains a signed chain
+// spec, or an unsigned chain spec (as generated by cxchain-cli). The returned
+// bool is true if the chain spec is signed.
+func readSpecFile(filename string) (cxspec.SignedChainSpec, bool, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cxspec.SignedChainSpec{}, false, fmt.Errorf("failed to read chain spec file '%s': %w", filename, err)
+	}
+
+	var signed cxspec.SignedChainSpec
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return cxspec.SignedChainSpec{}, false, fmt.Errorf("chain spec file '%s' is ill-formed: %w", filename, err)
+	}
+	if signed.Sig != "" {
+		return signed, true, nil
+	}
+
+	spec, err := cxspec.ReadSpecFile(filename)
+	if err != nil {
+		return cxspec.SignedChainSpec{}, false, err
+	}
+	return cxspec.SignedChainSpec{Spec: spec}, false, nil
+}
+
+// chainSecKey obtains the chain secret key from either its hex representation
+// or a chain key file (as generated by cxchain-cli).
+func chainSecKey(skHex, keysFile string) (cipher.SecKey, error) {
+	switch {
+	case skHex != "" && keysFile != "":
+		return cipher.SecKey{}, errors.New("only one of -sk and -keys can be set")
+	case skHex != "":
+		sk, err := cipher.SecKeyFromHex(skHex)
+		if err != nil {
+			return cipher.SecKey{}, fmt.Errorf("invalid chain secret key: %w", err)
+		}
+		return sk, nil
+	case keysFile != "":
+		ks, err := cxspec.ReadKeysFile(keysFile)
+		if err != nil {
+			return cipher.SecKey{}, err
+		}
+		if ks.KeyType != cxspec.ChainKey {
+			return cipher.SecKey{}, fmt.Errorf("key file '%s' has key type '%s' (expected '%s')",
+				keysFile, ks.KeyType, cxspec.ChainKey)
+		}
+		sk, err := cipher.SecKeyFromHex(ks.SecKey)
+		if err != nil {
+			return cipher.SecKey{}, fmt.Errorf("key file '%s' has invalid secret key: %w", keysFile, err)
+		}
+		return sk, nil
+	default:
+		return cipher.SecKey{}, errors.New("chain secret key is required (set -sk or -keys)")
+	}
+}
+
+// readDeletionFile reads a signed chain spec deletion file (as generated by
+// 'specs sign-delete').
+func readDeletionFile(filename string) (api.SignedSpecDeletion, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return api.SignedSpecDeletion{}, fmt.Errorf("failed to read deletion file '%s': %w", filename, err)
+	}
+
+	var del api.SignedSpecDeletion
+	if err := json.Unmarshal(b, &del); err != nil {
+		return api.SignedSpecDeletion{}, fmt.Errorf("deletion file '%s' is ill-formed: %w", filename, err)
+	}
+	return del, nil
+}
@@ -0,0 +1,200 @@
+// cx-tracker-cli is a command line client of cx-tracker.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+)
+
+// defaultAddr is the default HTTP address of the tracker.
+const defaultAddr = "http://127.0.0.1:9091"
+
+// addrEnv is the environment variable which overrides the default tracker
+// address.
+const addrEnv = "CX_TRACKER_ADDR"
+
+// command is a subcommand of cx-tracker-cli.
+type command struct {
+	name  string // e.g. "specs list"
+	args  string // usage of positional arguments
+	short string // one-line description
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{name: "specs list", args: "[flags]", short: "List chain specs", run: specsList},
+	{name: "specs show", args: "[flags] GENESIS_HASH", short: "Show a chain spec", run: specsShow},
+	{name: "specs post", args: "[flags] SPEC_FILE", short: "Post a new or revised chain spec", run: specsPost},
+	{name: "specs delete", args: "[flags] [GENESIS_HASH]", short: "Delete a chain spec", run: specsDelete},
+	{name: "specs sign-delete", args: "[flags] GENESIS_HASH", short: "Sign a chain spec deletion offline", run: specsSignDelete},
+	{name: "peers list", args: "[flags] GENESIS_HASH", short: "Query the peers of a chain", run: peersList},
+	{name: "peers show", args: "[flags] PUBLIC_KEY", short: "Show the entry of a peer", run: peersShow},
+	{name: "peers print-list", args: "[flags] GENESIS_HASH", short: "Print a peer list of a chain for cx nodes", run: peersPrintList},
+	{name: "verify", args: "[flags] SPEC_FILE", short: "Verify a signed chain spec file offline", run: verify},
+	{name: "events", args: "[flags]", short: "Watch live events", run: watchEvents},
+	{name: "admin backup", args: "[flags] FILEPATH", short: "Download a backup of the tracker database", run: adminBackup},
+}
+
+// env contains the values shared by commands.
+type env struct {
+	addr    string
+	timeout time.Duration
+	out     io.Writer
+	errOut  io.Writer
+	format  outputFormat
+	cmd     command // command being run
+}
+
+// client returns a tracker client. Requests time out after the configured
+// timeout, unless 'stream' is true.
+func (e *env) client(stream bool) *api.Client {
+	log := logrus.New()
+	log.Out = e.errOut
+	log.Level = logrus.WarnLevel
+
+	c := &http.Client{Timeout: e.timeout}
+	if stream {
+		c.Timeout = 0
+	}
+	return api.NewClient(log, c, e.addr)
+}
+
+// printer returns the printer of the configured output format.
+func (e *env) printer() *printer {
+	return &printer{w: e.out, format: e.format}
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		cancel()
+	}()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs cx-tracker-cli with the given arguments.
+func run(ctx context.Context, args []string, out, errOut io.Writer) error {
+	e := &env{
+		addr:    defaultAddr,
+		timeout: time.Second * 30,
+		out:     out,
+		errOut:  errOut,
+		format:  formatTable,
+	}
+	if addr := os.Getenv(addrEnv); addr != "" {
+		e.addr = addr
+	}
+
+	fs := flag.NewFlagSet("cx-tracker-cli", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.StringVar(&e.addr, "addr", e.addr, "HTTP `ADDRESS` of the tracker (env: "+addrEnv+")")
+	fs.DurationVar(&e.timeout, "timeout", e.timeout, "`DURATION` before requests time out")
+	fs.Var(&e.format, "o", "output `FORMAT` (table|json)")
+	fs.Usage = func() { usage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cmd, rest, ok := findCommand(fs.Args())
+	if !ok {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	e.cmd = cmd
+	return cmd.run(ctx, e, rest)
+}
+
+// findCommand finds the command of the leading arguments. The remaining
+// arguments are returned.
+func findCommand(args []string) (command, []string, bool) {
+	for n := 2; n >= 1; n-- {
+		if len(args) < n {
+			continue
+		}
+		name := strings.Join(args[:n], " ")
+		for _, cmd := range commands {
+			if cmd.name == name {
+				return cmd, args[n:], true
+			}
+		}
+	}
+	return command{}, nil, false
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "Usage: cx-tracker-cli [flags] COMMAND [command flags] [args]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+
+	names := make([]string, 0, len(commands))
+	shorts := make(map[string]string, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		shorts[cmd.name] = cmd.short
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-18s %s\n", name, shorts[name])
+	}
+
+	fmt.Fprintf(w, "\nFlags:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nRun 'cx-tracker-cli COMMAND -h' for the flags of a command.\n")
+}
+
+// newFlagSet creates the flag set of the command being run.
+func newFlagSet(e *env) *flag.FlagSet {
+	cmd := e.cmd
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(e.errOut)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cx-tracker-cli %s %s\n\n%s.\n", cmd.name, cmd.args, cmd.short)
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses the flags of a command and checks the number of positional
+// arguments.
+func parseArgs(fs *flag.FlagSet, args []string, minN, maxN int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if n := fs.NArg(); n < minN || n > maxN {
+		fs.Usage()
+		if minN == maxN {
+			return nil, fmt.Errorf("%s: expected %d argument(s), got %d", fs.Name(), minN, n)
+		}
+		return nil, fmt.Errorf("%s: expected %d to %d arguments, got %d", fs.Name(), minN, maxN, n)
+	}
+	return fs.Args(), nil
+}
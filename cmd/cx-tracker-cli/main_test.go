@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/events"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func TestCLI(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestCLI_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	})
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	bus := events.NewBus(events.DefaultHistory)
+	ps := store.NewMemoryPeersStore(time.Minute, 10)
+	httpS := httptest.NewServer(api.NewHTTPRouter(events.WrapSpecStore(ss, bus), events.WrapPeersStore(ps, bus), api.WithEvents(bus), api.WithAdmin("admin-token", db)))
+	t.Cleanup(httpS.Close)
+
+	dir, err := ioutil.TempDir("", "TestCLI")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, os.RemoveAll(dir)) })
+
+	// cli runs the CLI against the test tracker and returns its output.
+	cli := func(t *testing.T, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(context.TODO(), append([]string{"-addr", httpS.URL}, args...), &out, ioutil.Discard)
+		return out.String(), err
+	}
+
+	pk, sk := cipher.GenerateKeyPair()
+	spec, err := cxspec.New("clicoin", "CLI", sk, cipher.AddressFromPubKey(pk), nil)
+	require.NoError(t, err)
+	signedSpec, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+	hash, err := store.SpecGenesisHash(signedSpec)
+	require.NoError(t, err)
+
+	specFile := writeJSONFile(t, dir, "spec.json", spec)
+	signedSpecFile := writeJSONFile(t, dir, "signed_spec.json", signedSpec)
+	keysFile := writeJSONFile(t, dir, "keys.json", cxspec.KeySpecFromSecKey(cxspec.ChainKey, sk, true, true))
+
+	t.Run("verify", func(t *testing.T) {
+		out, err := cli(t, "verify", "-hash", hash.Hex(), signedSpecFile)
+		require.NoError(t, err)
+		require.Contains(t, out, hash.Hex())
+
+		_, err = cli(t, "verify", specFile)
+		require.Error(t, err, "unsigned spec files cannot be verified")
+
+		tampered := signedSpec
+		tampered.Spec.CoinName = "tampered"
+		_, err = cli(t, "verify", writeJSONFile(t, dir, "tampered.json", tampered))
+		require.Error(t, err)
+
+		_, err = cli(t, "verify", "-hash", cipher.SumSHA256([]byte("other")).Hex(), signedSpecFile)
+		require.Error(t, err)
+	})
+
+	t.Run("post_and_show", func(t *testing.T) {
+		_, err := cli(t, "specs", "post", specFile)
+		require.Error(t, err, "unsigned spec files require a chain secret key")
+
+		out, err := cli(t, "-o", "json", "specs", "post", "-keys", keysFile, specFile)
+		require.NoError(t, err)
+		require.Contains(t, out, hash.Hex())
+
+		out, err = cli(t, "-o", "json", "specs", "list", "-ticker", "cli")
+		require.NoError(t, err)
+		var summaries []api.SpecSummary
+		require.NoError(t, json.Unmarshal([]byte(out), &summaries))
+		require.Len(t, summaries, 1)
+		require.Equal(t, hash.Hex(), summaries[0].GenesisHash)
+
+		out, err = cli(t, "specs", "show", hash.Hex())
+		require.NoError(t, err)
+		require.Contains(t, out, "clicoin")
+		require.Contains(t, out, spec.SpecHash().Hex())
+
+		out, err = cli(t, "-o", "json", "specs", "show", "-revisions", hash.Hex())
+		require.NoError(t, err)
+		var revs []api.SpecRevisionSummary
+		require.NoError(t, json.Unmarshal([]byte(out), &revs))
+		require.Len(t, revs, 1)
+	})
+
+	t.Run("peers", func(t *testing.T) {
+		peerPK, peerSK := cipher2.GenerateKeyPair()
+		entry, err := cxspec.MakeSignedPeerEntry(cxspec.PeerEntry{
+			PublicKey: peerPK,
+			LastSeen:  time.Now().Unix(),
+			CXChains:  map[string]cxspec.CXChainAddresses{hash.Hex(): {TCPAddr: "127.0.0.1:6001"}},
+		}, peerSK)
+		require.NoError(t, err)
+
+		status, err := store.MakeSignedPeerStatus(store.PeerStatus{
+			PublicKey: peerPK,
+			LastSeen:  entry.Entry.LastSeen,
+			Version:   "v0.1.0",
+			Chains:    map[string]store.ChainStatus{hash.Hex(): {Height: 42, HeadHash: hash.Hex()}},
+		}, peerSK)
+		require.NoError(t, err)
+
+		c := api.NewClient(logrus.New(), httpS.Client(), httpS.URL)
+		require.NoError(t, c.UpdatePeer(context.TODO(), api.Peer{SignedPeerEntry: entry, Status: &status}))
+
+		out, err := cli(t, "peers", "list", hash.Hex())
+		require.NoError(t, err)
+		require.Contains(t, out, "127.0.0.1:6001")
+
+		out, err = cli(t, "peers", "list", "-min-height", "43", hash.Hex())
+		require.NoError(t, err)
+		require.NotContains(t, out, "127.0.0.1:6001")
+
+		out, err = cli(t, "peers", "list", "-strategy", "freshest", hash.Hex())
+		require.NoError(t, err)
+		require.Contains(t, out, "127.0.0.1:6001")
+
+		_, err = cli(t, "peers", "list", "-strategy", "newest", hash.Hex())
+		require.Error(t, err)
+
+		out, err = cli(t, "peers", "print-list", hash.Hex())
+		require.NoError(t, err)
+		require.Equal(t, "127.0.0.1:6001\n", out)
+
+		out, err = cli(t, "peers", "show", peerPK.Hex())
+		require.NoError(t, err)
+		require.Contains(t, out, hash.Hex())
+		require.Contains(t, out, "v0.1.0")
+		require.Contains(t, out, "42")
+	})
+
+	t.Run("signed_delete", func(t *testing.T) {
+		out, err := cli(t, "specs", "sign-delete", "-keys", keysFile, hash.Hex())
+		require.NoError(t, err)
+		delFile := filepath.Join(dir, "deletion.json")
+		require.NoError(t, ioutil.WriteFile(delFile, []byte(out), 0600))
+
+		// The deletion is signed offline, so the tracker is not involved.
+		_, err = ss.ChainSpec(context.TODO(), hash)
+		require.NoError(t, err)
+
+		_, err = cli(t, "specs", "delete", "-signed", delFile)
+		require.NoError(t, err)
+
+		_, err = ss.ChainSpec(context.TODO(), hash)
+		require.Error(t, err)
+	})
+
+	t.Run("events", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var out syncBuffer
+		done := make(chan error, 1)
+		go func() {
+			args := []string{"-addr", httpS.URL, "-o", "json", "events", "-chain", hash.Hex(), "-type", "spec_added"}
+			done <- run(ctx, args, &out, ioutil.Discard)
+		}()
+		require.Eventually(t, func() bool { return bus.SubscriptionCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		_, err := cli(t, "specs", "post", signedSpecFile)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return strings.Contains(out.String(), `"type":"spec_added"`)
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	t.Run("admin_backup", func(t *testing.T) {
+		tokenFile := filepath.Join(dir, "token")
+		require.NoError(t, ioutil.WriteFile(tokenFile, []byte("admin-token\n"), 0600))
+		backupFile := filepath.Join(dir, "backup.db")
+
+		_, err := cli(t, "admin", "backup", backupFile)
+		require.Error(t, err, "a token is required")
+
+		out, err := cli(t, "-o", "json", "admin", "backup", "-token-file", tokenFile, backupFile)
+		require.NoError(t, err)
+		sum, err := store.BboltFileChecksum(backupFile)
+		require.NoError(t, err)
+		require.Contains(t, out, sum)
+
+		_, err = cli(t, "admin", "backup", "-token-file", tokenFile, backupFile)
+		require.Error(t, err, "existing files should not be overwritten")
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		_, err := cli(t, "unknown")
+		require.Error(t, err)
+
+		_, err = cli(t, "specs", "show")
+		require.Error(t, err)
+
+		_, err = cli(t, "-o", "yaml", "specs", "list")
+		require.Error(t, err)
+	})
+}
+
+func writeJSONFile(t *testing.T, dir, name string, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(filename, b, 0600))
+	return filename
+}
+
+// syncBuffer is a bytes.Buffer which is safe for concurrent use.
+type syncBuffer struct {
+	b  bytes.Buffer
+	mx sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.b.String()
+}
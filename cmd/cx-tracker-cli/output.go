@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputFormat is the format of command output.
+type outputFormat string
+
+// Output formats.
+const (
+	formatTable outputFormat = "table"
+	formatJSON  outputFormat = "json"
+)
+
+// String implements flag.Value.
+func (f *outputFormat) String() string { return string(*f) }
+
+// Set implements flag.Value.
+func (f *outputFormat) Set(s string) error {
+	switch v := outputFormat(strings.ToLower(s)); v {
+	case formatTable, formatJSON:
+		*f = v
+		return nil
+	default:
+		return fmt.Errorf("invalid output format '%s' (expected table|json)", s)
+	}
+}
+
+// printer writes command output as a table or as JSON.
+type printer struct {
+	w      io.Writer
+	format outputFormat
+}
+
+// print writes 'v' as indented JSON, or calls 'writeTable' to write it as a
+// table.
+func (p *printer) print(v interface{}, writeTable func(t *table)) error {
+	if p.format == formatJSON {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	t := &table{tw: tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)}
+	writeTable(t)
+	return t.tw.Flush()
+}
+
+// table writes tab-aligned rows.
+type table struct {
+	tw *tabwriter.Writer
+}
+
+// row writes a row of cells.
+func (t *table) row(cells ...interface{}) {
+	strs := make([]string, len(cells))
+	for i, c := range cells {
+		strs[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(t.tw, strings.Join(strs, "\t"))
+}
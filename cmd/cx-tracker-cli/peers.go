@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func peersList(ctx context.Context, e *env, args []string) error {
+	var (
+		q        store.PeerQuery
+		strategy string
+	)
+
+	fs := newFlagSet(e)
+	peerQueryFlags(fs, &q, &strategy)
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := parsePeerStrategy(&q, strategy); err != nil {
+		return err
+	}
+	hash, err := parseGenesisHash(args[0])
+	if err != nil {
+		return err
+	}
+
+	peers, err := e.client(false).QueryPeersOfChain(ctx, hash, q)
+	if err != nil {
+		return err
+	}
+
+	return e.printer().print(peers, func(t *table) {
+		t.row("DMSG_ADDR", "TCP_ADDR")
+		for _, p := range peers {
+			t.row(p.DmsgAddr.String(), orDash(p.TCPAddr))
+		}
+	})
+}
+
+func peersShow(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet(e)
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	pk, err := cipher.PubKeyFromHex(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid public key '%s': %w", args[0], err)
+	}
+
+	// Peer verifies the signatures of the returned entry and status.
+	peer, err := e.client(false).Peer(ctx, cipher2.PubKey(pk))
+	if err != nil {
+		return err
+	}
+	entry := peer.Entry
+
+	return e.printer().print(peer, func(t *table) {
+		t.row("PUBLIC_KEY", entry.PublicKey.Hex())
+		t.row("LAST_SEEN", formatUnix(entry.LastSeen))
+		if peer.Status != nil {
+			t.row("VERSION", orDash(peer.Status.Status.Version))
+		}
+		t.row("")
+		t.row("CHAIN", "DMSG_ADDR", "TCP_ADDR", "HEIGHT")
+
+		chains := make([]string, 0, len(entry.CXChains))
+		for chain := range entry.CXChains {
+			chains = append(chains, chain)
+		}
+		sort.Strings(chains)
+		for _, chain := range chains {
+			addrs := entry.CXChains[chain]
+
+			height := "-"
+			if peer.Status != nil {
+				if cs, ok := peer.Status.Status.Chains[chain]; ok {
+					height = strconv.FormatUint(cs.Height, 10)
+				}
+			}
+			t.row(chain, addrs.DmsgAddr.String(), orDash(addrs.TCPAddr), height)
+		}
+	})
+}
+
+func peersPrintList(ctx context.Context, e *env, args []string) error {
+	var (
+		q        store.PeerQuery
+		strategy string
+	)
+
+	fs := newFlagSet(e)
+	peerQueryFlags(fs, &q, &strategy)
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := parsePeerStrategy(&q, strategy); err != nil {
+		return err
+	}
+	hash, err := parseGenesisHash(args[0])
+	if err != nil {
+		return err
+	}
+
+	peers, err := e.client(false).QueryPeersOfChain(ctx, hash, q)
+	if err != nil {
+		return err
+	}
+
+	// The list is in the format of the '-custom-peers-file' of cx nodes: a
+	// newline-separated list of 'ip:port'. Peers without a TCP address are
+	// omitted.
+	list := tcpAddrs(peers)
+	if e.format == formatJSON {
+		return e.printer().print(list, nil)
+	}
+	for _, addr := range list {
+		fmt.Fprintln(e.out, addr)
+	}
+	return nil
+}
+
+func peerQueryFlags(fs *flag.FlagSet, q *store.PeerQuery, strategy *string) {
+	fs.IntVar(&q.Max, "max", 0, "maximum `NUMBER` of peers (0 for the tracker default)")
+	fs.Uint64Var(&q.MinHeight, "min-height", 0, "only list peers which report a head block of at least `HEIGHT`")
+	fs.StringVar(strategy, "strategy", "", "peer selection `STRATEGY` (random|freshest|diverse|reachable-only|highest-height, tracker default if empty)")
+}
+
+// parsePeerStrategy parses the '-strategy' flag into 'q'.
+func parsePeerStrategy(q *store.PeerQuery, strategy string) error {
+	if strategy == "" {
+		return nil
+	}
+	var err error
+	q.Strategy, err = store.ParsePeerStrategy(strategy)
+	return err
+}
+
+func tcpAddrs(peers []cxspec.CXChainAddresses) []string {
+	out := make([]string, 0, len(peers))
+	for _, p := range peers {
+		if p.TCPAddr != "" {
+			out = append(out, p.TCPAddr)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
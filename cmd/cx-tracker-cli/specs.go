@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func specsList(ctx context.Context, e *env, args []string) error {
+	var (
+		q    store.SpecQuery
+		sort string
+	)
+
+	fs := newFlagSet(e)
+	fs.StringVar(&q.CoinTicker, "ticker", "", "only list chain specs of coin `TICKER`")
+	fs.StringVar(&q.CoinName, "coin", "", "only list chain specs of coin `NAME`")
+	fs.StringVar(&q.ChainPubKey, "chain-pk", "", "only list chain specs of chain `PUBLIC_KEY`")
+	fs.StringVar(&q.SpecEra, "era", "", "only list chain specs of spec `ERA`")
+	fs.StringVar(&sort, "sort", "", "`FIELD` to sort by (genesis_hash|genesis_timestamp)")
+	fs.BoolVar(&q.Desc, "desc", false, "sort in descending order")
+	fs.IntVar(&q.Limit, "limit", 0, "maximum `NUMBER` of chain specs to list (0 for no limit)")
+	fs.StringVar(&q.Cursor, "cursor", "", "`CURSOR` of the page to list (printed by the previous page)")
+
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	var err error
+	if q.SortBy, err = store.ParseSpecSortField(sort); err != nil {
+		return err
+	}
+
+	specs, next, err := e.client(false).QuerySpecSummaries(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	err = e.printer().print(specs, func(t *table) {
+		t.row("GENESIS_HASH", "TICKER", "COIN_NAME", "CHAIN_PUBKEY", "GENESIS_TIME")
+		for _, s := range specs {
+			t.row(s.GenesisHash, s.CoinTicker, s.CoinName, s.ChainPubKey, formatUnix(int64(s.GenesisTimestamp)))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if next != "" {
+		fmt.Fprintf(e.errOut, "More chain specs are available with: -cursor %s\n", next)
+	}
+	return nil
+}
+
+func specsShow(ctx context.Context, e *env, args []string) error {
+	var (
+		rev       uint64
+		revisions bool
+	)
+
+	fs := newFlagSet(e)
+	fs.Uint64Var(&rev, "rev", 0, "show `REVISION` of the chain spec instead of the latest one")
+	fs.BoolVar(&revisions, "revisions", false, "show the revision history of the chain spec")
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	hash, err := parseGenesisHash(args[0])
+	if err != nil {
+		return err
+	}
+
+	c := e.client(false)
+
+	if revisions {
+		revs, err := c.SpecRevisions(ctx, hash)
+		if err != nil {
+			return err
+		}
+		return e.printer().print(revs, func(t *table) {
+			t.row("REVISION", "CREATED", "SPEC_HASH", "SIG")
+			for _, r := range revs {
+				t.row(r.Revision, formatUnix(r.Created), r.SpecHash, r.Sig)
+			}
+		})
+	}
+
+	var spec cxspec.SignedChainSpec
+	if rev > 0 {
+		r, err := c.SpecRevision(ctx, hash, rev)
+		if err != nil {
+			return err
+		}
+		spec = r.Spec
+	} else if spec, err = c.SpecByGenesisHash(ctx, hash); err != nil {
+		return err
+	}
+
+	return e.printer().print(spec, func(t *table) {
+		specTable(t, hash, spec)
+	})
+}
+
+func specsPost(ctx context.Context, e *env, args []string) error {
+	var (
+		skHex    string
+		keysFile string
+		revise   bool
+	)
+
+	fs := newFlagSet(e)
+	fs.StringVar(&skHex, "sk", "", "chain `SECRET_KEY` to sign an unsigned chain spec with")
+	fs.StringVar(&keysFile, "keys", "", "chain key `FILEPATH` to sign an unsigned chain spec with")
+	fs.BoolVar(&revise, "revise", false, "post a new revision of an existing chain spec")
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	spec, signed, err := readSpecFile(args[0])
+	if err != nil {
+		return err
+	}
+	if !signed {
+		sk, err := chainSecKey(skHex, keysFile)
+		if err != nil {
+			return fmt.Errorf("chain spec file '%s' is not signed: %w", args[0], err)
+		}
+		if spec, err = cxspec.MakeSignedChainSpec(spec.Spec, sk); err != nil {
+			return err
+		}
+	}
+
+	hash, err := store.SpecGenesisHash(spec)
+	if err != nil {
+		return err
+	}
+
+	c := e.client(false)
+	out := struct {
+		GenesisHash string `json:"genesis_hash"`
+		Revision    uint64 `json:"revision"`
+	}{GenesisHash: hash.Hex(), Revision: 1}
+
+	if revise {
+		if out.Revision, err = c.ReviseSpec(ctx, spec); err != nil {
+			return err
+		}
+	} else if err := c.PostSpec(ctx, spec); err != nil {
+		return err
+	}
+
+	return e.printer().print(out, func(t *table) {
+		t.row("GENESIS_HASH", "REVISION")
+		t.row(out.GenesisHash, out.Revision)
+	})
+}
+
+func specsDelete(ctx context.Context, e *env, args []string) error {
+	var (
+		skHex    string
+		keysFile string
+		delFile  string
+	)
+
+	fs := newFlagSet(e)
+	fs.StringVar(&skHex, "sk", "", "chain `SECRET_KEY` to sign the deletion with")
+	fs.StringVar(&keysFile, "keys", "", "chain key `FILEPATH` to sign the deletion with")
+	fs.StringVar(&delFile, "signed", "", "submit a pre-signed deletion `FILEPATH` (from 'specs sign-delete')")
+
+	args, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	var del api.SignedSpecDeletion
+	switch {
+	case delFile != "" && len(args) == 0:
+		if del, err = readDeletionFile(delFile); err != nil {
+			return err
+		}
+	case delFile == "" && len(args) == 1:
+		hash, err := parseGenesisHash(args[0])
+		if err != nil {
+			return err
+		}
+		sk, err := chainSecKey(skHex, keysFile)
+		if err != nil {
+			return err
+		}
+		if del, err = api.MakeSignedSpecDeletion(hash, sk); err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("%s: either GENESIS_HASH or -signed should be provided", fs.Name())
+	}
+
+	if err := e.client(false).DelSpecSigned(ctx, del); err != nil {
+		return err
+	}
+
+	return e.printer().print(del.Deletion, func(t *table) {
+		t.row("DELETED")
+		t.row(del.Deletion.GenesisHash)
+	})
+}
+
+func specsSignDelete(_ context.Context, e *env, args []string) error {
+	var (
+		skHex    string
+		keysFile string
+	)
+
+	fs := newFlagSet(e)
+	fs.StringVar(&skHex, "sk", "", "chain `SECRET_KEY` to sign the deletion with")
+	fs.StringVar(&keysFile, "keys", "", "chain key `FILEPATH` to sign the deletion with")
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	hash, err := parseGenesisHash(args[0])
+	if err != nil {
+		return err
+	}
+	sk, err := chainSecKey(skHex, keysFile)
+	if err != nil {
+		return err
+	}
+
+	del, err := api.MakeSignedSpecDeletion(hash, sk)
+	if err != nil {
+		return err
+	}
+
+	// The signed deletion is always printed as JSON so that it can be
+	// submitted with 'specs delete -signed'.
+	b, err := json.MarshalIndent(del, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.out, string(b))
+	fmt.Fprintf(e.errOut, "The deletion is valid for %s.\n", api.SpecDeletionTolerance)
+	return nil
+}
+
+// specTable writes the fields of a chain spec as rows.
+func specTable(t *table, hash cipher.SHA256, spec cxspec.SignedChainSpec) {
+	s := spec.Spec
+	t.row("GENESIS_HASH", hash.Hex())
+	t.row("SPEC_ERA", s.SpecEra)
+	t.row("CHAIN_PUBKEY", s.ChainPubKey)
+	t.row("COIN_NAME", s.CoinName)
+	t.row("COIN_TICKER", s.CoinTicker)
+	t.row("COIN_HOURS_NAME", s.CoinHoursName)
+	t.row("COIN_HOURS_TICKER", s.CoinHoursTicker)
+	t.row("GENESIS_ADDRESS", s.GenesisAddr)
+	t.row("GENESIS_COIN_VOLUME", s.GenesisCoinVolume)
+	t.row("GENESIS_TIME", formatUnix(int64(s.GenesisTimestamp)))
+	t.row("MAX_COIN_SUPPLY", s.MaxCoinSupply)
+	t.row("NODE_PORT", s.Node.Port)
+	t.row("DEFAULT_CONNECTIONS", s.Node.DefaultConnections)
+	t.row("SPEC_HASH", s.SpecHash().Hex())
+	t.row("SIG", spec.Sig)
+}
+
+func parseGenesisHash(s string) (cipher.SHA256, error) {
+	hash, err := cipher.SHA256FromHex(s)
+	if err != nil {
+		return cipher.SHA256{}, fmt.Errorf("invalid genesis hash '%s': %w", s, err)
+	}
+	return hash, nil
+}
+
+// formatUnix formats a unix timestamp in UTC time ("-" if zero).
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// verifyResult is the result of verifying a chain spec file.
+type verifyResult struct {
+	File        string `json:"file"`
+	GenesisHash string `json:"genesis_hash"`
+	ChainPubKey string `json:"chain_pubkey"`
+	CoinName    string `json:"coin_name"`
+	CoinTicker  string `json:"coin_ticker"`
+	SpecHash    string `json:"spec_hash"`
+	Valid       bool   `json:"valid"`
+}
+
+func verify(_ context.Context, e *env, args []string) error {
+	var expHash string
+
+	fs := newFlagSet(e)
+	fs.StringVar(&expHash, "hash", "", "expected `GENESIS_HASH` of the chain spec")
+
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	spec, signed, err := readSpecFile(args[0])
+	if err != nil {
+		return err
+	}
+	if !signed {
+		return fmt.Errorf("chain spec file '%s' is not signed", args[0])
+	}
+	if err := spec.Verify(); err != nil {
+		return fmt.Errorf("chain spec file '%s' is invalid: %w", args[0], err)
+	}
+
+	hash, err := store.SpecGenesisHash(spec)
+	if err != nil {
+		return err
+	}
+	if spec.GenesisHash != "" && spec.GenesisHash != hash.Hex() {
+		return fmt.Errorf("chain spec file '%s' has genesis hash '%s', but the chain spec generates '%s'",
+			args[0], spec.GenesisHash, hash.Hex())
+	}
+	if expHash != "" {
+		exp, err := parseGenesisHash(expHash)
+		if err != nil {
+			return err
+		}
+		if exp != hash {
+			return fmt.Errorf("chain spec file '%s' generates genesis hash '%s' (expected '%s')",
+				args[0], hash.Hex(), exp.Hex())
+		}
+	}
+
+	res := verifyResult{
+		File:        args[0],
+		GenesisHash: hash.Hex(),
+		ChainPubKey: spec.Spec.ChainPubKey,
+		CoinName:    spec.Spec.CoinName,
+		CoinTicker:  spec.Spec.CoinTicker,
+		SpecHash:    spec.Spec.SpecHash().Hex(),
+		Valid:       true,
+	}
+
+	return e.printer().print(res, func(t *table) {
+		t.row("FILE", res.File)
+		t.row("GENESIS_HASH", res.GenesisHash)
+		t.row("CHAIN_PUBKEY", res.ChainPubKey)
+		t.row("COIN_NAME", res.CoinName)
+		t.row("COIN_TICKER", res.CoinTicker)
+		t.row("SPEC_HASH", res.SpecHash)
+		t.row("VALID", res.Valid)
+	})
+}
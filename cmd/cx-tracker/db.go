@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// dbCommand is a subcommand of 'cx-tracker db'.
+type dbCommand struct {
+	name  string
+	args  string
+	short string
+	run   func(fs *flag.FlagSet, args []string, out io.Writer) error
+}
+
+var dbCommands = []dbCommand{
+	{"inspect", "", "print bucket sizes and object counts", dbInspect},
+	{"verify", "", "check pages, stored values and chain spec signatures", dbVerify},
+	{"compact", "DST_FILEPATH", "write a compacted copy of the database", dbCompact},
+	{"backup", "DST_FILEPATH", "write a consistent snapshot of the database", dbBackup},
+	{"restore", "BACKUP_FILEPATH", "verify a backup and restore it as the database", dbRestore},
+	{"migrate", "", "migrate the database to the current schema version", dbMigrate},
+}
+
+// errDBIssues is returned when 'db verify' finds issues.
+var errDBIssues = errors.New("database has issues")
+
+// runDB runs 'cx-tracker db <command>'. The commands work on the database
+// file directly, so the tracker using it should be stopped first (the file is
+// locked while in use).
+func runDB(args []string, out, errOut io.Writer) error {
+	usage := func() {
+		fmt.Fprintln(errOut, "Usage: cx-tracker db <command> [flags] [args]")
+		fmt.Fprintln(errOut, "\nCommands:")
+		tw := tabwriter.NewWriter(errOut, 0, 4, 2, ' ', 0)
+		for _, c := range dbCommands {
+			fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.args, c.short)
+		}
+		_ = tw.Flush() //nolint:errcheck
+	}
+
+	if len(args) == 0 {
+		usage()
+		return errors.New("no command provided")
+	}
+
+	for _, c := range dbCommands {
+		if c.name != args[0] {
+			continue
+		}
+
+		c := c
+		fs := flag.NewFlagSet("cx-tracker db "+c.name, flag.ContinueOnError)
+		fs.SetOutput(errOut)
+		fs.Usage = func() {
+			fmt.Fprintf(errOut, "Usage: %s\n\n%s.\n\nFlags:\n", strings.TrimSpace(fs.Name()+" [flags] "+c.args), c.short)
+			fs.PrintDefaults()
+		}
+		fs.StringVar(&dbFile, "db", dbFile, "database `FILEPATH`")
+		return c.run(fs, args[1:], out)
+	}
+
+	usage()
+	return fmt.Errorf("unknown command '%s'", args[0])
+}
+
+// parseDBArgs parses flags and ensures that exactly 'n' arguments remain.
+func parseDBArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != n {
+		fs.Usage()
+		return nil, fmt.Errorf("%s: expected %d arguments, got %d", fs.Name(), n, fs.NArg())
+	}
+	return fs.Args(), nil
+}
+
+func dbInspect(fs *flag.FlagSet, args []string, out io.Writer) error {
+	jsonOut := fs.Bool("json", false, "print output as JSON")
+	if _, err := parseDBArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	db, err := store.OpenBboltDBReadOnly(dbFile)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }() //nolint:errcheck
+
+	info, err := store.InspectBboltDB(db)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		return writeJSON(out, info)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PATH\t%s\n", info.Path)
+	fmt.Fprintf(tw, "SCHEMA_VERSION\t%d (current: %d)\n", info.SchemaVersion, store.BboltSchemaVersion)
+	fmt.Fprintf(tw, "FILE_SIZE\t%d\n", info.FileSize)
+	fmt.Fprintf(tw, "PAGE_SIZE\t%d\n", info.PageSize)
+	fmt.Fprintf(tw, "FREE_PAGES\t%d\n", info.FreePages)
+	names := make([]string, 0, len(info.Counts))
+	for name := range info.Counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "COUNT(%s)\t%d\n", name, info.Counts[name])
+	}
+	fmt.Fprintln(tw, "\nBUCKET\tKEYS\tBUCKETS\tDEPTH\tBYTES_INUSE\tBYTES_ALLOC")
+	for _, b := range info.Buckets {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", b.Name, b.Keys, b.Buckets, b.Depth, b.BytesInUse, b.BytesAlloc)
+	}
+	return tw.Flush()
+}
+
+func dbVerify(fs *flag.FlagSet, args []string, out io.Writer) error {
+	jsonOut := fs.Bool("json", false, "print output as JSON")
+	if _, err := parseDBArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	db, err := store.OpenBboltDBReadOnly(dbFile)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }() //nolint:errcheck
+
+	report, err := store.VerifyBboltDB(db)
+	if err != nil {
+		return err
+	}
+	if err := writeVerifyReport(out, report, *jsonOut); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("%w: %d issues found", errDBIssues, len(report.Issues))
+	}
+	return nil
+}
+
+func dbCompact(fs *flag.FlagSet, args []string, out io.Writer) error {
+	args, err := parseDBArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	srcSize, dstSize, err := store.CompactBboltFile(args[0], dbFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Compacted '%s' (%d bytes) into '%s' (%d bytes).\n", dbFile, srcSize, args[0], dstSize)
+	return nil
+}
+
+func dbBackup(fs *flag.FlagSet, args []string, out io.Writer) error {
+	args, err := parseDBArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	n, err := store.BackupBboltFile(args[0], dbFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Backed up '%s' into '%s' (%d bytes).\n", dbFile, args[0], n)
+	return nil
+}
+
+func dbRestore(fs *flag.FlagSet, args []string, out io.Writer) error {
+	force := fs.Bool("force", false, "replace an existing database file")
+	args, err := parseDBArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	report, err := store.RestoreBboltFile(dbFile, args[0], *force)
+	if !report.OK() {
+		_ = writeVerifyReport(out, report, false) //nolint:errcheck
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Restored '%s' from '%s' (%d chain specs, %d peer entries).\n",
+		dbFile, args[0], report.Specs, report.PeerEntries)
+	return nil
+}
+
+func dbMigrate(fs *flag.FlagSet, args []string, out io.Writer) error {
+	dryRun := fs.Bool("dry-run", false, "apply migrations in a transaction which is rolled back")
+	if _, err := parseDBArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	// Migrations are also applied when the tracker starts. The database
+	// should exist, as an empty database would be initialized instead.
+	if _, err := os.Stat(dbFile); err != nil {
+		return err
+	}
+	db, err := store.OpenBboltDB(dbFile)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }() //nolint:errcheck
+
+	migrations, err := store.MigrateBboltDB(db, *dryRun)
+	verb := "Applied"
+	if *dryRun {
+		verb = "Would apply"
+	}
+	for _, m := range migrations {
+		fmt.Fprintf(out, "%s migration to schema version %d (%s).\n", verb, m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *dryRun && len(migrations) > 0 {
+		fmt.Fprintf(out, "Dry run: database '%s' was not changed.\n", dbFile)
+		return nil
+	}
+	fmt.Fprintf(out, "Database '%s' is at schema version %d.\n", dbFile, store.BboltSchemaVersion)
+	return nil
+}
+
+func writeVerifyReport(out io.Writer, report store.BboltVerifyReport, jsonOut bool) error {
+	if jsonOut {
+		return writeJSON(out, report)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "SPECS\t%d\n", report.Specs)
+	fmt.Fprintf(tw, "REVISIONS\t%d\n", report.Revisions)
+	fmt.Fprintf(tw, "PEER_ENTRIES\t%d\n", report.PeerEntries)
+	fmt.Fprintf(tw, "PEER_ADDRS\t%d\n", report.PeerAddrs)
+	fmt.Fprintf(tw, "ISSUES\t%d\n", len(report.Issues))
+	if !report.OK() {
+		fmt.Fprintln(tw, "\nBUCKET\tKEY\tERROR")
+		for _, issue := range report.Issues {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", orDash(issue.Bucket), orDash(issue.Key), issue.Err)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// dbMain runs 'cx-tracker db' and exits.
+func dbMain(args []string) {
+	err := runDB(args, os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+		os.Exit(0)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
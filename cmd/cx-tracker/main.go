@@ -3,12 +3,29 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
 	"github.com/skycoin/skycoin/src/util/logging"
 
 	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/dmsghttp"
+	"github.com/skycoin/cx-tracker/pkg/events"
+	"github.com/skycoin/cx-tracker/pkg/federation"
+	"github.com/skycoin/cx-tracker/pkg/metrics"
+	"github.com/skycoin/cx-tracker/pkg/mirror"
+	"github.com/skycoin/cx-tracker/pkg/policy"
+	"github.com/skycoin/cx-tracker/pkg/prober"
+	"github.com/skycoin/cx-tracker/pkg/ratelimit"
 	"github.com/skycoin/cx-tracker/pkg/store"
 )
 
@@ -18,31 +35,266 @@ const (
 	memSize    = 100
 )
 
+// metricsNamespace is the namespace of prometheus metrics.
+const metricsNamespace = "cx_tracker"
+
+// peers store types
+const (
+	peersStoreMemory = "memory"
+	peersStoreBbolt  = "bbolt"
+)
+
 var (
-	addr   = ":9091"           // serve address
-	dbFile = "./cx_tracker.db" // database file path
+	addr       = ":9091"           // serve address
+	dbFile     = "./cx_tracker.db" // database file path
+	peersStore = peersStoreMemory  // peers store type
+	policyFile = ""                // spec admission policy file path
+
+	peersMaxEntries  = store.DefaultMaxEntries           // maximum number of peer entries of the memory peers store
+	peersMaxChains   = store.DefaultMaxChains            // maximum number of chains of the memory peers store
+	peersMaxPerChain = store.DefaultMaxPeersPerChain     // maximum number of peers per chain of the memory peers store
+	peersEviction    = string(store.EvictOldest)         // eviction policy of the memory peers store
+	peersStrategy    = string(store.DefaultPeerStrategy) // default peer selection strategy of peer queries
+
+	adminTokenFile = "" // file containing the admin bearer token (admin endpoints are disabled if empty)
+	restoreFile    = "" // backup file to restore the database from on start
+	restoreSHA256  = "" // expected checksum of the backup file
+
+	eventsHistory = events.DefaultHistory // number of recent events kept for resuming
+
+	rateLimitIP     = ratelimit.DefaultIPLimit      // limit of posts per client IP
+	rateLimitPeer   = ratelimit.DefaultPeerPKLimit  // limit of peer entries per peer public key
+	rateLimitChain  = ratelimit.DefaultChainPKLimit // limit of chain specs per chain public key
+	rateLimitExempt = ""                            // comma-separated client IPs which are exempt from the IP limit
+	trustedProxies  = ""                            // comma-separated IPs of proxies which set the client IP headers
+
+	fedPeers     = ""                             // comma-separated addresses of peer trackers
+	fedID        = ""                             // federation ID of this tracker
+	fedInterval  = federation.DefaultPullInterval // duration between pulling specs from peer trackers
+	fedMaxHops   = federation.DefaultMaxHops      // maximum number of trackers that relay a peer entry
+	fedTokenFile = ""                             // file containing the federation token (relays are not authenticated if empty)
+
+	mirrorURL      = ""                     // address of the upstream tracker to mirror
+	mirrorInterval = mirror.DefaultInterval // duration between syncs with the upstream tracker
+
+	probeMode     = string(store.ReachabilityIgnore) // peer reachability mode
+	probeInterval = prober.DefaultInterval           // duration between probing rounds
+	probeTimeout  = prober.DefaultTimeout            // dial timeout of a single probe
+	probeLocal    = false                            // whether to also probe local and private addresses
+
+	dmsgPK   cipher.PubKey                // dmsg public key
+	dmsgSK   cipher.SecKey                // dmsg secret key (dmsg is disabled if not set)
+	dmsgDisc = dmsg.DefaultDiscAddr       // dmsg discovery address
+	dmsgPort = uint(dmsghttp.DefaultPort) // dmsg port to serve on
 )
 
 func init() {
 	flag.StringVar(&addr, "addr", addr, "HTTP `ADDRESS` to serve on")
 	flag.StringVar(&dbFile, "db", dbFile, "database `FILEPATH`")
+	flag.StringVar(&peersStore, "peers-store", peersStore, "peers store `TYPE` (memory|bbolt)")
+	flag.IntVar(&peersMaxEntries, "peers-max-entries", peersMaxEntries, "maximum `NUMBER` of peer entries of the memory peers store (0 is unlimited)")
+	flag.IntVar(&peersMaxChains, "peers-max-chains", peersMaxChains, "maximum `NUMBER` of chains of the memory peers store (0 is unlimited)")
+	flag.IntVar(&peersMaxPerChain, "peers-max-per-chain", peersMaxPerChain, "maximum `NUMBER` of peers per chain of the memory peers store (0 is unlimited)")
+	flag.StringVar(&peersEviction, "peers-eviction", peersEviction, "eviction `POLICY` of the memory peers store when a limit is reached (oldest|lowest-score)")
+	flag.StringVar(&peersStrategy, "peers-strategy", peersStrategy, "default peer selection `STRATEGY` of peer lists (random|freshest|diverse|reachable-only|highest-height)")
+	flag.StringVar(&policyFile, "policy", policyFile, "spec admission policy `FILEPATH` (admit all if empty)")
+	flag.StringVar(&adminTokenFile, "admin-token-file", adminTokenFile, "`FILEPATH` of the admin bearer token (admin endpoints are disabled if empty)")
+	flag.StringVar(&restoreFile, "restore", restoreFile, "restore the database from backup `FILEPATH` on start (replaces the database file)")
+	flag.StringVar(&restoreSHA256, "restore-sha256", restoreSHA256, "expected SHA256 `CHECKSUM` of the -restore backup file")
+	flag.IntVar(&eventsHistory, "events-history", eventsHistory, "`NUMBER` of recent events kept for resuming event streams")
+	flag.Var(&rateLimitIP, "rate-limit-ip", "`LIMIT` of spec and peer posts per client IP (format: <events>/<duration> or off)")
+	flag.Var(&rateLimitPeer, "rate-limit-peer", "`LIMIT` of peer entries per peer public key (format: <events>/<duration> or off)")
+	flag.Var(&rateLimitChain, "rate-limit-chain", "`LIMIT` of chain spec posts per chain public key (format: <events>/<duration> or off)")
+	flag.StringVar(&rateLimitExempt, "rate-limit-exempt", rateLimitExempt, "comma-separated client `IPS` which are exempt from -rate-limit-ip")
+	flag.StringVar(&trustedProxies, "trusted-proxies", trustedProxies, "comma-separated `IPS` of proxies whose X-Forwarded-For and X-Real-IP headers are trusted")
+	flag.StringVar(&fedPeers, "federation-peers", fedPeers, "comma-separated `ADDRESSES` of peer trackers to federate with")
+	flag.StringVar(&fedID, "federation-id", fedID, "federation `ID` of this tracker (random if empty)")
+	flag.DurationVar(&fedInterval, "federation-interval", fedInterval, "`DURATION` between pulling specs from peer trackers")
+	flag.IntVar(&fedMaxHops, "federation-max-hops", fedMaxHops, "maximum `NUMBER` of trackers that relay a peer entry")
+	flag.StringVar(&fedTokenFile, "federation-token-file", fedTokenFile, "`FILEPATH` of the token shared by federated trackers (relays are not authenticated if empty)")
+	flag.StringVar(&mirrorURL, "mirror", mirrorURL, "serve a read-only mirror of the upstream tracker at `URL`")
+	flag.DurationVar(&mirrorInterval, "mirror-interval", mirrorInterval, "`DURATION` between syncs with the upstream tracker")
+	flag.StringVar(&probeMode, "probe", probeMode, "peer reachability probing `MODE` (off|prefer|require)")
+	flag.DurationVar(&probeInterval, "probe-interval", probeInterval, "`DURATION` between peer probing rounds")
+	flag.DurationVar(&probeTimeout, "probe-timeout", probeTimeout, "dial `TIMEOUT` of a single peer probe")
+	flag.BoolVar(&probeLocal, "probe-local", probeLocal, "also probe loopback, link-local and private peer addresses")
+	flag.Var(&dmsgPK, "dmsg-pk", "dmsg `PUBLIC_KEY` (derived from -dmsg-sk if not set)")
+	flag.Var(&dmsgSK, "dmsg-sk", "dmsg `SECRET_KEY` (serve over dmsg if set)")
+	flag.StringVar(&dmsgDisc, "dmsg-disc", dmsgDisc, "dmsg discovery `ADDRESS`")
+	flag.UintVar(&dmsgPort, "dmsg-port", dmsgPort, "dmsg `PORT` to serve on")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		dbMain(os.Args[2:])
+	}
+
 	flag.Parse()
 	log := logging.MustGetLogger("main")
 
+	if restoreFile != "" {
+		if err := restoreDB(); err != nil {
+			log.WithError(err).Fatal("Failed to restore bbolt db.")
+		}
+		log.WithField("db_file", dbFile).
+			WithField("restore_file", restoreFile).
+			Info("Restored bbolt db from backup.")
+	}
+
 	db, err := store.OpenBboltDB(dbFile)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to open bbolt db.")
 	}
 
-	specS, err := store.NewBboltSpecStore(db)
-	if err != nil {
+	var specS store.SpecStore
+	if specS, err = store.NewBboltSpecStore(db); err != nil {
 		log.WithError(err).Fatal("Failed to init spec store.")
 	}
 
-	peersS := store.NewMemoryPeersStore(memTimeout, memSize)
+	// Object counts may drift if the database was written by an older version
+	// which did not maintain them.
+	drifts, err := store.ReconcileBboltCounts(db)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to reconcile object counts.")
+	}
+	for _, d := range drifts {
+		log.WithField("bucket", d.Bucket).
+			WithField("stored", d.Stored).
+			WithField("actual", d.Actual).
+			Warn("Repaired drifted object count.")
+	}
+
+	if mirrorURL != "" && (policyFile != "" || fedPeers != "" || isFlagSet("peers-store")) {
+		log.Fatal("Mirror mode cannot be combined with -policy, -federation-peers or -peers-store.")
+	}
+
+	if eventsHistory <= 0 {
+		log.WithField("events_history", eventsHistory).Fatal("Invalid events history.")
+	}
+	bus := events.NewBus(eventsHistory)
+
+	if policyFile != "" {
+		conf, err := policy.LoadConfig(policyFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to load spec admission policy.")
+		}
+		pol, err := conf.Policy()
+		if err != nil {
+			log.WithError(err).Fatal("Invalid spec admission policy.")
+		}
+		specS = policy.WrapSpecStore(specS, pol)
+		log.WithField("policy_file", policyFile).
+			WithField("rules", pol.Len()).
+			Info("Loaded spec admission policy.")
+	}
+
+	var mir *mirror.Mirror
+	var peersS store.PeersStore
+	switch {
+	case mirrorURL != "":
+		conf := mirror.DefaultConfig()
+		conf.Upstream = mirrorURL
+		conf.Interval = mirrorInterval
+
+		// Spec changes synced from upstream are published as events.
+		if mir, err = mirror.New(logging.MustGetLogger("mirror"), conf, events.WrapSpecStore(specS, bus)); err != nil {
+			log.WithError(err).Fatal("Invalid mirror config.")
+		}
+		peersS = mir.PeersStore()
+		go mir.Run(context.Background())
+
+		log.WithField("upstream", mirrorURL).Info("Mirroring upstream tracker.")
+	case peersStore == peersStoreMemory:
+		eviction, err := store.ParseEvictionPolicy(peersEviction)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid peers eviction policy.")
+		}
+		memS := store.NewMemoryPeersStore(memTimeout, memSize)
+		memS.SetLimits(store.MemoryPeersLimits{
+			MaxEntries:       peersMaxEntries,
+			MaxChains:        peersMaxChains,
+			MaxPeersPerChain: peersMaxPerChain,
+			Eviction:         eviction,
+		})
+		peersS = memS
+	case peersStore == peersStoreBbolt:
+		if peersS, err = store.NewBboltPeersStore(db, memTimeout); err != nil {
+			log.WithError(err).Fatal("Failed to init peers store.")
+		}
+	default:
+		log.WithField("peers_store", peersStore).Fatal("Invalid peers store type.")
+	}
+
+	var (
+		fed      *federation.Federation
+		fedToken string
+	)
+	if fedTokenFile != "" {
+		if fedToken, err = readToken(fedTokenFile); err != nil {
+			log.WithError(err).Fatal("Failed to read federation token.")
+		}
+	}
+	if fedPeers != "" {
+		conf := federation.DefaultConfig()
+		if fedID != "" {
+			conf.ID = fedID
+		}
+		conf.Peers = strings.Split(fedPeers, ",")
+		conf.PullInterval = fedInterval
+		conf.MaxHops = fedMaxHops
+		conf.Token = fedToken
+
+		// Specs imported from peer trackers are published as events.
+		if fed, err = federation.New(logging.MustGetLogger("federation"), conf, events.WrapSpecStore(specS, bus)); err != nil {
+			log.WithError(err).Fatal("Invalid federation config.")
+		}
+		if fedToken == "" {
+			log.Warn("Relays of peer trackers are not authenticated and may be rate limited, set -federation-token-file.")
+		}
+
+		specS = fed.WrapSpecStore(specS)
+		peersS = fed.WrapPeersStore(peersS)
+		go fed.Run(context.Background())
+
+		log.WithField("federation_id", conf.ID).
+			WithField("federation_peers", conf.Peers).
+			Info("Federating with peer trackers.")
+	}
+
+	specS = events.WrapSpecStore(specS, bus)
+	peersS = events.WrapPeersStore(peersS, bus)
+
+	reachMode, err := store.ParseReachabilityMode(probeMode)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid probe mode.")
+	}
+	strategy, err := store.ParsePeerStrategy(peersStrategy)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid peers strategy.")
+	}
+	if strategy == store.StrategyReachable && reachMode == store.ReachabilityIgnore {
+		log.Fatal("Peers strategy 'reachable-only' requires -probe.")
+	}
+	if reachMode != store.ReachabilityIgnore {
+		conf := prober.Config{
+			Interval:    probeInterval,
+			Timeout:     probeTimeout,
+			Concurrency: prober.DefaultConcurrency,
+			AllowLocal:  probeLocal,
+		}
+		p := prober.New(logging.MustGetLogger("prober"), prober.TargetsOfPeersStore(peersS), conf)
+		peersS.SetReachability(p, reachMode)
+		go p.Run(context.Background())
+	}
+
+	m := metrics.New(metricsNamespace)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector())
+	reg.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	reg.MustRegister(metrics.NewStoreCollector(metricsNamespace, specS, peersS))
+	reg.MustRegister(m.Collectors()...)
+
 	go func() {
 		log := logging.MustGetLogger("mem_gc")
 
@@ -52,15 +304,131 @@ func main() {
 		for start := range t.C {
 			log := log.WithField("start", start)
 			log.Debug("Starting garbage collection...")
-			peersS.GarbageCollect(context.Background())
-			log.WithField("elapsed", time.Since(start)).Info("Finished garbage collection.")
+			evicted := peersS.GarbageCollect(context.Background())
+			elapsed := time.Since(start)
+			m.ObserveGC(elapsed, evicted)
+			log.WithField("elapsed", elapsed).
+				WithField("evicted", evicted).
+				Info("Finished garbage collection.")
 		}
 	}()
 
-	r := api.NewHTTPRouter(specS, peersS)
-	log.WithField("addr", addr).WithField("db_file", dbFile).Info("Serving cx-tracker...")
+	limitConf := ratelimit.Config{IP: rateLimitIP, PeerPK: rateLimitPeer, ChainPK: rateLimitChain}
+	if rateLimitExempt != "" {
+		limitConf.Exempt = strings.Split(rateLimitExempt, ",")
+	}
+
+	apiOpts := []api.Option{
+		api.WithMetrics(m),
+		api.WithEvents(bus),
+		api.WithRateLimiter(ratelimit.New(limitConf)),
+		api.WithPeerStrategy(strategy),
+		api.WithFederationToken(fedToken),
+	}
+	if trustedProxies != "" {
+		ips := strings.Split(trustedProxies, ",")
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				log.WithField("ip", ip).Fatal("Invalid trusted proxy IP.")
+			}
+		}
+		apiOpts = append(apiOpts, api.WithTrustedProxies(ips))
+	}
+	if adminTokenFile != "" {
+		token, err := readToken(adminTokenFile)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to read admin token.")
+		}
+		apiOpts = append(apiOpts, api.WithAdmin(token, db))
+	}
+	if mir != nil {
+		apiOpts = append(apiOpts, api.WithReadOnly(mirrorURL))
+	}
+	apiH := api.NewHTTPRouter(specS, peersS, apiOpts...)
+
+	if !dmsgSK.Null() {
+		if dmsgPK.Null() {
+			if dmsgPK, err = dmsgSK.PubKey(); err != nil {
+				log.WithError(err).Fatal("Invalid dmsg secret key.")
+			}
+		}
+		if dmsgPort == 0 || dmsgPort > uint(^uint16(0)) {
+			log.WithField("dmsg_port", dmsgPort).Fatal("Invalid dmsg port.")
+		}
+		conf := dmsghttp.Config{
+			PK:       dmsgPK,
+			SK:       dmsgSK,
+			DiscAddr: dmsgDisc,
+			Port:     uint16(dmsgPort),
+		}
+		if err := conf.Check(); err != nil {
+			log.WithError(err).Fatal("Invalid dmsg config.")
+		}
+		go func() {
+			log := logging.MustGetLogger("dmsghttp")
+			if err := dmsghttp.ListenAndServe(context.Background(), log, conf, apiH); err != nil {
+				log.WithError(err).Fatal("Failed to serve HTTP over dmsg.")
+			}
+		}()
+	}
 
-	if err := http.ListenAndServe(addr, r); err != nil {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.Handle("/", apiH)
+	if fed != nil {
+		mux.Handle("/api/federation", fed)
+	}
+	if mir != nil {
+		mux.Handle("/api/mirror", mir)
+	}
+	log.WithField("addr", addr).
+		WithField("db_file", dbFile).
+		WithField("peers_store", peersStore).
+		WithField("probe", probeMode).
+		Info("Serving cx-tracker...")
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
 		log.WithError(err).Fatal("Failed to serve HTTP.")
 	}
 }
+
+// restoreDB replaces the database file with the backup file. The backup is
+// verified first.
+func restoreDB() error {
+	if restoreSHA256 != "" {
+		sum, err := store.BboltFileChecksum(restoreFile)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, restoreSHA256) {
+			return fmt.Errorf("checksum of backup file '%s' is %s (expected %s)", restoreFile, sum, restoreSHA256)
+		}
+	}
+
+	_, err := store.RestoreBboltFile(dbFile, restoreFile, true)
+	return err
+}
+
+// readToken reads a bearer token from a file.
+func readToken(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file '%s' is empty", filename)
+	}
+	return token, nil
+}
+
+// isFlagSet returns true if the flag of the given name was set on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
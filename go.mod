@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/go-chi/chi v4.1.2+incompatible
+	github.com/prometheus/client_golang v1.3.0
 	github.com/sirupsen/logrus v1.7.0
 	github.com/skycoin/cx-chains v0.24.2-0.20201210070414-7d7ad19dd487
 	github.com/skycoin/dmsg v0.0.0-20201130133816-e601063284fa
@@ -11,16 +11,32 @@ import (
 )
 
 // NewHTTPRouter creates a new HTTP router.
-func NewHTTPRouter(ss store.SpecStore, ps store.PeersStore) http.Handler {
+func NewHTTPRouter(ss store.SpecStore, ps store.PeersStore, opts ...Option) http.Handler {
 	log := logging.MustGetLogger("api")
 
+	o := defaultRouterOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	specDelGuard := newReplayGuard(SpecDeletionTolerance * 2)
+	peerLeaveGuard := newReplayGuard(PeerLeaveTolerance * 2)
+	leaves := newPeerLeaves(PeerLeaveTolerance * 2)
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(RealIPMiddleware(o.trustedProxies))
 	r.Use(middleware.Logger)
+	r.Use(MetricsMiddleware(o.metrics))
 	r.Use(middleware.Recoverer)
 	r.Use(SetLoggerMiddleware(log))
+	if o.readOnly {
+		r.Use(ReadOnlyMiddleware(o.upstream))
+	}
+
+	r.NotFound(httpNotFound)
+	r.MethodNotAllowed(httpMethodNotAllowed)
 
 	r.HandleFunc("/api/specs", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -29,11 +45,11 @@ func NewHTTPRouter(ss store.SpecStore, ps store.PeersStore) http.Handler {
 			return
 
 		case http.MethodPost:
-			postSpec(ss)(w, r)
+			postSpec(ss, o.metrics, o.limiter)(w, r)
 			return
 
 		default:
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			httpMethodNotAllowed(w, r)
 		}
 	})
 
@@ -43,27 +59,75 @@ func NewHTTPRouter(ss store.SpecStore, ps store.PeersStore) http.Handler {
 			getSpecOfGenesisHash(ss)(w, r)
 			return
 
+		case http.MethodPut:
+			reviseSpec(ss, o.metrics, o.limiter)(w, r)
+			return
+
 		case http.MethodDelete:
-			deleteSpec(ss)(w, r)
+			deleteSpec(ss, specDelGuard)(w, r)
+			return
+
+		default:
+			httpMethodNotAllowed(w, r)
+		}
+	})
+
+	r.HandleFunc("/api/specs/{hash}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getSpecRevisions(ss)(w, r)
 			return
 
 		default:
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			httpMethodNotAllowed(w, r)
 		}
 	})
 
-	r.HandleFunc("/api/peers", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/api/specs/{hash}/revisions/{rev}", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			getPeersOfChain(ps)(w, r)
+			getSpecRevision(ss)(w, r)
+			return
+
+		default:
+			httpMethodNotAllowed(w, r)
+		}
+	})
+
+	r.HandleFunc("/api/chains/by-pubkey/{pk}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getChainsOfPubKey(ss)(w, r)
+			return
+
+		default:
+			httpMethodNotAllowed(w, r)
+		}
+	})
+
+	r.HandleFunc("/api/chains/{hash}/stats", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getChainStats(ss, ps)(w, r)
+			return
+
+		default:
+			httpMethodNotAllowed(w, r)
+		}
+	})
+
+	r.With(FederationAuthMiddleware(o.fedToken)).HandleFunc("/api/peers", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getPeersOfChain(ps, o.peerStrategy)(w, r)
 			return
 
 		case http.MethodPost:
-			postPeers(ps)(w, r)
+			postPeers(ps, o.metrics, o.limiter, leaves)(w, r)
 			return
 
 		default:
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			httpMethodNotAllowed(w, r)
 		}
 	})
 
@@ -73,19 +137,60 @@ func NewHTTPRouter(ss store.SpecStore, ps store.PeersStore) http.Handler {
 			getPeer(ps)(w, r)
 			return
 
+		case http.MethodDelete:
+			deletePeer(ps, o.metrics, o.limiter, peerLeaveGuard, leaves)(w, r)
+			return
+
+		default:
+			httpMethodNotAllowed(w, r)
+		}
+	})
+
+	r.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getStats(ss, ps)(w, r)
+			return
+
 		default:
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			httpMethodNotAllowed(w, r)
 		}
 	})
 
+	if o.events != nil {
+		r.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				getEvents(o.events)(w, r)
+				return
+
+			default:
+				httpMethodNotAllowed(w, r)
+			}
+		})
+	}
+
+	if o.adminToken != "" && o.db != nil {
+		r.With(AdminAuthMiddleware(o.adminToken)).HandleFunc("/api/admin/backup", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				getBackup(o.db)(w, r)
+				return
+
+			default:
+				httpMethodNotAllowed(w, r)
+			}
+		})
+	}
+
 	r.HandleFunc("/peerlists/*", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			getPeerList(ps)(w, r)
+			getPeerList(ps, o.peerStrategy)(w, r)
 			return
 
 		default:
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			httpMethodNotAllowed(w, r)
 		}
 	})
 
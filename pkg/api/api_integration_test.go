@@ -1,20 +1,36 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg"
+	cipher2 "github.com/skycoin/dmsg/cipher"
 	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/skycoin/cx-tracker/pkg/events"
+	"github.com/skycoin/cx-tracker/pkg/metrics"
+	"github.com/skycoin/cx-tracker/pkg/policy"
+	"github.com/skycoin/cx-tracker/pkg/ratelimit"
 	"github.com/skycoin/cx-tracker/pkg/store"
 )
 
@@ -35,7 +51,7 @@ func TestNewHTTPRouter(t *testing.T) {
 	httpS := httptest.NewServer(NewHTTPRouter(ss, nil))
 	defer httpS.Close()
 
-	httpC := cxspec.NewCXTrackerClient(logrus.New(), httpS.Client(), httpS.URL)
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
 
 	// Test 'single_spec' tests registration and deletion of chain specs one at
 	// a time.
@@ -44,7 +60,7 @@ func TestNewHTTPRouter(t *testing.T) {
 		i := i
 
 		t.Run("single_spec", func(t *testing.T) {
-			spec, _ := randSpec(t, i)
+			spec, sk := randSpec(t, i)
 			block, err := spec.Spec.GenerateGenesisBlock()
 			require.NoError(t, err)
 
@@ -62,8 +78,20 @@ func TestNewHTTPRouter(t *testing.T) {
 			require.Len(t, allSpecs, 1)
 			require.Equal(t, spec.Sig, allSpecs[0].Sig)
 
+			// delete spec without signature or with wrong key should fail
+			require.Error(t, httpC.CXTrackerClient.DelSpec(context.TODO(), block.HashHeader()))
+			_, wrongSK := cipher.GenerateKeyPair()
+			require.Error(t, httpC.DelSpec(context.TODO(), block.HashHeader(), wrongSK))
+
 			// delete spec
-			require.NoError(t, httpC.DelSpec(context.TODO(), block.HashHeader()))
+			del, err := MakeSignedSpecDeletion(block.HashHeader(), sk)
+			require.NoError(t, err)
+			require.NoError(t, httpC.DelSpecSigned(context.TODO(), del))
+
+			// replayed deletion should fail
+			require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+			require.Error(t, httpC.DelSpecSigned(context.TODO(), del))
+			require.NoError(t, httpC.DelSpec(context.TODO(), block.HashHeader(), sk))
 
 			// get all specs
 			allSpecs, err = httpC.AllSpecs(context.TODO())
@@ -77,6 +105,1191 @@ func TestNewHTTPRouter(t *testing.T) {
 	// - Invalid spec registration (test security checks; e.g. duplicates).
 }
 
+func TestSpecRevisions(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestSpecRevisions_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, nil))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	spec, sk := randSpec(t, 0)
+	block, err := spec.Spec.GenerateGenesisBlock()
+	require.NoError(t, err)
+	hash := block.HashHeader()
+
+	require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+
+	// revise mutable fields
+	spec2 := spec.Spec
+	spec2.Node.DefaultConnections = []string{"127.0.0.1:6001", "127.0.0.1:6002"}
+	spec2.Protocol.CreateBlockBurnFactor = 20
+	signedSpec2, err := cxspec.MakeSignedChainSpec(spec2, sk)
+	require.NoError(t, err)
+
+	rev, err := httpC.ReviseSpec(context.TODO(), signedSpec2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), rev)
+
+	// identical revision should fail
+	_, err = httpC.ReviseSpec(context.TODO(), signedSpec2)
+	require.Error(t, err)
+
+	// replaying an earlier revision should fail, as it rolls the spec back
+	_, err = httpC.ReviseSpec(context.TODO(), spec)
+	var hErr *HTTPError
+	require.True(t, errors.As(err, &hErr), err)
+	require.Equal(t, http.StatusConflict, hErr.Code)
+
+	// revising immutable fields should fail
+	spec3 := spec.Spec
+	spec3.CoinHoursName = "other coin hours"
+	signedSpec3, err := cxspec.MakeSignedChainSpec(spec3, sk)
+	require.NoError(t, err)
+	_, err = httpC.ReviseSpec(context.TODO(), signedSpec3)
+	require.Error(t, err)
+
+	// latest revision is served by default
+	latest, err := httpC.SpecByGenesisHash(context.TODO(), hash)
+	require.NoError(t, err)
+	require.Equal(t, signedSpec2.Sig, latest.Sig)
+
+	// revision history
+	revs, err := httpC.SpecRevisions(context.TODO(), hash)
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	require.Equal(t, spec.Sig, revs[0].Sig)
+	require.Equal(t, signedSpec2.Sig, revs[1].Sig)
+
+	first, err := httpC.SpecRevision(context.TODO(), hash, 1)
+	require.NoError(t, err)
+	require.Equal(t, spec.Sig, first.Spec.Sig)
+
+	_, err = httpC.SpecRevision(context.TODO(), hash, 3)
+	require.Error(t, err)
+
+	// deletion removes revision history
+	require.NoError(t, httpC.DelSpec(context.TODO(), hash, sk))
+	_, err = httpC.SpecRevisions(context.TODO(), hash)
+	require.Error(t, err)
+}
+
+func TestQuerySpecs(t *testing.T) {
+	const n = 5
+
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestQuerySpecs_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, nil))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	sks := make([]cipher.SecKey, n)
+	for i := 0; i < n; i++ {
+		spec, sk := randSpec(t, i)
+		require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+		sks[i] = sk
+	}
+
+	t.Run("paginate", func(t *testing.T) {
+		var (
+			all   []cxspec.SignedChainSpec
+			pages int
+			q     = store.SpecQuery{Limit: 2, SortBy: store.SortByGenesisTimestamp, Desc: true}
+		)
+
+		for {
+			specs, next, err := httpC.QuerySpecs(context.TODO(), q)
+			require.NoError(t, err)
+			all = append(all, specs...)
+			pages++
+
+			if next == "" {
+				break
+			}
+			q.Cursor = next
+		}
+
+		require.Equal(t, 3, pages)
+		require.Len(t, all, n)
+		for i := 1; i < n; i++ {
+			require.GreaterOrEqual(t, all[i-1].Spec.GenesisTimestamp, all[i].Spec.GenesisTimestamp)
+		}
+
+		// The unpaginated response is unchanged.
+		allSpecs, err := httpC.AllSpecs(context.TODO())
+		require.NoError(t, err)
+		require.Len(t, allSpecs, n)
+	})
+
+	t.Run("filter_summary", func(t *testing.T) {
+		summaries, next, err := httpC.QuerySpecSummaries(context.TODO(), store.SpecQuery{CoinTicker: "coin3"})
+		require.NoError(t, err)
+		require.Empty(t, next)
+		require.Len(t, summaries, 1)
+		require.Equal(t, "COIN3", summaries[0].CoinTicker)
+		require.Equal(t, "coin3", summaries[0].CoinName)
+		require.Len(t, summaries[0].GenesisHash, 64)
+	})
+
+	t.Run("ticker", func(t *testing.T) {
+		var specs []cxspec.SignedChainSpec
+		require.NoError(t, httpC.do(context.TODO(), http.MethodGet, httpS.URL+"/api/specs?ticker=coin2", nil, &specs))
+		require.Len(t, specs, 1)
+		require.Equal(t, "COIN2", specs[0].Spec.CoinTicker)
+	})
+
+	t.Run("chains_of_pubkey", func(t *testing.T) {
+		pk, err := cipher.PubKeyFromSecKey(sks[1])
+		require.NoError(t, err)
+
+		summaries, err := httpC.ChainsOfPubKey(context.TODO(), pk)
+		require.NoError(t, err)
+		require.Len(t, summaries, 1)
+		require.Equal(t, pk.Hex(), summaries[0].ChainPubKey)
+
+		otherPK, _ := cipher.GenerateKeyPair()
+		summaries, err = httpC.ChainsOfPubKey(context.TODO(), otherPK)
+		require.NoError(t, err)
+		require.Empty(t, summaries)
+	})
+
+	t.Run("invalid_query", func(t *testing.T) {
+		for _, query := range []string{"limit=-1", "sort=coin_name", "cursor=zz", "fields=none"} {
+			err := httpC.do(context.TODO(), http.MethodGet, httpS.URL+"/api/specs?"+query, nil, nil)
+
+			var hErr *HTTPError
+			require.True(t, errors.As(err, &hErr), query)
+			require.Equal(t, http.StatusBadRequest, hErr.Code, query)
+			require.Equal(t, ReasonInvalidQuery, hErr.Reason, query)
+		}
+	})
+}
+
+func TestSpecAdmissionPolicy(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestSpecAdmissionPolicy_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	pol, err := policy.Config{UniqueTicker: true}.Policy()
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(NewHTTPRouter(policy.WrapSpecStore(ss, pol), nil))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	spec, _ := randSpec(t, 0)
+	require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+
+	// Another chain key cannot register the same ticker.
+	squatter, _ := randSpec(t, 0)
+	err = httpC.do(context.TODO(), http.MethodPost, httpS.URL+"/api/specs", squatter, nil)
+
+	var hErr *HTTPError
+	require.True(t, errors.As(err, &hErr))
+	require.Equal(t, http.StatusForbidden, hErr.Code)
+	require.Equal(t, policy.ReasonDuplicateTicker, hErr.Reason)
+
+	// The existing client obtains the rejection message.
+	err = httpC.PostSpec(context.TODO(), squatter)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), policy.ErrRejected.Error())
+}
+
+func TestHTTPErrors(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestHTTPErrors_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, nil))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+	hash := cipher.SumSHA256([]byte("unknown"))
+
+	t.Run("legacy_client_decodes_string", func(t *testing.T) {
+		_, err := httpC.CXTrackerClient.SpecByGenesisHash(context.TODO(), hash)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "404 Not Found")
+		require.Contains(t, err.Error(), store.ErrBboltObjectNotExist.Error())
+		require.NotContains(t, err.Error(), "failed to decode server response")
+	})
+
+	t.Run("client_decodes_envelope", func(t *testing.T) {
+		_, err := httpC.SpecRevision(context.TODO(), hash, 1)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, ErrorVersion, hErr.Version)
+		require.Equal(t, http.StatusNotFound, hErr.Code)
+		require.Equal(t, ReasonNotFound, hErr.Reason)
+		require.NotEmpty(t, hErr.Message)
+		require.NotEmpty(t, hErr.RequestID)
+	})
+
+	t.Run("invalid_hash", func(t *testing.T) {
+		err := httpC.do(context.TODO(), http.MethodGet, httpS.URL+"/api/specs/nothex/revisions", nil, nil)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusBadRequest, hErr.Code)
+		require.Equal(t, ReasonInvalidHash, hErr.Reason)
+	})
+
+	t.Run("method_not_allowed", func(t *testing.T) {
+		err := httpC.do(context.TODO(), http.MethodPatch, httpS.URL+"/api/specs", nil, nil)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusMethodNotAllowed, hErr.Code)
+		require.Equal(t, ReasonMethodNotAllowed, hErr.Reason)
+	})
+
+	t.Run("replayed_deletion", func(t *testing.T) {
+		spec, sk := randSpec(t, 0)
+		require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+
+		del, err := MakeSignedSpecDeletion(specGenesisHash(t, spec), sk)
+		require.NoError(t, err)
+		require.NoError(t, httpC.DelSpecSigned(context.TODO(), del))
+		require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+
+		err = httpC.DelSpecSigned(context.TODO(), del)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusUnauthorized, hErr.Code)
+		require.Equal(t, ReasonReplayed, hErr.Reason)
+	})
+
+	t.Run("read_only", func(t *testing.T) {
+		roS := httptest.NewServer(NewHTTPRouter(ss, nil, WithReadOnly("http://upstream:9091")))
+		defer roS.Close()
+
+		spec, _ := randSpec(t, 0)
+		err := httpC.do(context.TODO(), http.MethodPost, roS.URL+"/api/specs", spec, nil)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusForbidden, hErr.Code)
+		require.Equal(t, ReasonReadOnly, hErr.Reason)
+		require.Contains(t, hErr.Message, "http://upstream:9091")
+
+		_, err = NewClient(logrus.New(), roS.Client(), roS.URL).AllSpecs(context.TODO())
+		require.NoError(t, err)
+	})
+}
+
+func TestRateLimits(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestRateLimits_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+	ps := store.NewMemoryPeersStore(time.Minute, 10)
+
+	limiter := ratelimit.New(ratelimit.Config{
+		PeerPK:  ratelimit.Limit{Events: 1, Per: time.Minute},
+		ChainPK: ratelimit.Limit{Events: 1, Per: time.Hour},
+	})
+	httpS := httptest.NewServer(NewHTTPRouter(ss, ps, WithRateLimiter(limiter)))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	requireRateLimited := func(t *testing.T, err error) {
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr), err)
+		require.Equal(t, http.StatusTooManyRequests, hErr.Code)
+		require.Equal(t, ReasonRateLimited, hErr.Reason)
+	}
+
+	t.Run("peer_pk", func(t *testing.T) {
+		pk, sk := cipher2.GenerateKeyPair()
+		entry := cxspec.PeerEntry{
+			PublicKey: pk,
+			LastSeen:  time.Now().Unix(),
+			CXChains: map[string]cxspec.CXChainAddresses{
+				cipher.SumSHA256([]byte("chain")).Hex(): {TCPAddr: "127.0.0.1:6001"},
+			},
+		}
+
+		// Entries which fail verification do not count against the limit of
+		// the public key.
+		forged, err := cxspec.MakeSignedPeerEntry(entry, sk)
+		require.NoError(t, err)
+		forged.Entry.LastSeen++
+		resp := postJSON(t, httpS, "/api/peers", forged)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		signed, err := cxspec.MakeSignedPeerEntry(entry, sk)
+		require.NoError(t, err)
+		require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), signed))
+
+		entry.LastSeen++
+		signed, err = cxspec.MakeSignedPeerEntry(entry, sk)
+		require.NoError(t, err)
+		resp = postJSON(t, httpS, "/api/peers", signed)
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		require.Equal(t, "60", resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("chain_pk", func(t *testing.T) {
+		spec, sk := randSpec(t, 0)
+		require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+
+		spec.Spec.Node.DefaultConnections = []string{"127.0.0.1:6001"}
+		revised, err := cxspec.MakeSignedChainSpec(spec.Spec, sk)
+		require.NoError(t, err)
+		_, err = httpC.ReviseSpec(context.TODO(), revised)
+		requireRateLimited(t, err)
+	})
+
+	t.Run("ip", func(t *testing.T) {
+		ipS := httptest.NewServer(NewHTTPRouter(ss, ps, WithRateLimiter(ratelimit.New(ratelimit.Config{
+			IP: ratelimit.Limit{Events: 1, Per: time.Minute},
+		}))))
+		defer ipS.Close()
+
+		ipC := NewClient(logrus.New(), ipS.Client(), ipS.URL)
+
+		// The IP limit is shared by all posts of the client.
+		spec, _ := randSpec(t, 1)
+		require.NoError(t, ipC.PostSpec(context.TODO(), spec))
+		err := ipC.UpdatePeerEntry(context.TODO(), randPeerEntry(t, specGenesisHash(t, spec)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "429 Too Many Requests")
+	})
+
+	// postPeerFrom posts a random peer entry with the client IP header 'xff'.
+	postPeerFrom := func(t *testing.T, srv *httptest.Server, xff string) int {
+		b, err := json.Marshal(randPeerEntry(t, cipher.SumSHA256([]byte("chain"))))
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/peers", bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", xff)
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	ipLimit := ratelimit.Config{IP: ratelimit.Limit{Events: 1, Per: time.Minute}}
+
+	t.Run("spoofed_ip", func(t *testing.T) {
+		ipS := httptest.NewServer(NewHTTPRouter(ss, ps, WithRateLimiter(ratelimit.New(ipLimit))))
+		defer ipS.Close()
+
+		// Client IP headers are ignored unless set by a trusted proxy.
+		require.Equal(t, http.StatusOK, postPeerFrom(t, ipS, "10.0.0.1"))
+		require.Equal(t, http.StatusTooManyRequests, postPeerFrom(t, ipS, "10.0.0.2"))
+	})
+
+	t.Run("trusted_proxy", func(t *testing.T) {
+		ipS := httptest.NewServer(NewHTTPRouter(ss, ps, WithRateLimiter(ratelimit.New(ipLimit)),
+			WithTrustedProxies([]string{"127.0.0.1"})))
+		defer ipS.Close()
+
+		// Clients are told apart by the IP which the proxy appended.
+		require.Equal(t, http.StatusOK, postPeerFrom(t, ipS, "10.0.0.1"))
+		require.Equal(t, http.StatusOK, postPeerFrom(t, ipS, "10.0.0.1, 10.0.0.2"))
+		require.Equal(t, http.StatusTooManyRequests, postPeerFrom(t, ipS, "10.0.0.2"))
+	})
+
+	t.Run("federated", func(t *testing.T) {
+		const token = "federation-token"
+
+		ipS := httptest.NewServer(NewHTTPRouter(ss, ps, WithRateLimiter(ratelimit.New(ipLimit)),
+			WithFederationToken(token)))
+		defer ipS.Close()
+
+		ipC := NewClient(logrus.New(), ipS.Client(), ipS.URL)
+		chain := cipher.SumSHA256([]byte("chain"))
+
+		// Federated trackers are not limited by IP, unlike other clients.
+		for i := 0; i < 3; i++ {
+			require.NoError(t, ipC.RelayPeerEntry(context.TODO(), token, randPeerEntry(t, chain), []string{"a"}))
+		}
+		require.NoError(t, ipC.RelayPeerEntry(context.TODO(), "", randPeerEntry(t, chain), []string{"a"}))
+		err := ipC.RelayPeerEntry(context.TODO(), "", randPeerEntry(t, chain), []string{"a"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "429 Too Many Requests")
+	})
+}
+
+func TestPeerLeave(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestPeerLeave_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+	ps := store.NewMemoryPeersStore(time.Minute, 10)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, ps))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	chainA := cipher2.SumSHA256([]byte("chain_a"))
+	chainB := cipher2.SumSHA256([]byte("chain_b"))
+
+	pk, sk := cipher2.GenerateKeyPair()
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix() - 1,
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chainA[:]): {TCPAddr: "127.0.0.1:6001"},
+			hex.EncodeToString(chainB[:]): {TCPAddr: "127.0.0.1:6002"},
+		},
+	}
+	signed, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), signed))
+
+	requirePeers := func(t *testing.T, chain cipher2.SHA256, n int) {
+		peers, err := ps.PeersOfChain(context.TODO(), chain)
+		require.NoError(t, err)
+		require.Len(t, peers, n)
+	}
+
+	requireHTTPError := func(t *testing.T, err error, code int, reason string) {
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr), err)
+		require.Equal(t, code, hErr.Code)
+		require.Equal(t, reason, hErr.Reason)
+	}
+
+	t.Run("wrong_key", func(t *testing.T) {
+		_, wrongSK := cipher2.GenerateKeyPair()
+		leave, err := MakeSignedPeerLeave(wrongSK, nil)
+		require.NoError(t, err)
+		leave.Leave.PublicKey = pk
+
+		requireHTTPError(t, httpC.LeavePeerSigned(context.TODO(), leave), http.StatusUnauthorized, ReasonVerify)
+		requirePeers(t, chainA, 1)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		leave := SignedPeerLeave{Leave: PeerLeave{
+			PublicKey: pk,
+			Timestamp: time.Now().Add(-2 * PeerLeaveTolerance).Unix(),
+		}}
+		leave.Sig, err = cipher2.SignPayload(leave.Leave.payload(), sk)
+		require.NoError(t, err)
+
+		requireHTTPError(t, httpC.LeavePeerSigned(context.TODO(), leave), http.StatusUnauthorized, ReasonVerify)
+	})
+
+	t.Run("leave_chain", func(t *testing.T) {
+		leave, err := MakeSignedPeerLeave(sk, []cipher2.SHA256{chainA})
+		require.NoError(t, err)
+		require.NoError(t, httpC.LeavePeerSigned(context.TODO(), leave))
+
+		requirePeers(t, chainA, 0)
+		requirePeers(t, chainB, 1)
+
+		// The entry is kept as signed by the peer, while only the remaining
+		// chain is listed as served.
+		peer, err := httpC.Peer(context.TODO(), pk)
+		require.NoError(t, err)
+		require.Equal(t, signed, peer.SignedPeerEntry)
+		require.Equal(t, []string{hex.EncodeToString(chainB[:])}, peer.Chains)
+
+		// Leaves can only be submitted once.
+		requireHTTPError(t, httpC.LeavePeerSigned(context.TODO(), leave), http.StatusUnauthorized, ReasonReplayed)
+	})
+
+	t.Run("leave_all", func(t *testing.T) {
+		require.NoError(t, httpC.LeavePeer(context.TODO(), sk, nil))
+
+		requirePeers(t, chainB, 0)
+		_, err := httpC.PeerEntryOfPK(context.TODO(), cipher.PubKey(pk))
+		require.Error(t, err)
+
+		// Entries signed before the leave cannot be replayed.
+		resp := postJSON(t, httpS, "/api/peers", signed)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		requirePeers(t, chainA, 0)
+
+		// Entries signed after the leave announce the peer again.
+		entry.LastSeen = time.Now().Unix() + 1
+		signed, err := cxspec.MakeSignedPeerEntry(entry, sk)
+		require.NoError(t, err)
+		require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), signed))
+		requirePeers(t, chainA, 1)
+	})
+
+	t.Run("unknown_peer", func(t *testing.T) {
+		_, sk := cipher2.GenerateKeyPair()
+		requireHTTPError(t, httpC.LeavePeer(context.TODO(), sk, nil), http.StatusNotFound, ReasonNotFound)
+	})
+
+	t.Run("invalid_pubkey", func(t *testing.T) {
+		err := httpC.do(context.TODO(), http.MethodDelete, httpS.URL+"/api/peers/nothex", SignedPeerLeave{}, nil)
+		requireHTTPError(t, err, http.StatusBadRequest, ReasonInvalidPubKey)
+	})
+}
+
+// relayPathStore records the relay path of the last updated entry.
+type relayPathStore struct {
+	store.PeersStore
+	path []string
+}
+
+func (s *relayPathStore) UpdateEntry(ctx context.Context, entry cxspec.SignedPeerEntry) error {
+	s.path = RelayPathFromContext(ctx)
+	return s.PeersStore.UpdateEntry(ctx, entry)
+}
+
+func TestRelayAuth(t *testing.T) {
+	const token = "federation-token"
+
+	ps := &relayPathStore{PeersStore: store.NewMemoryPeersStore(time.Minute, 10)}
+
+	httpS := httptest.NewServer(NewHTTPRouter(nil, ps, WithFederationToken(token)))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	makeEntry := func(t *testing.T) cxspec.SignedPeerEntry {
+		pk, sk := cipher2.GenerateKeyPair()
+		chain := cipher2.SumSHA256(pk[:])
+		entry, err := cxspec.MakeSignedPeerEntry(cxspec.PeerEntry{
+			PublicKey: pk,
+			LastSeen:  time.Now().Unix(),
+			CXChains:  map[string]cxspec.CXChainAddresses{hex.EncodeToString(chain[:]): {TCPAddr: "127.0.0.1:6001"}},
+		}, sk)
+		require.NoError(t, err)
+		return entry
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		require.NoError(t, httpC.RelayPeerEntry(context.TODO(), token, makeEntry(t), []string{"a", "b"}))
+		require.Equal(t, []string{"a", "b"}, ps.path)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		// The relay path of clients is ignored, while the entry is stored.
+		entry := makeEntry(t)
+		require.NoError(t, httpC.RelayPeerEntry(context.TODO(), "", entry, []string{"a", "b"}))
+		require.Empty(t, ps.path)
+
+		_, err := ps.Entry(context.TODO(), entry.Entry.PublicKey)
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid_token", func(t *testing.T) {
+		err := httpC.RelayPeerEntry(context.TODO(), "wrong", makeEntry(t), []string{"a"})
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusUnauthorized, hErr.Code)
+		require.Equal(t, ReasonUnauthorized, hErr.Reason)
+	})
+}
+
+func TestPeerStatus(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestPeerStatus_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+	ps := store.NewMemoryPeersStore(time.Minute, 10)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, ps))
+	defer httpS.Close()
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	chain := cipher2.SumSHA256([]byte("chain"))
+	chainStr := hex.EncodeToString(chain[:])
+
+	// makePeer generates a peer which reports 'height' (no status if 0).
+	makePeer := func(t *testing.T, tcpAddr string, height uint64) (Peer, cipher2.SecKey) {
+		pk, sk := cipher2.GenerateKeyPair()
+		entry, err := cxspec.MakeSignedPeerEntry(cxspec.PeerEntry{
+			PublicKey: pk,
+			LastSeen:  time.Now().Unix(),
+			CXChains:  map[string]cxspec.CXChainAddresses{chainStr: {TCPAddr: tcpAddr}},
+		}, sk)
+		require.NoError(t, err)
+
+		peer := Peer{SignedPeerEntry: entry, Chains: []string{chainStr}}
+		if height > 0 {
+			status, err := store.MakeSignedPeerStatus(store.PeerStatus{
+				PublicKey: pk,
+				LastSeen:  entry.Entry.LastSeen,
+				Version:   "v0.1.0",
+				Chains:    map[string]store.ChainStatus{chainStr: {Height: height, HeadHash: chainStr}},
+			}, sk)
+			require.NoError(t, err)
+			peer.Status = &status
+		}
+		return peer, sk
+	}
+
+	peer1, _ := makePeer(t, "127.0.0.1:6001", 100)
+	peer2, _ := makePeer(t, "127.0.0.1:6002", 200)
+	peer3, _ := makePeer(t, "127.0.0.1:6003", 0)
+	require.NoError(t, httpC.UpdatePeer(context.TODO(), peer1))
+	require.NoError(t, httpC.UpdatePeer(context.TODO(), peer2))
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), peer3.SignedPeerEntry))
+
+	t.Run("get_peer", func(t *testing.T) {
+		peer, err := httpC.Peer(context.TODO(), peer2.Entry.PublicKey)
+		require.NoError(t, err)
+		require.Equal(t, peer2, peer)
+
+		peer, err = httpC.Peer(context.TODO(), peer3.Entry.PublicKey)
+		require.NoError(t, err)
+		require.Nil(t, peer.Status)
+
+		// Legacy clients obtain the entry.
+		entry, err := httpC.PeerEntryOfPK(context.TODO(), cipher.PubKey(peer2.Entry.PublicKey))
+		require.NoError(t, err)
+		require.Equal(t, peer2.SignedPeerEntry, entry)
+	})
+
+	t.Run("min_height", func(t *testing.T) {
+		for minHeight, exp := range map[uint64]int{0: 3, 100: 2, 150: 1, 201: 0} {
+			addrs, err := httpC.QueryPeersOfChain(context.TODO(), cipher.SHA256(chain), store.PeerQuery{MinHeight: minHeight})
+			require.NoError(t, err)
+			require.Len(t, addrs, exp, "min_height %d", minHeight)
+		}
+
+		resp, err := httpS.Client().Get(fmt.Sprintf("%s/peerlists/%s.txt?min_height=150", httpS.URL, chainStr))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "127.0.0.1:6002\n", string(body))
+
+		resp2, err := httpS.Client().Get(fmt.Sprintf("%s/api/peers?chain=%s&min_height=-1", httpS.URL, chainStr))
+		require.NoError(t, err)
+		require.NoError(t, resp2.Body.Close())
+		require.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+	})
+
+	t.Run("strategy", func(t *testing.T) {
+		q := store.PeerQuery{Max: 1, Strategy: store.StrategyHighest}
+		addrs, err := httpC.QueryPeersOfChain(context.TODO(), cipher.SHA256(chain), q)
+		require.NoError(t, err)
+		require.Equal(t, []cxspec.CXChainAddresses{{TCPAddr: "127.0.0.1:6002"}}, addrs)
+
+		resp, err := httpS.Client().Get(fmt.Sprintf("%s/api/peers?chain=%s&strategy=newest", httpS.URL, chainStr))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		// Nothing is known to be reachable, as peers are not probed.
+		q.Strategy = store.StrategyReachable
+		_, err = httpC.QueryPeersOfChain(context.TODO(), cipher.SHA256(chain), q)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusBadRequest, hErr.Code)
+		require.Equal(t, ReasonNotProbed, hErr.Reason)
+
+		// The default strategy is used if the query does not specify one.
+		httpS2 := httptest.NewServer(NewHTTPRouter(ss, ps, WithPeerStrategy(store.StrategyHighest)))
+		defer httpS2.Close()
+
+		resp, err = httpS2.Client().Get(fmt.Sprintf("%s/peerlists/%s.txt?max=1", httpS2.URL, chainStr))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "127.0.0.1:6002\n", string(body))
+	})
+
+	t.Run("best_height", func(t *testing.T) {
+		cs, err := httpC.ChainStats(context.TODO(), cipher.SHA256(chain))
+		require.NoError(t, err)
+		require.Equal(t, uint64(200), cs.BestHeight)
+	})
+
+	t.Run("invalid_status", func(t *testing.T) {
+		peer, sk := makePeer(t, "127.0.0.1:6004", 300)
+		peer.Status.Status.Version = "forged"
+		resp := postJSON(t, httpS, "/api/peers", peer)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		// Statuses should extend the posted entry.
+		peer, _ = makePeer(t, "127.0.0.1:6004", 300)
+		status := *peer.Status
+		status.Status.LastSeen--
+		status, err := store.MakeSignedPeerStatus(status.Status, sk)
+		require.NoError(t, err)
+		peer.Status = &status
+		resp = postJSON(t, httpS, "/api/peers", peer)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		_, err = ps.Entry(context.TODO(), peer.Entry.PublicKey)
+		require.Error(t, err)
+	})
+}
+
+func TestBackup(t *testing.T) {
+	const token = "admin-token"
+
+	dir, err := ioutil.TempDir("", "TestBackup")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, os.RemoveAll(dir)) })
+
+	db, err := store.OpenBboltDB(filepath.Join(dir, "tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, db.Close()) })
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, nil, WithAdmin(token, db)))
+	t.Cleanup(httpS.Close)
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+	spec, _ := randSpec(t, 0)
+	require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+
+	t.Run("unauthorized", func(t *testing.T) {
+		for _, tok := range []string{"", "wrong"} {
+			_, err := httpC.Backup(context.TODO(), tok, ioutil.Discard)
+
+			var hErr *HTTPError
+			require.True(t, errors.As(err, &hErr))
+			require.Equal(t, http.StatusUnauthorized, hErr.Code)
+			require.Equal(t, ReasonUnauthorized, hErr.Reason)
+		}
+	})
+
+	t.Run("missing_scheme", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, httpS.URL+"/api/admin/backup", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", token)
+
+		resp, err := httpS.Client().Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		noAdminS := httptest.NewServer(NewHTTPRouter(ss, nil))
+		defer noAdminS.Close()
+
+		_, err := NewClient(logrus.New(), noAdminS.Client(), noAdminS.URL).Backup(context.TODO(), token, ioutil.Discard)
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusNotFound, hErr.Code)
+	})
+
+	t.Run("backup_and_restore", func(t *testing.T) {
+		backupFile := filepath.Join(dir, "backup.db")
+		f, err := os.Create(backupFile)
+		require.NoError(t, err)
+		info, err := httpC.Backup(context.TODO(), token, f)
+		require.NoError(t, f.Close())
+		require.NoError(t, err)
+
+		sum, err := store.BboltFileChecksum(backupFile)
+		require.NoError(t, err)
+		require.Equal(t, info.Checksum, sum)
+
+		restoredFile := filepath.Join(dir, "restored.db")
+		report, err := store.RestoreBboltFile(restoredFile, backupFile, false)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Specs)
+
+		restoredDB, err := store.OpenBboltDB(restoredFile)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, restoredDB.Close()) }()
+
+		restoredSS, err := store.NewBboltSpecStore(restoredDB)
+		require.NoError(t, err)
+		got, err := restoredSS.ChainSpec(context.TODO(), specGenesisHash(t, spec))
+		require.NoError(t, err)
+		require.Equal(t, spec.Sig, got.Sig)
+	})
+}
+
+func TestStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStats")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, os.RemoveAll(dir)) })
+
+	db, err := store.OpenBboltDB(filepath.Join(dir, "tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, db.Close()) })
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+	ps, err := store.NewBboltPeersStore(db, time.Minute)
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(NewHTTPRouter(ss, ps))
+	t.Cleanup(httpS.Close)
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	stats, err := httpC.Stats(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, Stats{ChainPeers: map[string]int{}}, stats)
+
+	hashes := make([]cipher.SHA256, 3)
+	for i := range hashes {
+		spec, _ := randSpec(t, i)
+		require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+		hashes[i] = specGenesisHash(t, spec)
+	}
+
+	// Peers of randPeerEntry announce the same chain addresses.
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), randPeerEntry(t, hashes[0])))
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), randPeerEntry(t, hashes[0])))
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), randDmsgPeerEntry(t, hashes[0])))
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), randPeerEntry(t, hashes[1])))
+
+	// Peers may announce chains which are not registered.
+	unregistered := cipher.SumSHA256([]byte("unregistered"))
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), randPeerEntry(t, unregistered)))
+
+	stats, err = httpC.Stats(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stats.Specs)
+	require.Equal(t, 3, stats.Chains)
+	require.Equal(t, 5, stats.PeerEntries)
+	require.Equal(t, 4, stats.PeerAddresses)
+	require.Equal(t, 1, stats.DmsgOnly)
+	require.Equal(t, 3, stats.TCP)
+	require.Equal(t, 0.25, stats.DmsgOnlyRatio)
+	require.InDelta(t, 0.5, stats.AnnounceRate, 1e-9)
+	require.NotZero(t, stats.LastSeen)
+	require.Equal(t, map[string]int{hashes[0].Hex(): 2, hashes[1].Hex(): 1, unregistered.Hex(): 1}, stats.ChainPeers)
+
+	t.Run("chain", func(t *testing.T) {
+		cs, err := httpC.ChainStats(context.TODO(), hashes[0])
+		require.NoError(t, err)
+		require.Equal(t, hashes[0].Hex(), cs.Chain)
+		require.True(t, cs.Registered)
+		require.Equal(t, 2, cs.Peers)
+		require.Equal(t, 1, cs.DmsgOnly)
+		require.Equal(t, 1, cs.TCP)
+		require.Equal(t, 0.5, cs.DmsgOnlyRatio)
+		require.InDelta(t, 0.3, cs.AnnounceRate, 1e-9)
+		require.Equal(t, stats.LastSeen, cs.LastSeen)
+	})
+
+	t.Run("chain_without_peers", func(t *testing.T) {
+		cs, err := httpC.ChainStats(context.TODO(), hashes[2])
+		require.NoError(t, err)
+		require.True(t, cs.Registered)
+		require.Zero(t, cs.Peers)
+	})
+
+	t.Run("unregistered_chain", func(t *testing.T) {
+		cs, err := httpC.ChainStats(context.TODO(), unregistered)
+		require.NoError(t, err)
+		require.False(t, cs.Registered)
+		require.Equal(t, 1, cs.Peers)
+	})
+
+	t.Run("unknown_chain", func(t *testing.T) {
+		_, err := httpC.ChainStats(context.TODO(), cipher.SumSHA256([]byte("unknown")))
+
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, http.StatusNotFound, hErr.Code)
+		require.Equal(t, ReasonNotFound, hErr.Reason)
+	})
+
+	t.Run("invalid_hash", func(t *testing.T) {
+		resp, err := http.Get(httpS.URL + "/api/chains/invalid/stats")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMetrics")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, os.RemoveAll(dir)) })
+
+	db, err := store.OpenBboltDB(filepath.Join(dir, "tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, db.Close()) })
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+	ps := store.NewMemoryPeersStore(time.Minute, 0)
+
+	m := metrics.New("cx_tracker")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics.NewStoreCollector("cx_tracker", ss, ps))
+	reg.MustRegister(m.Collectors()...)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.Handle("/", NewHTTPRouter(ss, ps, WithMetrics(m)))
+	httpS := httptest.NewServer(mux)
+	t.Cleanup(httpS.Close)
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	hashes := make([]cipher.SHA256, 2)
+	for i := range hashes {
+		spec, _ := randSpec(t, i)
+		require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+		hashes[i] = specGenesisHash(t, spec)
+	}
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), randPeerEntry(t, hashes[0])))
+
+	_, err = httpC.SpecByGenesisHash(context.TODO(), hashes[0])
+	require.NoError(t, err)
+
+	resp, err := httpS.Client().Post(httpS.URL+"/api/specs", "application/json", strings.NewReader("{"))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	m.ObserveGC(time.Millisecond, 3)
+
+	resp, err = httpS.Client().Get(httpS.URL + "/metrics")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, resp.Body.Close()) }()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, series := range []string{
+		`cx_tracker_specs 2`,
+		`cx_tracker_peer_entries 1`,
+		`cx_tracker_chain_aggregates 1`,
+		fmt.Sprintf(`cx_tracker_chain_peers{chain="%s"} 1`, hashes[0].Hex()),
+		fmt.Sprintf(`cx_tracker_chain_peers{chain="%s"} 0`, hashes[1].Hex()),
+		`cx_tracker_http_requests_total{code="200",method="POST",route="/api/specs"} 2`,
+		`cx_tracker_http_requests_total{code="400",method="POST",route="/api/specs"} 1`,
+		`cx_tracker_http_requests_total{code="200",method="GET",route="/api/specs/*"} 1`,
+		`cx_tracker_rejected_posts_total{kind="spec",reason="decode_failed"} 1`,
+		`cx_tracker_peers_gc_evictions_total 3`,
+		`cx_tracker_peers_gc_duration_seconds_count 1`,
+	} {
+		require.Contains(t, string(body), series+"\n")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestEvents_%d.db", time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	bus := events.NewBus(events.DefaultHistory)
+	evSS := events.WrapSpecStore(ss, bus)
+	evPS := events.WrapPeersStore(store.NewMemoryPeersStore(time.Minute, 10), bus)
+
+	// Event streams are closed on cleanup, which is before the server closes.
+	httpS := httptest.NewServer(NewHTTPRouter(evSS, evPS, WithEvents(bus)))
+	t.Cleanup(httpS.Close)
+
+	httpC := NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	spec, sk := randSpec(t, 0)
+	hash := specGenesisHash(t, spec)
+
+	stream := openEventStream(t, httpS.URL+"/api/events?chain="+hash.Hex(), "")
+
+	require.NoError(t, httpC.PostSpec(context.TODO(), spec))
+	added := stream.next(t)
+	require.Equal(t, events.TypeSpecAdded, added.Type)
+	require.Equal(t, hash.Hex(), added.Chain)
+
+	entry := randPeerEntry(t, hash)
+	require.NoError(t, httpC.UpdatePeerEntry(context.TODO(), entry))
+	updated := stream.next(t)
+	require.Equal(t, events.TypePeerUpdated, updated.Type)
+	require.Equal(t, hash.Hex(), updated.Chain)
+
+	require.NoError(t, httpC.DelSpec(context.TODO(), hash, sk))
+	deleted := stream.next(t)
+	require.Equal(t, events.TypeSpecDeleted, deleted.Type)
+
+	t.Run("resume", func(t *testing.T) {
+		stream := openEventStream(t, httpS.URL+"/api/events?type=spec_deleted", added.ID)
+		require.Equal(t, deleted, stream.next(t))
+	})
+
+	t.Run("resume_query", func(t *testing.T) {
+		stream := openEventStream(t, httpS.URL+"/api/events?type=peer_updated&last_event_id="+added.ID, "")
+		require.Equal(t, updated, stream.next(t))
+	})
+
+	t.Run("client", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, err := httpC.Events(ctx, events.Filter{Types: []events.Type{events.TypeSpecDeleted}}, added.ID)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, stream.Close()) }()
+
+		e, err := stream.Next()
+		require.NoError(t, err)
+		e.Data = nil
+		require.Equal(t, deleted, e)
+		require.Equal(t, deleted.ID, stream.LastEventID())
+
+		_, err = httpC.Events(ctx, events.Filter{}, "previous-1")
+		var hErr *HTTPError
+		require.True(t, errors.As(err, &hErr))
+		require.Equal(t, ReasonResumeExpired, hErr.Reason)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			query  string
+			code   int
+			reason string
+		}{
+			{"chain=invalid", http.StatusBadRequest, ReasonInvalidHash},
+			{"type=invalid", http.StatusBadRequest, ReasonInvalidQuery},
+			{"last_event_id=invalid", http.StatusBadRequest, ReasonInvalidQuery},
+			{"last_event_id=previous-1", http.StatusGone, ReasonResumeExpired},
+		}
+
+		for _, tc := range cases {
+			err := httpC.do(context.TODO(), http.MethodGet, httpS.URL+"/api/events?"+tc.query, nil, nil)
+
+			var hErr *HTTPError
+			require.True(t, errors.As(err, &hErr), tc.query)
+			require.Equal(t, tc.code, hErr.Code, tc.query)
+			require.Equal(t, tc.reason, hErr.Reason, tc.query)
+		}
+	})
+}
+
+// eventStream reads events of a Server-Sent Events response.
+type eventStream struct {
+	r *bufio.Reader
+}
+
+func openEventStream(t *testing.T, addr, lastEventID string) *eventStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set(LastEventIDHeader, lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, resp.Body.Close()) })
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return &eventStream{r: bufio.NewReader(resp.Body)}
+}
+
+// next reads the next event, ignoring comments.
+func (s *eventStream) next(t *testing.T) events.Event {
+	var id, typ string
+	var e events.Event
+
+	for {
+		line, err := s.r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && id != "":
+			require.Equal(t, id, e.ID)
+			require.Equal(t, typ, string(e.Type))
+			e.Data = nil // compared by type, chain and id
+			return e
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+		}
+	}
+}
+
+func specGenesisHash(t *testing.T, spec cxspec.SignedChainSpec) cipher.SHA256 {
+	block, err := spec.Spec.GenerateGenesisBlock()
+	require.NoError(t, err)
+	return block.HashHeader()
+}
+
 // randSpec generates a new spec of coin name 'coin%d' and ticker name 'COIN%d'
 // given the int 'i'.
 // A signed chain spec is returned alongside it's chain secret key.
@@ -95,3 +1308,53 @@ func randSpec(t *testing.T, i int) (cxspec.SignedChainSpec, cipher.SecKey) {
 
 	return signedSpec, sk
 }
+
+// randPeerEntry generates a signed peer entry of a random public key which
+// hosts the chain of given genesis hash.
+func randPeerEntry(t *testing.T, chain cipher.SHA256) cxspec.SignedPeerEntry {
+	pk, sk := cipher2.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain[:]): {TCPAddr: "127.0.0.1:6001"},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry
+}
+
+// postJSON posts 'v' to 'path' of 'httpS' and returns the closed response.
+func postJSON(t *testing.T, httpS *httptest.Server, path string, v interface{}) *http.Response {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	resp, err := httpS.Client().Post(httpS.URL+path, "application/json", bytes.NewReader(b))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	return resp
+}
+
+// randDmsgPeerEntry generates a signed peer entry of a random public key which
+// hosts the chain of given genesis hash on dmsg only.
+func randDmsgPeerEntry(t *testing.T, chain cipher.SHA256) cxspec.SignedPeerEntry {
+	pk, sk := cipher2.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain[:]): {DmsgAddr: dmsg.Addr{PK: pk, Port: 9090}},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry
+}
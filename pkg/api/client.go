@@ -0,0 +1,495 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/events"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// Client is a cx-tracker HTTP client.
+// It extends cxspec.CXTrackerClient with the endpoints that are specific to
+// this implementation of cx-tracker.
+type Client struct {
+	*cxspec.CXTrackerClient
+
+	log  logrus.FieldLogger
+	c    *http.Client
+	addr string
+}
+
+// NewClient creates a new Client.
+func NewClient(log logrus.FieldLogger, c *http.Client, addr string) *Client {
+	if log == nil {
+		l := logrus.New()
+		l.Level = logrus.FatalLevel
+		log = l
+	}
+	if c == nil {
+		c = http.DefaultClient
+	}
+	addr = strings.TrimSuffix(addr, "/")
+
+	return &Client{
+		CXTrackerClient: cxspec.NewCXTrackerClient(log, c, addr),
+		log:             log,
+		c:               c,
+		addr:            addr,
+	}
+}
+
+// DelSpec deletes the chain spec of the given genesis hash.
+// The deletion request is signed with the chain secret key 'sk'.
+func (c *Client) DelSpec(ctx context.Context, hash cipher.SHA256, sk cipher.SecKey) error {
+	del, err := MakeSignedSpecDeletion(hash, sk)
+	if err != nil {
+		return err
+	}
+
+	return c.DelSpecSigned(ctx, del)
+}
+
+// DelSpecSigned deletes a chain spec with a pre-signed deletion request.
+func (c *Client) DelSpecSigned(ctx context.Context, del SignedSpecDeletion) error {
+	addr := fmt.Sprintf("%s/api/specs/%s", c.addr, del.Deletion.GenesisHash)
+	return c.do(ctx, http.MethodDelete, addr, del, nil)
+}
+
+// ReviseSpec posts a new revision of an existing chain spec.
+// The resultant revision number is returned.
+func (c *Client) ReviseSpec(ctx context.Context, spec cxspec.SignedChainSpec) (uint64, error) {
+	if err := spec.Verify(); err != nil {
+		return 0, err
+	}
+
+	genBlock, err := spec.Spec.GenerateGenesisBlock()
+	if err != nil {
+		return 0, err
+	}
+
+	var out SpecRevisionSummary
+	addr := fmt.Sprintf("%s/api/specs/%s", c.addr, genBlock.HashHeader().Hex())
+	if err := c.do(ctx, http.MethodPut, addr, spec, &out); err != nil {
+		return 0, err
+	}
+
+	return out.Revision, nil
+}
+
+// SpecRevisions obtains the revision history of the chain spec of the given
+// genesis hash.
+func (c *Client) SpecRevisions(ctx context.Context, hash cipher.SHA256) ([]SpecRevisionSummary, error) {
+	var out []SpecRevisionSummary
+	addr := fmt.Sprintf("%s/api/specs/%s/revisions", c.addr, hash.Hex())
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// SpecRevision obtains a specific revision of the chain spec of the given
+// genesis hash.
+func (c *Client) SpecRevision(ctx context.Context, hash cipher.SHA256, rev uint64) (store.SpecRevision, error) {
+	var out store.SpecRevision
+	addr := fmt.Sprintf("%s/api/specs/%s/revisions/%d", c.addr, hash.Hex(), rev)
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return store.SpecRevision{}, err
+	}
+
+	if err := out.Spec.Verify(); err != nil {
+		return store.SpecRevision{}, fmt.Errorf("failed to verify returned spec: %w", err)
+	}
+
+	return out, nil
+}
+
+// QuerySpecs queries chain specs with filters, sorting and pagination.
+// The cursor of the next page is returned (empty if there are no more pages).
+func (c *Client) QuerySpecs(ctx context.Context, q store.SpecQuery) ([]cxspec.SignedChainSpec, string, error) {
+	var out []cxspec.SignedChainSpec
+	addr := fmt.Sprintf("%s/api/specs?%s", c.addr, specQueryValues(q).Encode())
+	h, err := c.send(ctx, http.MethodGet, addr, nil, &out)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i, spec := range out {
+		if err := spec.Verify(); err != nil {
+			return nil, "", fmt.Errorf("failed to verify returned spec at index %d: %w", i, err)
+		}
+	}
+
+	return out, h.Get(NextCursorHeader), nil
+}
+
+// QuerySpecSummaries is similar to QuerySpecs, but obtains chain spec
+// summaries instead of full chain specs.
+func (c *Client) QuerySpecSummaries(ctx context.Context, q store.SpecQuery) ([]SpecSummary, string, error) {
+	v := specQueryValues(q)
+	v.Set("fields", specFieldsSummary)
+
+	var out []SpecSummary
+	addr := fmt.Sprintf("%s/api/specs?%s", c.addr, v.Encode())
+	h, err := c.send(ctx, http.MethodGet, addr, nil, &out)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return out, h.Get(NextCursorHeader), nil
+}
+
+// ChainsOfPubKey obtains summaries of the chain specs of the given chain
+// public key.
+func (c *Client) ChainsOfPubKey(ctx context.Context, pk cipher.PubKey) ([]SpecSummary, error) {
+	var out []SpecSummary
+	addr := fmt.Sprintf("%s/api/chains/by-pubkey/%s", c.addr, pk.Hex())
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Stats obtains the object totals of the tracker.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var out Stats
+	addr := fmt.Sprintf("%s/api/stats", c.addr)
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return Stats{}, err
+	}
+
+	return out, nil
+}
+
+// ChainStats obtains the statistics of the chain of genesis hash 'hash'.
+func (c *Client) ChainStats(ctx context.Context, hash cipher.SHA256) (ChainStats, error) {
+	var out ChainStats
+	addr := fmt.Sprintf("%s/api/chains/%s/stats", c.addr, hash.Hex())
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return ChainStats{}, err
+	}
+
+	return out, nil
+}
+
+// RelayPeerEntry posts a peer entry which is relayed by a federated tracker.
+// 'token' is the federation token of the tracker (see WithFederationToken), and
+// 'path' contains the IDs of the trackers which relayed the entry, starting
+// from the tracker where the entry originated.
+func (c *Client) RelayPeerEntry(ctx context.Context, token string, entry cxspec.SignedPeerEntry, path []string) error {
+	h := make(http.Header)
+	h.Set(RelayHeader, strings.Join(path, ","))
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+
+	addr := fmt.Sprintf("%s/api/peers", c.addr)
+	_, err := c.request(ctx, http.MethodPost, addr, h, entry, nil)
+	return err
+}
+
+// UpdatePeer posts a peer entry alongside an optional status which extends it.
+func (c *Client) UpdatePeer(ctx context.Context, peer Peer) error {
+	addr := fmt.Sprintf("%s/api/peers", c.addr)
+	return c.do(ctx, http.MethodPost, addr, peer, nil)
+}
+
+// Peer obtains the peer entry of public key 'pk' alongside its status (if
+// any).
+func (c *Client) Peer(ctx context.Context, pk cipher2.PubKey) (Peer, error) {
+	var out Peer
+	addr := fmt.Sprintf("%s/api/peers/%s", c.addr, pk.Hex())
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return Peer{}, err
+	}
+
+	if err := out.Verify(); err != nil {
+		return Peer{}, fmt.Errorf("failed to verify returned peer: %w", err)
+	}
+
+	return out, nil
+}
+
+// QueryPeersOfChain obtains the peers of the chain of genesis hash 'hash'
+// which match 'q'.
+func (c *Client) QueryPeersOfChain(ctx context.Context, hash cipher.SHA256, q store.PeerQuery) ([]cxspec.CXChainAddresses, error) {
+	v := make(url.Values)
+	v.Set("chain", hash.Hex())
+	if q.Max > 0 {
+		v.Set("max", strconv.Itoa(q.Max))
+	}
+	if q.MinHeight > 0 {
+		v.Set("min_height", strconv.FormatUint(q.MinHeight, 10))
+	}
+	if q.Strategy != "" {
+		v.Set("strategy", string(q.Strategy))
+	}
+
+	var out []cxspec.CXChainAddresses
+	addr := fmt.Sprintf("%s/api/peers?%s", c.addr, v.Encode())
+	if err := c.do(ctx, http.MethodGet, addr, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// LeavePeer removes the peer of secret key 'sk' from the chains of genesis
+// hashes 'chains', or from all chains if 'chains' is empty.
+func (c *Client) LeavePeer(ctx context.Context, sk cipher2.SecKey, chains []cipher2.SHA256) error {
+	leave, err := MakeSignedPeerLeave(sk, chains)
+	if err != nil {
+		return err
+	}
+
+	return c.LeavePeerSigned(ctx, leave)
+}
+
+// LeavePeerSigned removes a peer with a pre-signed leave request.
+func (c *Client) LeavePeerSigned(ctx context.Context, leave SignedPeerLeave) error {
+	addr := fmt.Sprintf("%s/api/peers/%s", c.addr, leave.Leave.PublicKey.Hex())
+	return c.do(ctx, http.MethodDelete, addr, leave, nil)
+}
+
+// Events opens a stream of the events which match 'f'.
+// If 'lastEventID' is not empty, the events published after it are received
+// first. The stream ends when the context is canceled or the stream is closed.
+// The http.Client of the Client should not have a timeout.
+func (c *Client) Events(ctx context.Context, f events.Filter, lastEventID string) (*EventStream, error) {
+	v := make(url.Values)
+	for _, chain := range f.Chains {
+		v.Add("chain", chain)
+	}
+	for _, t := range f.Types {
+		v.Add("type", string(t))
+	}
+
+	addr := fmt.Sprintf("%s/api/events", c.addr)
+	if len(v) > 0 {
+		addr += "?" + v.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream, application/json")
+	if lastEventID != "" {
+		req.Header.Set(LastEventIDHeader, lastEventID)
+	}
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRespCode(resp); err != nil {
+		if err := resp.Body.Close(); err != nil {
+			c.log.WithError(err).Error("Failed to close HTTP response body.")
+		}
+		return nil, err
+	}
+
+	return &EventStream{body: resp.Body, r: bufio.NewReader(resp.Body)}, nil
+}
+
+// BackupInfo describes a backup obtained with Client.Backup.
+type BackupInfo struct {
+	Size     int64  `json:"size"`
+	Checksum string `json:"sha256"` // Hex encoded SHA256 checksum.
+}
+
+// Backup streams a consistent copy of the tracker database into 'w'. The
+// admin bearer 'token' is required. An error is returned if the backup is
+// incomplete, or does not match the checksum reported by the tracker.
+// The http.Client of the Client should not have a timeout, as large backups
+// can take a while.
+func (c *Client) Backup(ctx context.Context, token string, w io.Writer) (BackupInfo, error) {
+	addr := fmt.Sprintf("%s/api/admin/backup", c.addr)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	req.Header.Set("Accept", "application/octet-stream, application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			c.log.WithError(err).Error("Failed to close HTTP response body.")
+		}
+	}()
+
+	if err := checkRespCode(resp); err != nil {
+		return BackupInfo{}, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), resp.Body)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	info := BackupInfo{Size: n, Checksum: hex.EncodeToString(h.Sum(nil))}
+
+	// The trailer is only available once the body is read.
+	switch exp := resp.Trailer.Get(BackupChecksumTrailer); exp {
+	case "":
+		return info, fmt.Errorf("backup is incomplete: missing %s trailer", BackupChecksumTrailer)
+	case info.Checksum:
+		return info, nil
+	default:
+		return info, fmt.Errorf("backup checksum is %s, but the tracker reported %s", info.Checksum, exp)
+	}
+}
+
+// EventStream reads events from a Server-Sent Events response of GET
+// /api/events.
+type EventStream struct {
+	body   io.ReadCloser
+	r      *bufio.Reader
+	lastID string
+}
+
+// Next blocks until the next event is received. The Data field of the event
+// contains the decoded JSON value (not SpecData or PeerData).
+// io.EOF is returned once the stream ends.
+func (s *EventStream) Next() (events.Event, error) {
+	var data []byte
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return events.Event{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "" && data != nil:
+			var e events.Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return events.Event{}, fmt.Errorf("failed to decode event: %w", err)
+			}
+			s.lastID = e.ID
+			return e, nil
+
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+
+		// Other fields are contained in the event data, and comments are
+		// keep-alives.
+	}
+}
+
+// LastEventID returns the ID of the last received event. It can be used to
+// resume the stream after reconnecting.
+func (s *EventStream) LastEventID() string {
+	return s.lastID
+}
+
+// Close closes the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+// do sends a request with an optional json encoded body 'in' and decodes the
+// json response into 'out' (if not nil).
+func (c *Client) do(ctx context.Context, method, addr string, in, out interface{}) error {
+	_, err := c.send(ctx, method, addr, in, out)
+	return err
+}
+
+// send is similar to do, but also returns the response header.
+func (c *Client) send(ctx context.Context, method, addr string, in, out interface{}) (http.Header, error) {
+	return c.request(ctx, method, addr, nil, in, out)
+}
+
+// request is similar to send, but also sets the request header 'h'.
+func (c *Client) request(ctx context.Context, method, addr string, h http.Header, in, out interface{}) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, addr, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			c.log.WithError(err).Error("Failed to close HTTP response body.")
+		}
+	}()
+
+	if err := checkRespCode(resp); err != nil {
+		return nil, err
+	}
+
+	if out == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkRespCode returns an error if the response does not have a 200 status
+// code. The error is a *HTTPError if the response body contains the JSON error
+// envelope. Otherwise, the error message is obtained from the response body.
+func checkRespCode(resp *http.Response) error {
+	code := resp.StatusCode
+
+	if code == http.StatusOK {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read server response with code '%d %s': %w",
+			code, http.StatusText(code), err)
+	}
+
+	var hErr HTTPError
+	if err := json.Unmarshal(b, &hErr); err == nil && hErr.Version > 0 {
+		return &hErr
+	}
+
+	var errMsg string
+	if err := json.Unmarshal(b, &errMsg); err != nil {
+		errMsg = strings.TrimSpace(string(b))
+	}
+
+	return fmt.Errorf("server responded with '%d %s': %s",
+		code, http.StatusText(code), errMsg)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// BackupChecksumTrailer is the HTTP trailer which contains the hex encoded
+// SHA256 checksum of a backup streamed by GET /api/admin/backup. As it is sent
+// after the backup, a missing trailer means that the backup is incomplete.
+const BackupChecksumTrailer = "X-Backup-Sha256"
+
+// getBackup streams a consistent point-in-time copy of the database
+// URI: /api/admin/backup
+// Method: GET
+// Auth: Bearer <admin-token>
+func getBackup(db *bbolt.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		// The backup is written within a read transaction, so writers are
+		// not blocked while it is streamed.
+		tx, err := db.Begin(false)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+		defer func() {
+			if err := tx.Rollback(); err != nil {
+				log.WithError(err).Error("Failed to close read transaction.")
+			}
+		}()
+
+		filename := fmt.Sprintf("cx_tracker_%d.db", time.Now().Unix())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.Header().Set("Trailer", BackupChecksumTrailer)
+		w.WriteHeader(http.StatusOK)
+
+		h := sha256.New()
+		n, err := tx.WriteTo(io.MultiWriter(w, h))
+		if err != nil {
+			// The status is already sent, so the missing trailer indicates
+			// the failure.
+			log.WithError(err).Error("Failed to stream backup.")
+			return
+		}
+
+		checksum := hex.EncodeToString(h.Sum(nil))
+		w.Header().Set(BackupChecksumTrailer, checksum)
+
+		log.WithField("size", n).
+			WithField("checksum", checksum).
+			Info("Streamed backup.")
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/events"
+)
+
+// LastEventIDHeader is the header of the resume token sent by reconnecting
+// Server-Sent Events clients.
+const LastEventIDHeader = "Last-Event-ID"
+
+// eventsKeepAlive is the interval of keep-alive comments sent over idle event
+// streams.
+const eventsKeepAlive = 15 * time.Second
+
+// getEvents streams spec and peer change events as Server-Sent Events
+// URI: /api/events[?chain=<chain-hash>][&type=<event-type>][&last_event_id=<token>]
+// Method: GET
+func getEvents(bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+		q := r.URL.Query()
+
+		var f events.Filter
+		for i, hashStr := range q["chain"] {
+			hash, err := cipher.SHA256FromHex(hashStr)
+			if err != nil {
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+					fmt.Errorf("failed to decode chain hash[%d] '%s': %w", i, hashStr, err)))
+				return
+			}
+			f.Chains = append(f.Chains, hash.Hex())
+		}
+		for _, typeStr := range q["type"] {
+			t, err := events.ParseType(typeStr)
+			if err != nil {
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery, err))
+				return
+			}
+			f.Types = append(f.Types, t)
+		}
+
+		token := r.Header.Get(LastEventIDHeader)
+		if token == "" {
+			token = q.Get("last_event_id")
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			httpWriteError(log, w, r, http.StatusInternalServerError,
+				errors.New("response writer does not support streaming"))
+			return
+		}
+
+		sub, err := bus.Subscribe(token, f)
+		if err != nil {
+			switch {
+			case errors.Is(err, events.ErrTokenExpired):
+				httpWriteError(log, w, r, http.StatusGone, withReason(ReasonResumeExpired, err))
+			case errors.Is(err, events.ErrInvalidToken):
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery, err))
+			default:
+				httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			}
+			return
+		}
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+
+			case e, ok := <-sub.Events():
+				if !ok {
+					log.WithError(sub.Err()).Info("Event subscription dropped.")
+					return
+				}
+				if err := writeEvent(w, e); err != nil {
+					log.WithError(err).Warn("Failed to write event.")
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// writeEvent writes 'e' in the Server-Sent Events format.
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b)
+	return err
+}
@@ -3,15 +3,21 @@ package api
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/skycoin/cx-chains/src/cx/cxspec"
 	"github.com/skycoin/dmsg/cipher"
+	scipher "github.com/skycoin/skycoin/src/cipher"
 
+	"github.com/skycoin/cx-tracker/pkg/metrics"
+	"github.com/skycoin/cx-tracker/pkg/ratelimit"
 	"github.com/skycoin/cx-tracker/pkg/store"
 )
 
@@ -19,6 +25,68 @@ const (
 	defaultMaxPeers = 12
 )
 
+// Peer is a signed peer entry alongside an optional signed status which
+// extends it. The fields of the entry are inlined, so that a Peer decodes as a
+// cxspec.SignedPeerEntry.
+//
+// The entry is kept as signed by the peer when it leaves some of its chains,
+// so Chains lists the genesis hashes of the chains of the entry which the peer
+// still serves.
+type Peer struct {
+	cxspec.SignedPeerEntry
+	Chains []string                `json:"chains"`
+	Status *store.SignedPeerStatus `json:"status,omitempty"`
+}
+
+// Verify checks the validity of the entry, that Chains are listed by the
+// entry, and the validity of the status (if any).
+func (p *Peer) Verify() error {
+	if err := p.SignedPeerEntry.Verify(); err != nil {
+		return err
+	}
+	for _, hashStr := range p.Chains {
+		if _, ok := p.Entry.CXChains[hashStr]; !ok {
+			return fmt.Errorf("chain '%s' is not listed by the entry", hashStr)
+		}
+	}
+	if p.Status != nil {
+		if err := p.Status.Verify(p.Entry); err != nil {
+			return fmt.Errorf("invalid status: %w", err)
+		}
+	}
+	return nil
+}
+
+// parsePeerQuery parses the 'max', 'min_height' and 'strategy' query values.
+// Peers are selected with 'strategy' if the query does not specify one.
+func parsePeerQuery(r *http.Request, strategy store.PeerStrategy) (store.PeerQuery, error) {
+	q := r.URL.Query()
+	out := store.PeerQuery{Max: defaultMaxPeers, Strategy: strategy}
+
+	if maxStr := q.Get("max"); maxStr != "" {
+		var err error
+		if out.Max, err = strconv.Atoi(maxStr); err != nil {
+			return store.PeerQuery{}, fmt.Errorf("invalid query value '%s' for 'max': %w", maxStr, err)
+		}
+	}
+
+	if heightStr := q.Get("min_height"); heightStr != "" {
+		var err error
+		if out.MinHeight, err = strconv.ParseUint(heightStr, 10, 64); err != nil {
+			return store.PeerQuery{}, fmt.Errorf("invalid query value '%s' for 'min_height': %w", heightStr, err)
+		}
+	}
+
+	if strategyStr := q.Get("strategy"); strategyStr != "" {
+		var err error
+		if out.Strategy, err = store.ParsePeerStrategy(strategyStr); err != nil {
+			return store.PeerQuery{}, fmt.Errorf("invalid query value '%s' for 'strategy': %w", strategyStr, err)
+		}
+	}
+
+	return out, nil
+}
+
 // getPeer returns peer of given public key
 // URI: /api/peers/<public-key>
 // Method: GET
@@ -30,48 +98,80 @@ func getPeer(ps store.PeersStore) http.HandlerFunc {
 
 		var pk cipher.PubKey
 		if err := pk.Set(pkStr); err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to decode pk '%s': %w", pkStr, err))
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidPubKey,
+				fmt.Errorf("failed to decode pk '%s': %w", pkStr, err)))
+			return
+		}
+
+		entry, err := ps.Entry(r.Context(), pk)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusNotFound, err)
+			return
+		}
+
+		chains, err := ps.ChainsOfEntry(r.Context(), pk)
+		if err != nil {
+			if errors.Is(err, store.ErrPeerNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound, err)
+				return
+			}
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		entry, err := ps.Entry(r.Context(), cipher.PubKey(pk))
+		status, err := ps.Status(r.Context(), pk)
 		if err != nil {
-			httpWriteError(log, w, http.StatusNotFound, err)
+			if errors.Is(err, store.ErrPeerNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound, err)
+				return
+			}
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		if err := entry.Verify(); err != nil {
-			httpWriteError(log, w, http.StatusInternalServerError, err)
+		peer := Peer{SignedPeerEntry: entry, Chains: make([]string, 0, len(chains))}
+
+		// The entry may have been updated after it was obtained, so only
+		// chains which it lists are kept.
+		for _, hash := range chains {
+			hashStr := hex.EncodeToString(hash[:])
+			if _, ok := entry.Entry.CXChains[hashStr]; ok {
+				peer.Chains = append(peer.Chains, hashStr)
+			}
+		}
+		sort.Strings(peer.Chains)
+
+		// The entry may have been updated after it was obtained.
+		if status != nil && status.Status.LastSeen == entry.Entry.LastSeen {
+			peer.Status = status
+		}
+
+		if err := peer.Verify(); err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
-		httpWriteJson(log, w, r, http.StatusOK, entry)
+		httpWriteJson(log, w, r, http.StatusOK, peer)
 	}
 }
 
 // getPeersOfChain returns peers of a given chain hash
-// URI: /api/peers?chain=<chain-hash>
+// URI: /api/peers?chain=<chain-hash>[&max=<n>][&min_height=<height>][&strategy=<strategy>]
 // Method: GET
-func getPeersOfChain(ps store.PeersStore) http.HandlerFunc {
+func getPeersOfChain(ps store.PeersStore, strategy store.PeerStrategy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := httpLogger(r)
-		q := r.URL.Query()
-
-		max := defaultMaxPeers
-		if maxStr := q.Get("max"); maxStr != "" {
-			var err error
-			if max, err = strconv.Atoi(maxStr); err != nil {
-				httpWriteError(log, w, http.StatusBadRequest,
-					fmt.Errorf("invalid query value '%s' for 'max': %w", maxStr, err))
-				return
-			}
+
+		pq, err := parsePeerQuery(r, strategy)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery, err))
+			return
 		}
 
 		hashStrs, ok := r.URL.Query()["chain"]
 		if !ok {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("query key 'chain' expects atleast one argument"))
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery,
+				fmt.Errorf("query key 'chain' expects atleast one argument")))
 			return
 		}
 
@@ -79,13 +179,13 @@ func getPeersOfChain(ps store.PeersStore) http.HandlerFunc {
 		for i, hashStr := range hashStrs {
 			b, err := hex.DecodeString(hashStr)
 			if err != nil {
-				httpWriteError(log, w, http.StatusBadRequest,
-					fmt.Errorf("failed to decode chain hash[%d] '%s': %w", i, hashStr, err))
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+					fmt.Errorf("failed to decode chain hash[%d] '%s': %w", i, hashStr, err)))
 				return
 			}
 			if copy(hashs[i][:], b) != len(cipher.SHA256{}) {
-				httpWriteError(log, w, http.StatusBadRequest,
-					fmt.Errorf("chain hash[%d] '%s' is of wrong length", i, hashStr))
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+					fmt.Errorf("chain hash[%d] '%s' is of wrong length", i, hashStr)))
 				return
 			}
 		}
@@ -93,7 +193,11 @@ func getPeersOfChain(ps store.PeersStore) http.HandlerFunc {
 		var out []cxspec.CXChainAddresses
 
 		for _, h := range hashs {
-			peers, err := ps.RandPeersOfChain(r.Context(), h, max)
+			peers, err := ps.QueryPeersOfChain(r.Context(), h, pq)
+			if errors.Is(err, store.ErrNoReachability) {
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonNotProbed, err))
+				return
+			}
 			if err != nil {
 				log.WithError(err).WithField("chain_hash", h).Info("no peers found")
 				continue
@@ -107,21 +211,16 @@ func getPeersOfChain(ps store.PeersStore) http.HandlerFunc {
 }
 
 // getPeerList obtains a peer list
-// URI: /peerlists/<genesis-hash>.txt
+// URI: /peerlists/<genesis-hash>.txt[?max=<n>][&min_height=<height>][&strategy=<strategy>]
 // Method: GET
-func getPeerList(ps store.PeersStore) http.HandlerFunc {
+func getPeerList(ps store.PeersStore, strategy store.PeerStrategy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := httpLogger(r)
-		q := r.URL.Query()
-
-		max := defaultMaxPeers
-		if maxStr := q.Get("max"); maxStr != "" {
-			var err error
-			if max, err = strconv.Atoi(maxStr); err != nil {
-				httpWriteError(log, w, http.StatusBadRequest,
-					fmt.Errorf("invalid query value '%s' for 'max': %w", maxStr, err))
-				return
-			}
+
+		pq, err := parsePeerQuery(r, strategy)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery, err))
+			return
 		}
 
 		filename := path.Base(r.URL.EscapedPath())
@@ -130,19 +229,23 @@ func getPeerList(ps store.PeersStore) http.HandlerFunc {
 		var hash cipher.SHA256
 		hashB, err := hex.DecodeString(hashStr)
 		if err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("invalid genesis hash provided '%s': %w", hashStr, err))
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("invalid genesis hash provided '%s': %w", hashStr, err)))
 			return
 		}
 		if n := copy(hash[:], hashB); n != len(cipher.SHA256{}) {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("provided genesis hash has invalid length"))
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("provided genesis hash has invalid length")))
 			return
 		}
 
-		peers, err := ps.RandPeersOfChain(r.Context(), hash, max)
+		peers, err := ps.QueryPeersOfChain(r.Context(), hash, pq)
+		if errors.Is(err, store.ErrNoReachability) {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonNotProbed, err))
+			return
+		}
 		if err != nil {
-			httpWriteError(log, w, http.StatusInternalServerError,
+			httpWriteError(log, w, r, http.StatusInternalServerError,
 				fmt.Errorf("failed to obtain peers: %w", err))
 			return
 		}
@@ -159,29 +262,135 @@ func getPeerList(ps store.PeersStore) http.HandlerFunc {
 	}
 }
 
-// postPeers posts a peer entry
+// postPeers posts a peer entry, optionally alongside a status which extends it
 // URI: /api/peers
 // Method: POST
-func postPeers(ps store.PeersStore) http.HandlerFunc {
+func postPeers(ps store.PeersStore, m metrics.Metrics, l *ratelimit.Limiter, leaves *peerLeaves) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := httpLogger(r)
 
-		var entry cxspec.SignedPeerEntry
-		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to decode entry: %w", err))
+		if !httpAllow(l, m, w, r, metrics.KindPeer, ratelimit.KindIP, httpClientIP(r)) {
 			return
 		}
 
-		if err := entry.Verify(); err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to verify entry: %w", err))
+		var peer Peer
+		if err := json.NewDecoder(r.Body).Decode(&peer); err != nil {
+			m.RecordRejection(metrics.KindPeer, ReasonDecode)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonDecode,
+				fmt.Errorf("failed to decode entry: %w", err)))
 			return
 		}
 
-		if err := ps.UpdateEntry(r.Context(), entry); err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to update entry: %w", err))
+		entry := peer.SignedPeerEntry
+
+		if err := peer.Verify(); err != nil {
+			m.RecordRejection(metrics.KindPeer, ReasonVerify)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonVerify,
+				fmt.Errorf("failed to verify entry: %w", err)))
+			return
+		}
+
+		// Entries are only counted against the limit of their public key once
+		// verified, so the limit cannot be exhausted by others.
+		if !httpAllow(l, m, w, r, metrics.KindPeer, ratelimit.KindPeerPK, entry.Entry.PublicKey.Hex()) {
+			return
+		}
+
+		if err := leaves.Check(entry.Entry, time.Now()); err != nil {
+			m.RecordRejection(metrics.KindPeer, ReasonStale)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonStale, err))
+			return
+		}
+
+		// The relay path is set by FederationAuthMiddleware.
+		ctx := r.Context()
+
+		if err := ps.UpdateEntry(ctx, entry); err != nil {
+			m.RecordRejection(metrics.KindPeer, ReasonStale)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonStale,
+				fmt.Errorf("failed to update entry: %w", err)))
+			return
+		}
+
+		if peer.Status != nil {
+			if err := ps.UpdateStatus(ctx, *peer.Status); err != nil {
+				// The entry may have been updated concurrently.
+				if errors.Is(err, store.ErrStaleStatus) || errors.Is(err, store.ErrPeerNotExist) {
+					m.RecordRejection(metrics.KindPeer, ReasonStale)
+					httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonStale,
+						fmt.Errorf("failed to update status: %w", err)))
+					return
+				}
+				httpWriteError(log, w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		httpWriteJson(log, w, r, http.StatusOK, true)
+	}
+}
+
+// deletePeer removes a peer from the chains listed in a signed leave
+// The request body should contain a SignedPeerLeave signed by the secret key
+// of the peer.
+// URI: /api/peers/<public-key>
+// Method: DELETE
+func deletePeer(ps store.PeersStore, m metrics.Metrics, l *ratelimit.Limiter, guard *replayGuard, leaves *peerLeaves) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		if !httpAllow(l, m, w, r, metrics.KindPeer, ratelimit.KindIP, httpClientIP(r)) {
+			return
+		}
+
+		pkStr := path.Base(r.URL.EscapedPath())
+
+		var pk cipher.PubKey
+		if err := pk.Set(pkStr); err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidPubKey,
+				fmt.Errorf("failed to decode pk '%s': %w", pkStr, err)))
+			return
+		}
+
+		var leave SignedPeerLeave
+		if err := json.NewDecoder(r.Body).Decode(&leave); err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonDecode,
+				fmt.Errorf("failed to decode signed peer leave: %w", err)))
+			return
+		}
+
+		now := time.Now()
+
+		if err := leave.Verify(pk, now); err != nil {
+			httpWriteError(log, w, r, http.StatusUnauthorized, withReason(ReasonVerify,
+				fmt.Errorf("failed to verify peer leave: %w", err)))
+			return
+		}
+
+		if !httpAllow(l, m, w, r, metrics.KindPeer, ratelimit.KindPeerPK, pk.Hex()) {
+			return
+		}
+
+		if err := guard.Check(scipher.SHA256(leave.Leave.Hash()), now); err != nil {
+			httpWriteError(log, w, r, http.StatusUnauthorized, withReason(ReasonReplayed, err))
+			return
+		}
+
+		// Verified above.
+		chains, _ := leave.Leave.ChainHashes()
+
+		// Entries signed before the leave are rejected from now on, even if
+		// the peer has no entry to remove.
+		leaves.Add(leave.Leave, now)
+
+		if _, err := ps.RemoveEntry(r.Context(), pk, chains); err != nil {
+			if errors.Is(err, store.ErrPeerNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound,
+					fmt.Errorf("entry of pk '%s' has timed out or does not exist", pk.Hex()))
+				return
+			}
+
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -6,35 +6,118 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/skycoin/cx-chains/src/cx/cxspec"
 	"github.com/skycoin/skycoin/src/cipher"
 
+	"github.com/skycoin/cx-tracker/pkg/metrics"
+	"github.com/skycoin/cx-tracker/pkg/policy"
+	"github.com/skycoin/cx-tracker/pkg/ratelimit"
 	"github.com/skycoin/cx-tracker/pkg/store"
 )
 
-// getAllSpecs returns all chain specs
+// getAllSpecs returns chain specs
+// Specs can be filtered with the 'coin_ticker', 'coin_name', 'chain_pubkey' and
+// 'spec_era' query keys, sorted with 'sort' (prefix with '-' for descending
+// order), and paginated with 'limit' and 'cursor'. The cursor of the next page
+// is returned in the 'X-Next-Cursor' header.
+// 'fields=summary' returns SpecSummary objects which omit the genesis program
+// state.
 // URI: /api/specs
 // Method: GET
 func getAllSpecs(ss store.SpecStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := httpLogger(r)
+		q := r.URL.Query()
 
-		specs, err := ss.ChainSpecAll(r.Context())
+		sq, err := parseSpecQuery(q)
 		if err != nil {
-			httpWriteError(log, w, http.StatusInternalServerError, err)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery, err))
 			return
 		}
 
-		for i, s := range specs {
-			if err := s.Verify(); err != nil {
-				httpWriteError(log, w, http.StatusInternalServerError,
+		summary := false
+		switch fields := q.Get("fields"); fields {
+		case "", specFieldsFull:
+		case specFieldsSummary:
+			summary = true
+		default:
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery,
+				fmt.Errorf("invalid query value '%s' for 'fields'", fields)))
+			return
+		}
+
+		page, err := ss.QuerySpecs(r.Context(), sq)
+		if err != nil {
+			if errors.Is(err, store.ErrInvalidSpecQuery) {
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidQuery, err))
+				return
+			}
+
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		for i, e := range page.Entries {
+			if err := e.Spec.Verify(); err != nil {
+				httpWriteError(log, w, r, http.StatusInternalServerError,
 					fmt.Errorf("failed to verify spec at index %d: %w", i, err))
 				return
 			}
 		}
 
-		httpWriteJson(log, w, r, http.StatusOK, specs)
+		if page.NextCursor != "" {
+			w.Header().Set(NextCursorHeader, page.NextCursor)
+		}
+
+		if summary {
+			out := make([]SpecSummary, len(page.Entries))
+			for i, e := range page.Entries {
+				out[i] = makeSpecSummary(e)
+			}
+			httpWriteJson(log, w, r, http.StatusOK, out)
+			return
+		}
+
+		out := make([]cxspec.SignedChainSpec, len(page.Entries))
+		for i, e := range page.Entries {
+			out[i] = e.Spec
+		}
+		httpWriteJson(log, w, r, http.StatusOK, out)
+	}
+}
+
+// getChainsOfPubKey returns summaries of the chain specs of a chain public key
+// URI: /api/chains/by-pubkey/<chain-public-key>
+// Method: GET
+func getChainsOfPubKey(ss store.SpecStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		pkStr := chi.URLParam(r, "pk")
+
+		pk, err := cipher.PubKeyFromHex(pkStr)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidPubKey,
+				fmt.Errorf("failed to decode chain pk '%s': %w", pkStr, err)))
+			return
+		}
+
+		page, err := ss.QuerySpecs(r.Context(), store.SpecQuery{ChainPubKey: pk.Hex()})
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		out := make([]SpecSummary, len(page.Entries))
+		for i, e := range page.Entries {
+			out[i] = makeSpecSummary(e)
+		}
+
+		httpWriteJson(log, w, r, http.StatusOK, out)
 	}
 }
 
@@ -49,24 +132,24 @@ func getSpecOfGenesisHash(ss store.SpecStore) http.HandlerFunc {
 
 		hash, err := cipher.SHA256FromHex(hashStr)
 		if err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err))
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err)))
 			return
 		}
 
 		spec, err := ss.ChainSpec(r.Context(), hash)
 		if err != nil {
 			if errors.Is(err, store.ErrBboltObjectNotExist) {
-				httpWriteError(log, w, http.StatusNotFound, err)
+				httpWriteError(log, w, r, http.StatusNotFound, err)
 				return
 			}
 
-			httpWriteError(log, w, http.StatusInternalServerError, err)
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := spec.Verify(); err != nil {
-			httpWriteError(log, w, http.StatusInternalServerError, err)
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -75,33 +158,54 @@ func getSpecOfGenesisHash(ss store.SpecStore) http.HandlerFunc {
 }
 
 // postSpec posts a chain spec
+// Chain specs rejected by the admission policy (if any) result in a 403 with
+// the reason of the rejection.
 // URI: /api/specs
 // Method: POST
-func postSpec(ss store.SpecStore) http.HandlerFunc {
+func postSpec(ss store.SpecStore, m metrics.Metrics, l *ratelimit.Limiter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := httpLogger(r)
 
+		if !httpAllow(l, m, w, r, metrics.KindSpec, ratelimit.KindIP, httpClientIP(r)) {
+			return
+		}
+
 		var spec cxspec.SignedChainSpec
 		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to decode spec: %w", err))
+			m.RecordRejection(metrics.KindSpec, ReasonDecode)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonDecode,
+				fmt.Errorf("failed to decode spec: %w", err)))
 			return
 		}
 
 		if err := spec.Verify(); err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to verify spec: %w", err))
+			m.RecordRejection(metrics.KindSpec, ReasonVerify)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonVerify,
+				fmt.Errorf("failed to verify spec: %w", err)))
+			return
+		}
+
+		if !httpAllow(l, m, w, r, metrics.KindSpec, ratelimit.KindChainPK, store.NormalizeChainPubKey(spec.Spec.ChainPubKey)) {
 			return
 		}
 
 		if err := ss.AddSpec(r.Context(), spec); err != nil {
-			if errors.Is(err, store.ErrBboltObjectAlreadyExists); err != nil {
-				httpWriteError(log, w, http.StatusConflict,
+			var rej *policy.Rejection
+			if errors.As(err, &rej) {
+				m.RecordRejection(metrics.KindSpec, rej.Reason)
+				httpWriteError(log, w, r, http.StatusForbidden, withReason(rej.Reason, err))
+				return
+			}
+
+			if errors.Is(err, store.ErrBboltObjectAlreadyExists) {
+				m.RecordRejection(metrics.KindSpec, ReasonConflict)
+				httpWriteError(log, w, r, http.StatusConflict,
 					fmt.Errorf("new spec conflicts with current directory: %w", err))
 				return
 			}
 
-			httpWriteError(log, w, http.StatusInternalServerError,
+			m.RecordRejection(metrics.KindSpec, ReasonInternal)
+			httpWriteError(log, w, r, http.StatusInternalServerError,
 				fmt.Errorf("failed to post spec: %w", err))
 			return
 		}
@@ -110,11 +214,189 @@ func postSpec(ss store.SpecStore) http.HandlerFunc {
 	}
 }
 
-// deleteSpec deletes a chain spec of given pk
-// TODO @evanlinjin: We need to sign this.
-// URI: /api/spec/<genesis-hash>
+// reviseSpec posts a new revision of an existing chain spec
+// The new revision should be signed by the same chain key and should not change
+// the genesis or identity fields of the chain spec.
+// URI: /api/specs/<genesis-hash>
+// Method: PUT
+func reviseSpec(ss store.SpecStore, m metrics.Metrics, l *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		if !httpAllow(l, m, w, r, metrics.KindSpec, ratelimit.KindIP, httpClientIP(r)) {
+			return
+		}
+
+		hashStr := path.Base(r.URL.EscapedPath())
+
+		hash, err := cipher.SHA256FromHex(hashStr)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err)))
+			return
+		}
+
+		var spec cxspec.SignedChainSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			m.RecordRejection(metrics.KindSpec, ReasonDecode)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonDecode,
+				fmt.Errorf("failed to decode spec: %w", err)))
+			return
+		}
+
+		if err := spec.Verify(); err != nil {
+			m.RecordRejection(metrics.KindSpec, ReasonVerify)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonVerify,
+				fmt.Errorf("failed to verify spec: %w", err)))
+			return
+		}
+
+		if !httpAllow(l, m, w, r, metrics.KindSpec, ratelimit.KindChainPK, store.NormalizeChainPubKey(spec.Spec.ChainPubKey)) {
+			return
+		}
+
+		genBlock, err := spec.Spec.GenerateGenesisBlock()
+		if err != nil {
+			m.RecordRejection(metrics.KindSpec, ReasonVerify)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonVerify, err))
+			return
+		}
+		if genHash := genBlock.HashHeader(); genHash != hash {
+			m.RecordRejection(metrics.KindSpec, ReasonInvalidRevision)
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidRevision,
+				fmt.Errorf("spec has genesis hash '%s' (expected '%s')", genHash.Hex(), hash.Hex())))
+			return
+		}
+
+		rev, err := ss.ReviseSpec(r.Context(), spec)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrBboltObjectNotExist):
+				m.RecordRejection(metrics.KindSpec, ReasonNotFound)
+				httpWriteError(log, w, r, http.StatusNotFound, err)
+			case errors.Is(err, store.ErrImmutableSpecField):
+				m.RecordRejection(metrics.KindSpec, ReasonInvalidRevision)
+				httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidRevision, err))
+			case errors.Is(err, store.ErrBboltObjectAlreadyExists):
+				m.RecordRejection(metrics.KindSpec, ReasonConflict)
+				httpWriteError(log, w, r, http.StatusConflict, err)
+			default:
+				m.RecordRejection(metrics.KindSpec, ReasonInternal)
+				httpWriteError(log, w, r, http.StatusInternalServerError,
+					fmt.Errorf("failed to revise spec: %w", err))
+			}
+			return
+		}
+
+		out := SpecRevisionSummary{
+			Revision: rev,
+			SpecHash: spec.Spec.SpecHash().Hex(),
+			Sig:      spec.Sig,
+		}
+		httpWriteJson(log, w, r, http.StatusOK, out)
+	}
+}
+
+// SpecRevisionSummary summarizes a chain spec revision.
+type SpecRevisionSummary struct {
+	Revision uint64 `json:"revision"`
+	Created  int64  `json:"created,omitempty"`
+	SpecHash string `json:"spec_hash"`
+	Sig      string `json:"sig"`
+}
+
+// getSpecRevisions returns the revision history of a chain spec
+// URI: /api/specs/<genesis-hash>/revisions
+// Method: GET
+func getSpecRevisions(ss store.SpecStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		hashStr := chi.URLParam(r, "hash")
+
+		hash, err := cipher.SHA256FromHex(hashStr)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err)))
+			return
+		}
+
+		revs, err := ss.SpecRevisions(r.Context(), hash)
+		if err != nil {
+			if errors.Is(err, store.ErrBboltObjectNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound, err)
+				return
+			}
+
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		out := make([]SpecRevisionSummary, len(revs))
+		for i, rev := range revs {
+			out[i] = SpecRevisionSummary{
+				Revision: rev.Revision,
+				Created:  rev.Created,
+				SpecHash: rev.Spec.Spec.SpecHash().Hex(),
+				Sig:      rev.Spec.Sig,
+			}
+		}
+
+		httpWriteJson(log, w, r, http.StatusOK, out)
+	}
+}
+
+// getSpecRevision returns a specific revision of a chain spec
+// URI: /api/specs/<genesis-hash>/revisions/<revision>
+// Method: GET
+func getSpecRevision(ss store.SpecStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		hashStr := chi.URLParam(r, "hash")
+
+		hash, err := cipher.SHA256FromHex(hashStr)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err)))
+			return
+		}
+
+		revStr := chi.URLParam(r, "rev")
+
+		revN, err := strconv.ParseUint(revStr, 10, 64)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidRevision,
+				fmt.Errorf("failed to decode revision '%s': %w", revStr, err)))
+			return
+		}
+
+		rev, err := ss.SpecRevision(r.Context(), hash, revN)
+		if err != nil {
+			if errors.Is(err, store.ErrBboltObjectNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound, err)
+				return
+			}
+
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := rev.Spec.Verify(); err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		httpWriteJson(log, w, r, http.StatusOK, rev)
+	}
+}
+
+// deleteSpec deletes a chain spec of given genesis hash
+// The request body should contain a SignedSpecDeletion signed by the chain
+// secret key of the chain spec.
+// URI: /api/specs/<genesis-hash>
 // Method: DELETE
-func deleteSpec(ss store.SpecStore) http.HandlerFunc {
+func deleteSpec(ss store.SpecStore, guard *replayGuard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := httpLogger(r)
 
@@ -122,17 +404,56 @@ func deleteSpec(ss store.SpecStore) http.HandlerFunc {
 
 		hash, err := cipher.SHA256FromHex(hashStr)
 		if err != nil {
-			httpWriteError(log, w, http.StatusBadRequest,
-				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err))
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err)))
+			return
+		}
+
+		var del SignedSpecDeletion
+		if err := json.NewDecoder(r.Body).Decode(&del); err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonDecode,
+				fmt.Errorf("failed to decode signed spec deletion: %w", err)))
+			return
+		}
+
+		spec, err := ss.ChainSpec(r.Context(), hash)
+		if err != nil {
+			if errors.Is(err, store.ErrBboltObjectNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound, err)
+				return
+			}
+
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		chainPK, err := cipher.PubKeyFromHex(spec.Spec.ChainPubKey)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError,
+				fmt.Errorf("failed to decode chain pk of stored spec: %w", err))
+			return
+		}
+
+		now := time.Now()
+
+		if err := del.Verify(hash, chainPK, now); err != nil {
+			httpWriteError(log, w, r, http.StatusUnauthorized, withReason(ReasonVerify,
+				fmt.Errorf("failed to verify spec deletion: %w", err)))
+			return
+		}
+
+		if err := guard.Check(del.Deletion.Hash(), now); err != nil {
+			httpWriteError(log, w, r, http.StatusUnauthorized, withReason(ReasonReplayed, err))
+			return
 		}
 
 		if err := ss.DelSpec(r.Context(), hash); err != nil {
-			if errors.Is(store.ErrBboltObjectNotExist, err) {
-				httpWriteError(log, w, http.StatusNotFound, err)
+			if errors.Is(err, store.ErrBboltObjectNotExist) {
+				httpWriteError(log, w, r, http.StatusNotFound, err)
 				return
 			}
 
-			httpWriteError(log, w, http.StatusInternalServerError, err)
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// Stats contains the object totals of the tracker.
+type Stats struct {
+	Specs         uint64         `json:"specs"`           // Number of registered chain specs.
+	Chains        int            `json:"chains"`          // Number of chains with live peers.
+	PeerEntries   int            `json:"peer_entries"`    // Number of live peer entries.
+	PeerAddresses int            `json:"peer_addresses"`  // Number of live chain addresses of all chains.
+	DmsgOnly      int            `json:"dmsg_only"`       // Number of live chain addresses without a TCP address.
+	TCP           int            `json:"tcp"`             // Number of live chain addresses with a TCP address.
+	DmsgOnlyRatio float64        `json:"dmsg_only_ratio"` // Fraction of live chain addresses which are dmsg-only.
+	FirstSeen     int64          `json:"first_seen"`      // Unix time the earliest live peer was first seen (0 if unknown).
+	LastSeen      int64          `json:"last_seen"`       // Unix time the latest live peer was last seen (0 if unknown).
+	AnnounceRate  float64        `json:"announce_rate"`   // Announcements per minute of all chains.
+	ChainPeers    map[string]int `json:"chain_peers"`     // Number of live peers of each chain.
+}
+
+// ChainStats contains the statistics of a chain.
+type ChainStats struct {
+	Chain      string `json:"chain"`      // Genesis hash of the chain.
+	Registered bool   `json:"registered"` // Whether the chain spec is registered.
+	store.ChainStats
+	DmsgOnlyRatio float64 `json:"dmsg_only_ratio"` // Fraction of live peers which are dmsg-only.
+}
+
+// getStats returns the object totals of the tracker
+// URI: /api/stats
+// Method: GET
+func getStats(ss store.SpecStore, ps store.PeersStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		specs, err := ss.SpecCount(r.Context())
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		peers, err := ps.Stats(r.Context())
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		chains, err := ps.ChainStats(r.Context())
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		out := Stats{
+			Specs:       specs,
+			PeerEntries: peers.Entries,
+			ChainPeers:  make(map[string]int, len(chains)),
+		}
+		for hash, cs := range chains {
+			if cs.Peers > 0 {
+				out.Chains++
+			}
+			out.PeerAddresses += cs.Peers
+			out.DmsgOnly += cs.DmsgOnly
+			out.TCP += cs.TCP
+			out.AnnounceRate += cs.AnnounceRate
+			if cs.FirstSeen != 0 && (out.FirstSeen == 0 || cs.FirstSeen < out.FirstSeen) {
+				out.FirstSeen = cs.FirstSeen
+			}
+			if cs.LastSeen > out.LastSeen {
+				out.LastSeen = cs.LastSeen
+			}
+			out.ChainPeers[cipher.SHA256(hash).Hex()] = cs.Peers
+		}
+		out.DmsgOnlyRatio = ratio(out.DmsgOnly, out.PeerAddresses)
+
+		httpWriteJson(log, w, r, http.StatusOK, out)
+	}
+}
+
+// getChainStats returns the statistics of a chain
+// URI: /api/chains/<genesis-hash>/stats
+// Method: GET
+func getChainStats(ss store.SpecStore, ps store.PeersStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := httpLogger(r)
+
+		hashStr := chi.URLParam(r, "hash")
+
+		hash, err := cipher.SHA256FromHex(hashStr)
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusBadRequest, withReason(ReasonInvalidHash,
+				fmt.Errorf("failed to decode hash '%s': %w", hashStr, err)))
+			return
+		}
+
+		registered := true
+		if _, err := ss.ChainSpec(r.Context(), hash); err != nil {
+			if !errors.Is(err, store.ErrBboltObjectNotExist) {
+				httpWriteError(log, w, r, http.StatusInternalServerError, err)
+				return
+			}
+			registered = false
+		}
+
+		cs, ok, err := ps.StatsOfChain(r.Context(), cipher2.SHA256(hash))
+		if err != nil {
+			httpWriteError(log, w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok && !registered {
+			httpWriteError(log, w, r, http.StatusNotFound, withReason(ReasonNotFound,
+				fmt.Errorf("chain '%s' is not registered and has no peers", hash.Hex())))
+			return
+		}
+
+		httpWriteJson(log, w, r, http.StatusOK, ChainStats{
+			Chain:         hash.Hex(),
+			Registered:    registered,
+			ChainStats:    cs,
+			DmsgOnlyRatio: ratio(cs.DmsgOnly, cs.Peers),
+		})
+	}
+}
+
+// ratio returns n/total, or 0 if total is 0.
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorVersion is the current version of the HTTPError envelope.
+const ErrorVersion = 1
+
+// Machine-readable reasons of HTTP errors.
+// These are also used as the 'reason' label of rejection metrics.
+const (
+	ReasonBadRequest       = "bad_request"
+	ReasonInvalidHash      = "invalid_hash"
+	ReasonInvalidPubKey    = "invalid_pubkey"
+	ReasonInvalidQuery     = "invalid_query"
+	ReasonNotProbed        = "not_probed"
+	ReasonDecode           = "decode_failed"
+	ReasonVerify           = "verify_failed"
+	ReasonInvalidRevision  = "invalid_revision"
+	ReasonStale            = "stale_entry"
+	ReasonUnauthorized     = "unauthorized"
+	ReasonReplayed         = "replayed_request"
+	ReasonNotFound         = "not_found"
+	ReasonMethodNotAllowed = "method_not_allowed"
+	ReasonConflict         = "conflict"
+	ReasonResumeExpired    = "resume_expired"
+	ReasonReadOnly         = "read_only"
+	ReasonRateLimited      = "rate_limited"
+	ReasonInternal         = "internal"
+	ReasonUnknown          = "unknown"
+)
+
+// HTTPError is the JSON error envelope returned by the cx-tracker API.
+//
+// For backwards compatibility with cxspec.CXTrackerClient (which decodes error
+// bodies as a JSON string), the envelope is only returned to requests which
+// contain an 'Accept' header that permits 'application/json'. Other requests
+// receive the error message as a JSON string.
+type HTTPError struct {
+	Version   int    `json:"version"`
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	Reason    string `json:"reason"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error implements error.
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("server responded with '%d %s' (%s): %s",
+		e.Code, http.StatusText(e.Code), e.Reason, e.Message)
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" [request_id: %s]", e.RequestID)
+	}
+	return msg
+}
+
+// reasonError attaches a machine-readable reason to an error.
+type reasonError struct {
+	reason string
+	err    error
+}
+
+// withReason attaches a machine-readable reason to 'err'.
+// The reason is reported by httpWriteError.
+func withReason(reason string, err error) error {
+	return &reasonError{reason: reason, err: err}
+}
+
+func (e *reasonError) Error() string { return e.err.Error() }
+func (e *reasonError) Unwrap() error { return e.err }
+
+// errorReason obtains the reason attached to 'err' via withReason, falling
+// back to a reason derived from the status code.
+func errorReason(code int, err error) string {
+	var rErr *reasonError
+	if errors.As(err, &rErr) {
+		return rErr.reason
+	}
+
+	switch code {
+	case http.StatusBadRequest:
+		return ReasonBadRequest
+	case http.StatusUnauthorized:
+		return ReasonUnauthorized
+	case http.StatusNotFound:
+		return ReasonNotFound
+	case http.StatusMethodNotAllowed:
+		return ReasonMethodNotAllowed
+	case http.StatusConflict:
+		return ReasonConflict
+	case http.StatusGone:
+		return ReasonResumeExpired
+	case http.StatusTooManyRequests:
+		return ReasonRateLimited
+	case http.StatusInternalServerError:
+		return ReasonInternal
+	default:
+		return ReasonUnknown
+	}
+}
+
+// WriteError writes 'err' as a response of status 'code' in the same format as
+// errors of the cx-tracker API. It is used by handlers which are served
+// alongside the API.
+func WriteError(log logrus.FieldLogger, w http.ResponseWriter, r *http.Request, code int, err error) {
+	httpWriteError(log, w, r, code, err)
+}
+
+func httpWriteError(log logrus.FieldLogger, w http.ResponseWriter, r *http.Request, code int, err error) {
+	reason := errorReason(code, err)
+	log.WithError(err).WithField("reason", reason).Error()
+
+	var v interface{} = err.Error()
+	if acceptsErrorEnvelope(r) {
+		v = HTTPError{
+			Version:   ErrorVersion,
+			Code:      code,
+			Message:   err.Error(),
+			Reason:    reason,
+			RequestID: middleware.GetReqID(r.Context()),
+		}
+	}
+
+	b, mErr := json.Marshal(v)
+	if mErr != nil {
+		log.WithError(mErr).Error("Failed to encode error response.")
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+
+	if _, err := w.Write(b); err != nil {
+		log.WithError(err).Error()
+	}
+}
+
+// httpMethodNotAllowed responds to requests of unsupported methods.
+func httpMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	httpWriteError(httpLogger(r), w, r, http.StatusMethodNotAllowed,
+		fmt.Errorf("method %s is not allowed", r.Method))
+}
+
+// httpNotFound responds to requests of unknown routes.
+func httpNotFound(w http.ResponseWriter, r *http.Request) {
+	httpWriteError(httpLogger(r), w, r, http.StatusNotFound,
+		fmt.Errorf("path '%s' is not found", r.URL.Path))
+}
+
+// acceptsErrorEnvelope returns true if the request explicitly accepts a JSON
+// response (with 'application/json', 'application/*' or '*/*').
+func acceptsErrorEnvelope(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if q, ok := params["q"]; ok && strings.TrimLeft(q, "0.") == "" {
+				continue // q=0 means "not acceptable"
+			}
+			switch mt {
+			case "application/json", "application/*", "*/*":
+				return true
+			}
+		}
+	}
+	return false
+}
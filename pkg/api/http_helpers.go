@@ -2,19 +2,31 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/cx-tracker/pkg/metrics"
+	"github.com/skycoin/cx-tracker/pkg/ratelimit"
 )
 
-func httpWriteJson(log logrus.FieldLogger, w http.ResponseWriter, _ *http.Request, code int, v interface{}) {
+func httpWriteJson(log logrus.FieldLogger, w http.ResponseWriter, r *http.Request, code int, v interface{}) {
 	// TODO: parse http.Request for flags.
 
 	b, err := json.Marshal(v)
 	if err != nil {
-		httpWriteError(log, w, http.StatusInternalServerError, err)
+		httpWriteError(log, w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -27,11 +39,6 @@ func httpWriteJson(log logrus.FieldLogger, w http.ResponseWriter, _ *http.Reques
 	return
 }
 
-func httpWriteError(log logrus.FieldLogger, w http.ResponseWriter, code int, err error) {
-	log.WithError(err).Error()
-	http.Error(w, err.Error(), code)
-}
-
 // HTTP Logger Middleware.
 
 type ctxKeyLogger int
@@ -63,3 +70,169 @@ func httpLogger(r *http.Request) logrus.FieldLogger {
 	}
 	return log
 }
+
+// HTTP Metrics Middleware.
+
+// MetricsMiddleware records the count and latency of HTTP requests per route.
+func MetricsMiddleware(m metrics.Metrics) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			route := "unknown"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			code := ww.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+
+			m.ObserveRequest(route, r.Method, code, time.Since(start))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// HTTP Read-Only Middleware.
+
+// ReadOnlyMiddleware rejects requests which may modify the tracker, as the
+// tracker is a read-only mirror of 'upstream'.
+func ReadOnlyMiddleware(upstream string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+			default:
+				err := fmt.Errorf("tracker is a read-only mirror of '%s': submit changes upstream", upstream)
+				httpWriteError(httpLogger(r), w, r, http.StatusForbidden, withReason(ReasonReadOnly, err))
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// HTTP Admin Auth Middleware.
+
+// AdminAuthMiddleware rejects requests which do not authenticate with the
+// admin bearer 'token'.
+func AdminAuthMiddleware(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			got, ok := bearerToken(r)
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cx-tracker admin"`)
+				httpWriteError(httpLogger(r), w, r, http.StatusUnauthorized,
+					withReason(ReasonUnauthorized, errors.New("invalid or missing admin token")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// bearerToken obtains the bearer token of the Authorization header of 'r'.
+// False is returned if the header does not use the Bearer scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(h, "Bearer "), true
+}
+
+// HTTP Rate Limiting.
+
+// httpAllow takes a token of the rate limit of 'key' of 'limit' kind (see
+// ratelimit.Limiter). If the limit is exceeded, the post of object 'kind' is
+// rejected with 429 and a Retry-After header, and false is returned.
+// Requests are not limited if 'l' is nil, and requests of federated trackers
+// are not limited by IP (see FederationAuthMiddleware).
+func httpAllow(l *ratelimit.Limiter, m metrics.Metrics, w http.ResponseWriter, r *http.Request, kind, limit, key string) bool {
+	if l == nil || limit == ratelimit.KindIP && isFederated(r.Context()) {
+		return true
+	}
+
+	ok, wait := l.Allow(limit, key)
+	if ok {
+		return true
+	}
+
+	m.RecordRateLimited(limit)
+	m.RecordRejection(kind, ReasonRateLimited)
+
+	retry := int(math.Ceil(wait.Seconds()))
+	if retry < 1 {
+		retry = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+
+	err := fmt.Errorf("rate limit of %s '%s' (%s) is exceeded: retry in %ds", limit, key, l.Limit(limit), retry)
+	httpWriteError(httpLogger(r), w, r, http.StatusTooManyRequests, withReason(ReasonRateLimited, err))
+	return false
+}
+
+// RealIPMiddleware sets the remote address of requests from the proxies of
+// 'trustedProxies' to the client IP of the X-Forwarded-For or X-Real-IP header.
+// The headers of other requests are ignored, as they are set by the client.
+func RealIPMiddleware(trustedProxies []string) func(next http.Handler) http.Handler {
+	trusted := make(map[string]struct{}, len(trustedProxies))
+	for _, ip := range trustedProxies {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			trusted[parsed.String()] = struct{}{}
+		}
+	}
+
+	isTrusted := func(ip string) bool {
+		parsed := net.ParseIP(strings.TrimSpace(ip))
+		if parsed == nil {
+			return false
+		}
+		_, ok := trusted[parsed.String()]
+		return ok
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if len(trusted) == 0 || !isTrusted(httpClientIP(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Proxies append to X-Forwarded-For, so the client IP is the
+			// last IP which was not appended by a trusted proxy.
+			var ip string
+			if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+				ips := strings.Split(strings.Join(xff, ","), ",")
+				for i := len(ips) - 1; i >= 0; i-- {
+					if ip = strings.TrimSpace(ips[i]); !isTrusted(ip) {
+						break
+					}
+				}
+			} else {
+				ip = strings.TrimSpace(r.Header.Get("X-Real-IP"))
+			}
+
+			if parsed := net.ParseIP(ip); parsed != nil {
+				r.RemoteAddr = parsed.String()
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// httpClientIP obtains the client IP of 'r', as set by RealIPMiddleware.
+func httpClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
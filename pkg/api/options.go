@@ -0,0 +1,107 @@
+package api
+
+import (
+	"go.etcd.io/bbolt"
+
+	"github.com/skycoin/cx-tracker/pkg/events"
+	"github.com/skycoin/cx-tracker/pkg/metrics"
+	"github.com/skycoin/cx-tracker/pkg/ratelimit"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// Option configures the HTTP router created by NewHTTPRouter.
+type Option func(*routerOptions)
+
+type routerOptions struct {
+	metrics metrics.Metrics
+	events  *events.Bus
+
+	readOnly bool
+	upstream string
+
+	adminToken string
+	db         *bbolt.DB
+
+	fedToken string
+
+	limiter        *ratelimit.Limiter
+	trustedProxies []string
+
+	peerStrategy store.PeerStrategy
+}
+
+func defaultRouterOptions() routerOptions {
+	return routerOptions{
+		metrics:      metrics.NewEmpty(),
+		peerStrategy: store.DefaultPeerStrategy,
+	}
+}
+
+// WithMetrics records request and rejection metrics with 'm'.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(o *routerOptions) {
+		if m != nil {
+			o.metrics = m
+		}
+	}
+}
+
+// WithEvents serves events of 'bus' on GET /api/events.
+func WithEvents(bus *events.Bus) Option {
+	return func(o *routerOptions) {
+		o.events = bus
+	}
+}
+
+// WithReadOnly rejects all requests which may modify the tracker, as the
+// tracker is a read-only mirror of 'upstream'.
+func WithReadOnly(upstream string) Option {
+	return func(o *routerOptions) {
+		o.readOnly = true
+		o.upstream = upstream
+	}
+}
+
+// WithAdmin serves the admin endpoints, which require the bearer 'token'.
+// Backups are taken of 'db'. Admin endpoints are not served if 'token' is
+// empty.
+func WithAdmin(token string, db *bbolt.DB) Option {
+	return func(o *routerOptions) {
+		o.adminToken = token
+		o.db = db
+	}
+}
+
+// WithFederationToken authenticates peer entries which are relayed by federated
+// trackers with the bearer 'token'. Relay paths are ignored if 'token' is empty.
+func WithFederationToken(token string) Option {
+	return func(o *routerOptions) {
+		o.fedToken = token
+	}
+}
+
+// WithRateLimiter limits the rate of spec and peer posts with 'l'.
+func WithRateLimiter(l *ratelimit.Limiter) Option {
+	return func(o *routerOptions) {
+		o.limiter = l
+	}
+}
+
+// WithTrustedProxies takes the client IP of requests from the proxy IPs of
+// 'ips' from the X-Forwarded-For or X-Real-IP header. The headers are ignored
+// for all other requests.
+func WithTrustedProxies(ips []string) Option {
+	return func(o *routerOptions) {
+		o.trustedProxies = ips
+	}
+}
+
+// WithPeerStrategy selects peers with strategy 's' when a peer query does not
+// specify a strategy.
+func WithPeerStrategy(s store.PeerStrategy) Option {
+	return func(o *routerOptions) {
+		if s != "" {
+			o.peerStrategy = s
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+)
+
+// PeerLeaveTolerance is the maximum allowed difference between the timestamp
+// of a PeerLeave and the tracker's clock.
+const PeerLeaveTolerance = time.Minute * 5
+
+// PeerLeave is a request of a peer to leave the chains it announced.
+type PeerLeave struct {
+	PublicKey cipher.PubKey `json:"public_key"`       // Public key of the leaving peer.
+	Chains    []string      `json:"chains,omitempty"` // Genesis hashes of the chains to leave (hex representation). All chains are left if empty.
+	Timestamp int64         `json:"timestamp"`        // Time of request (in seconds, UTC time).
+	Nonce     uint64        `json:"nonce"`            // Random value to differentiate requests of the same second.
+}
+
+// Hash hashes the PeerLeave.
+func (l *PeerLeave) Hash() cipher.SHA256 {
+	return cipher.SumSHA256(l.payload())
+}
+
+// ChainHashes decodes the genesis hashes of the chains to leave.
+func (l *PeerLeave) ChainHashes() ([]cipher.SHA256, error) {
+	hashes := make([]cipher.SHA256, len(l.Chains))
+	for i, hashStr := range l.Chains {
+		b, err := hex.DecodeString(hashStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode chain hash[%d] '%s': %w", i, hashStr, err)
+		}
+		if len(b) != len(cipher.SHA256{}) {
+			return nil, fmt.Errorf("chain hash[%d] '%s' is of wrong length", i, hashStr)
+		}
+		copy(hashes[i][:], b)
+	}
+	return hashes, nil
+}
+
+func (l *PeerLeave) payload() []byte {
+	b, err := json.Marshal(l)
+	if err != nil {
+		panic(err) // This should never happen.
+	}
+	return b
+}
+
+// SignedPeerLeave contains a PeerLeave alongside a signature generated by the
+// secret key of the leaving peer.
+type SignedPeerLeave struct {
+	Leave PeerLeave  `json:"leave"`
+	Sig   cipher.Sig `json:"sig"`
+}
+
+// MakeSignedPeerLeave generates a signed request for the peer of secret key
+// 'sk' to leave the chains of genesis hashes 'chains', or all chains if
+// 'chains' is empty.
+func MakeSignedPeerLeave(sk cipher.SecKey, chains []cipher.SHA256) (SignedPeerLeave, error) {
+	pk, err := sk.PubKey()
+	if err != nil {
+		return SignedPeerLeave{}, err
+	}
+
+	l := PeerLeave{
+		PublicKey: pk,
+		Timestamp: time.Now().UTC().Unix(),
+		Nonce:     binary.BigEndian.Uint64(cipher.RandByte(8)),
+	}
+	for _, hash := range chains {
+		l.Chains = append(l.Chains, hex.EncodeToString(hash[:]))
+	}
+
+	sig, err := cipher.SignPayload(l.payload(), sk)
+	if err != nil {
+		return SignedPeerLeave{}, err
+	}
+
+	return SignedPeerLeave{Leave: l, Sig: sig}, nil
+}
+
+// Verify checks the following:
+// - Leave is of public key 'pk'.
+// - Leave timestamp is within PeerLeaveTolerance of 'now'.
+// - Chain hashes are valid.
+// - Signature is valid and generated by 'pk'.
+func (sl *SignedPeerLeave) Verify(pk cipher.PubKey, now time.Time) error {
+	if sl.Leave.PublicKey != pk {
+		return fmt.Errorf("leave is of public key '%s' (expected '%s')",
+			sl.Leave.PublicKey.Hex(), pk.Hex())
+	}
+
+	ts := time.Unix(sl.Leave.Timestamp, 0)
+	if ts.Before(now.Add(-PeerLeaveTolerance)) || ts.After(now.Add(PeerLeaveTolerance)) {
+		return fmt.Errorf("leave timestamp '%d' is outside of allowed tolerance", sl.Leave.Timestamp)
+	}
+
+	if _, err := sl.Leave.ChainHashes(); err != nil {
+		return err
+	}
+
+	if err := cipher.VerifyPubKeySignedPayload(pk, sl.Sig, sl.Leave.payload()); err != nil {
+		return fmt.Errorf("failed to verify leave signature: %w", err)
+	}
+
+	return nil
+}
+
+// peerLeaves remembers the timestamps of peer leaves, so that entries signed
+// before a peer left cannot be replayed to announce the peer again. Leaves
+// are forgotten after 'window'.
+type peerLeaves struct {
+	window time.Duration
+	left   map[cipher.PubKey]peerLeaveRecord
+	mx     sync.Mutex
+}
+
+type peerLeaveRecord struct {
+	timestamp int64     // timestamp of the leave
+	expiry    time.Time // time the record is forgotten
+}
+
+func newPeerLeaves(window time.Duration) *peerLeaves {
+	return &peerLeaves{
+		window: window,
+		left:   make(map[cipher.PubKey]peerLeaveRecord),
+	}
+}
+
+// Add records the leave 'l'.
+func (pl *peerLeaves) Add(l PeerLeave, now time.Time) {
+	pl.mx.Lock()
+	defer pl.mx.Unlock()
+
+	if rec, ok := pl.left[l.PublicKey]; ok && rec.timestamp > l.Timestamp {
+		return
+	}
+	pl.left[l.PublicKey] = peerLeaveRecord{timestamp: l.Timestamp, expiry: now.Add(pl.window)}
+}
+
+// Check returns an error if 'entry' was signed before its peer last left.
+func (pl *peerLeaves) Check(entry cxspec.PeerEntry, now time.Time) error {
+	pl.mx.Lock()
+	defer pl.mx.Unlock()
+
+	for pk, rec := range pl.left {
+		if rec.expiry.Before(now) {
+			delete(pl.left, pk)
+		}
+	}
+
+	if rec, ok := pl.left[entry.PublicKey]; ok && entry.LastSeen <= rec.timestamp {
+		return fmt.Errorf("entry's 'last_seen' field '%d' is not after the peer left at '%d'",
+			entry.LastSeen, rec.timestamp)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// RelayHeader is the header of peer entry posts which are relayed between
+// federated trackers. It contains the comma-separated IDs of the trackers which
+// relayed the entry, starting from the tracker where the entry originated.
+// It is only honoured for requests which authenticate with the federation
+// token (see FederationAuthMiddleware).
+const RelayHeader = "X-CX-Tracker-Relay"
+
+type ctxKeyRelayPath int
+
+// relayPathKey defines the relay path HTTP context key.
+const relayPathKey ctxKeyRelayPath = -1
+
+type ctxKeyFederated int
+
+// federatedKey defines the HTTP context key which marks requests of
+// authenticated federated trackers.
+const federatedKey ctxKeyFederated = -1
+
+// WithRelayPath returns a copy of 'ctx' which contains the relay path of a
+// peer entry.
+func WithRelayPath(ctx context.Context, path []string) context.Context {
+	return context.WithValue(ctx, relayPathKey, path)
+}
+
+// RelayPathFromContext obtains the relay path of a peer entry from 'ctx'.
+// The path is empty if the entry was not relayed by another tracker.
+func RelayPathFromContext(ctx context.Context) []string {
+	path, _ := ctx.Value(relayPathKey).([]string)
+	return path
+}
+
+// isFederated reports whether the request of 'ctx' was authenticated as a
+// request of a federated tracker by FederationAuthMiddleware.
+func isFederated(ctx context.Context) bool {
+	federated, _ := ctx.Value(federatedKey).(bool)
+	return federated
+}
+
+// parseRelayPath parses the relay path from the RelayHeader of 'h'.
+func parseRelayPath(h http.Header) []string {
+	var path []string
+	for _, v := range h.Values(RelayHeader) {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				path = append(path, id)
+			}
+		}
+	}
+	return path
+}
+
+// FederationAuthMiddleware authenticates requests of federated trackers with
+// the bearer 'token'. The relay path of authenticated requests is parsed from
+// the RelayHeader, while it is ignored for other requests, so that clients
+// cannot spoof relays. Authenticated requests are also exempt from rate limits
+// per IP, as federated trackers relay the entries of many peers. Requests with
+// a bearer token other than 'token' are rejected. If 'token' is empty, no
+// request is authenticated.
+func FederationAuthMiddleware(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			got, ok := bearerToken(r)
+			if token == "" || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="cx-tracker federation"`)
+				httpWriteError(httpLogger(r), w, r, http.StatusUnauthorized,
+					withReason(ReasonUnauthorized, errors.New("invalid federation token")))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), federatedKey, true)
+			ctx = WithRelayPath(ctx, parseRelayPath(r.Header))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// SpecDeletionTolerance is the maximum allowed difference between the
+// timestamp of a SpecDeletion and the tracker's clock.
+const SpecDeletionTolerance = time.Minute * 5
+
+// SpecDeletion is a request to delete the chain spec of a given genesis hash.
+type SpecDeletion struct {
+	GenesisHash string `json:"genesis_hash"` // Genesis hash of chain spec to delete (hex representation).
+	Timestamp   int64  `json:"timestamp"`    // Time of request (in seconds, UTC time).
+	Nonce       uint64 `json:"nonce"`        // Random value to differentiate requests of the same second.
+}
+
+// Hash hashes the SpecDeletion.
+func (d *SpecDeletion) Hash() cipher.SHA256 {
+	b, err := json.Marshal(d)
+	if err != nil {
+		panic(err) // This should never happen.
+	}
+	return cipher.SumSHA256(b)
+}
+
+// SignedSpecDeletion contains a SpecDeletion alongside a signature generated
+// by the chain secret key of the chain spec to delete.
+type SignedSpecDeletion struct {
+	Deletion SpecDeletion `json:"deletion"`
+	Sig      string       `json:"sig"` // hex representation of signature
+}
+
+// MakeSignedSpecDeletion generates a signed request to delete the chain spec
+// of genesis hash 'hash'. The secret key should be the chain secret key.
+func MakeSignedSpecDeletion(hash cipher.SHA256, sk cipher.SecKey) (SignedSpecDeletion, error) {
+	d := SpecDeletion{
+		GenesisHash: hash.Hex(),
+		Timestamp:   time.Now().UTC().Unix(),
+		Nonce:       binary.BigEndian.Uint64(cipher.RandByte(8)),
+	}
+
+	sig, err := cipher.SignHash(d.Hash(), sk)
+	if err != nil {
+		return SignedSpecDeletion{}, err
+	}
+
+	signedD := SignedSpecDeletion{
+		Deletion: d,
+		Sig:      sig.Hex(),
+	}
+
+	return signedD, nil
+}
+
+// Verify checks the following:
+// - Deletion is for genesis hash 'hash'.
+// - Deletion timestamp is within SpecDeletionTolerance of 'now'.
+// - Signature is valid and generated by 'chainPK'.
+func (sd *SignedSpecDeletion) Verify(hash cipher.SHA256, chainPK cipher.PubKey, now time.Time) error {
+	if sd.Deletion.GenesisHash != hash.Hex() {
+		return fmt.Errorf("deletion is for genesis hash '%s' (expected '%s')",
+			sd.Deletion.GenesisHash, hash.Hex())
+	}
+
+	ts := time.Unix(sd.Deletion.Timestamp, 0)
+	if ts.Before(now.Add(-SpecDeletionTolerance)) || ts.After(now.Add(SpecDeletionTolerance)) {
+		return fmt.Errorf("deletion timestamp '%d' is outside of allowed tolerance", sd.Deletion.Timestamp)
+	}
+
+	sig, err := cipher.SigFromHex(sd.Sig)
+	if err != nil {
+		return fmt.Errorf("failed to decode deletion signature: %w", err)
+	}
+
+	if err := cipher.VerifyPubKeySignedHash(chainPK, sig, sd.Deletion.Hash()); err != nil {
+		return fmt.Errorf("failed to verify deletion signature: %w", err)
+	}
+
+	return nil
+}
+
+// ErrReplayedRequest occurs when a signed request is submitted more than once.
+var ErrReplayedRequest = errors.New("signed request has already been submitted")
+
+// replayGuard remembers hashes of signed requests so that they cannot be
+// replayed. Hashes are forgotten after 'window' as requests older than that
+// are rejected by their timestamp check.
+type replayGuard struct {
+	window time.Duration
+	seen   map[cipher.SHA256]time.Time // value: expiry
+	mx     sync.Mutex
+}
+
+func newReplayGuard(window time.Duration) *replayGuard {
+	return &replayGuard{
+		window: window,
+		seen:   make(map[cipher.SHA256]time.Time),
+	}
+}
+
+// Check records 'hash' and returns ErrReplayedRequest if it is already
+// recorded.
+func (g *replayGuard) Check(hash cipher.SHA256, now time.Time) error {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	for h, expiry := range g.seen {
+		if expiry.Before(now) {
+			delete(g.seen, h)
+		}
+	}
+
+	if _, ok := g.seen[hash]; ok {
+		return ErrReplayedRequest
+	}
+
+	g.seen[hash] = now.Add(g.window)
+	return nil
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// NextCursorHeader is the HTTP response header which contains the cursor of the
+// next page of a paginated response.
+const NextCursorHeader = "X-Next-Cursor"
+
+// Values of the 'fields' query key of GET /api/specs.
+const (
+	specFieldsFull    = "full"
+	specFieldsSummary = "summary"
+)
+
+// SpecSummary summarizes a chain spec. It omits the genesis program state and
+// the protocol and node params.
+type SpecSummary struct {
+	GenesisHash       string `json:"genesis_hash"`
+	SpecEra           string `json:"spec_era"`
+	ChainPubKey       string `json:"chain_pubkey"`
+	CoinName          string `json:"coin_name"`
+	CoinTicker        string `json:"coin_ticker"`
+	CoinHoursName     string `json:"coin_hours_name"`
+	CoinHoursTicker   string `json:"coin_hours_ticker"`
+	GenesisAddr       string `json:"genesis_address"`
+	GenesisCoinVolume uint64 `json:"genesis_coin_volume"`
+	GenesisTimestamp  uint64 `json:"genesis_timestamp"`
+	MaxCoinSupply     uint64 `json:"max_coin_supply"`
+	SpecHash          string `json:"spec_hash"`
+	Sig               string `json:"sig"`
+}
+
+func makeSpecSummary(e store.SpecEntry) SpecSummary {
+	spec := e.Spec.Spec
+
+	return SpecSummary{
+		GenesisHash:       e.GenesisHash.Hex(),
+		SpecEra:           spec.SpecEra,
+		ChainPubKey:       spec.ChainPubKey,
+		CoinName:          spec.CoinName,
+		CoinTicker:        spec.CoinTicker,
+		CoinHoursName:     spec.CoinHoursName,
+		CoinHoursTicker:   spec.CoinHoursTicker,
+		GenesisAddr:       spec.GenesisAddr,
+		GenesisCoinVolume: spec.GenesisCoinVolume,
+		GenesisTimestamp:  spec.GenesisTimestamp,
+		MaxCoinSupply:     spec.MaxCoinSupply,
+		SpecHash:          spec.SpecHash().Hex(),
+		Sig:               e.Spec.Sig,
+	}
+}
+
+// parseSpecQuery parses a store.SpecQuery from the query values of
+// GET /api/specs.
+func parseSpecQuery(q url.Values) (store.SpecQuery, error) {
+	sq := store.SpecQuery{
+		CoinTicker:  firstQueryValue(q, "coin_ticker", "ticker"),
+		CoinName:    q.Get("coin_name"),
+		ChainPubKey: q.Get("chain_pubkey"),
+		SpecEra:     q.Get("spec_era"),
+		Cursor:      q.Get("cursor"),
+	}
+
+	if limitStr := q.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			return store.SpecQuery{}, fmt.Errorf("invalid query value '%s' for 'limit'", limitStr)
+		}
+		sq.Limit = limit
+	}
+
+	if sortStr := q.Get("sort"); sortStr != "" {
+		sq.Desc = strings.HasPrefix(sortStr, "-")
+
+		field, err := store.ParseSpecSortField(strings.TrimPrefix(sortStr, "-"))
+		if err != nil {
+			return store.SpecQuery{}, err
+		}
+		sq.SortBy = field
+	}
+
+	return sq, nil
+}
+
+// firstQueryValue returns the first non-empty value of the given query keys.
+func firstQueryValue(q url.Values, keys ...string) string {
+	for _, key := range keys {
+		if v := q.Get(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// specQueryValues encodes a store.SpecQuery as query values of GET /api/specs.
+func specQueryValues(sq store.SpecQuery) url.Values {
+	q := make(url.Values)
+
+	setIf := func(key, v string) {
+		if v != "" {
+			q.Set(key, v)
+		}
+	}
+
+	setIf("coin_ticker", sq.CoinTicker)
+	setIf("coin_name", sq.CoinName)
+	setIf("chain_pubkey", sq.ChainPubKey)
+	setIf("spec_era", sq.SpecEra)
+	setIf("cursor", sq.Cursor)
+
+	if sq.Limit > 0 {
+		q.Set("limit", strconv.Itoa(sq.Limit))
+	}
+
+	if sq.SortBy != store.SortByGenesisHash || sq.Desc {
+		sortStr := string(sq.SortBy)
+		if sortStr == "" {
+			sortStr = "genesis_hash"
+		}
+		if sq.Desc {
+			sortStr = "-" + sortStr
+		}
+		q.Set("sort", sortStr)
+	}
+
+	return q
+}
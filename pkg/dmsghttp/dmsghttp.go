@@ -0,0 +1,109 @@
+// Package dmsghttp serves and requests HTTP over dmsg streams.
+package dmsghttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/dmsg/disc"
+)
+
+// DefaultPort is the default dmsg port to serve HTTP on.
+// It is also the port that is dialed when a request URL has no port.
+const DefaultPort = uint16(80)
+
+// Config configures ListenAndServe.
+type Config struct {
+	PK       cipher.PubKey // Public key of the dmsg client.
+	SK       cipher.SecKey // Secret key of the dmsg client.
+	DiscAddr string        // HTTP address of the dmsg discovery.
+	Port     uint16        // dmsg port to serve HTTP on.
+}
+
+// Check checks the config for errors.
+func (c Config) Check() error {
+	pk, err := c.SK.PubKey()
+	if err != nil {
+		return fmt.Errorf("invalid dmsg secret key: %w", err)
+	}
+	if pk != c.PK {
+		return fmt.Errorf("dmsg public key '%s' does not match secret key", c.PK)
+	}
+	if c.DiscAddr == "" {
+		return fmt.Errorf("dmsg discovery address is not set")
+	}
+	if c.Port == 0 {
+		return fmt.Errorf("dmsg port is not set")
+	}
+	return nil
+}
+
+// ListenAndServe creates a dmsg client with the given config and serves 'h' on
+// the configured dmsg port. It blocks until 'ctx' is canceled or serving fails.
+func ListenAndServe(ctx context.Context, log logrus.FieldLogger, conf Config, h http.Handler) error {
+	if err := conf.Check(); err != nil {
+		return err
+	}
+
+	dmsgC := dmsg.NewClient(conf.PK, conf.SK, disc.NewHTTP(conf.DiscAddr), dmsg.DefaultConfig())
+	defer func() {
+		if err := dmsgC.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close dmsg client.")
+		}
+	}()
+	go dmsgC.Serve(ctx)
+
+	log.WithField("disc_addr", conf.DiscAddr).Info("Connecting to dmsg network...")
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-dmsgC.Ready():
+	}
+
+	lis, err := dmsgC.Listen(conf.Port)
+	if err != nil {
+		return fmt.Errorf("failed to listen on dmsg port %d: %w", conf.Port, err)
+	}
+
+	return Serve(ctx, log, lis, h)
+}
+
+// Serve serves 'h' on a dmsg listener. It blocks until 'ctx' is canceled or
+// serving fails. The listener is closed on return.
+func Serve(ctx context.Context, log logrus.FieldLogger, lis *dmsg.Listener, h http.Handler) error {
+	srv := &http.Server{Handler: h}
+
+	go func() {
+		<-ctx.Done()
+		if err := srv.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close dmsg HTTP server.")
+		}
+	}()
+
+	log.WithField("dmsg_addr", lis.DmsgAddr()).Info("Serving HTTP over dmsg...")
+
+	if err := srv.Serve(lis); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// Transport returns a HTTP transport which dials dmsg streams with 'dmsgC'.
+// Request URLs have the form 'http://<public-key>[:<port>]/<path>'.
+func Transport(dmsgC *dmsg.Client) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			var dAddr dmsg.Addr
+			if err := dAddr.Set(addr); err != nil {
+				return nil, fmt.Errorf("invalid dmsg address '%s': %w", addr, err)
+			}
+			return dmsgC.Dial(ctx, dAddr)
+		},
+	}
+}
@@ -0,0 +1,171 @@
+package dmsghttp
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/dmsg/disc"
+	scipher "github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func TestServe(t *testing.T) {
+	const port = uint16(8080)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dc := disc.NewMock(0)
+	startDmsgServer(t, dc)
+
+	// Serve the tracker over dmsg.
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestServe_%d.db", time.Now().UnixNano()))
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	}()
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+	ps := store.NewMemoryPeersStore(time.Minute, 10)
+
+	trackerC := startDmsgClient(t, ctx, dc)
+	lis, err := trackerC.Listen(port)
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- Serve(ctx, logrus.New(), lis, api.NewHTTPRouter(ss, ps)) }()
+
+	// A node without a public IP talks to the tracker via dmsg.
+	nodeC := startDmsgClient(t, ctx, dc)
+	httpC := &http.Client{Transport: Transport(nodeC), Timeout: 10 * time.Second}
+	trackerAddr := fmt.Sprintf("http://%s:%d", trackerC.LocalPK(), port)
+	c := api.NewClient(logrus.New(), httpC, trackerAddr)
+
+	spec, chainHash := testSpec(t)
+	require.NoError(t, c.PostSpec(ctx, spec))
+
+	spec2, err := c.SpecByGenesisHash(ctx, chainHash)
+	require.NoError(t, err)
+	require.Equal(t, spec.Sig, spec2.Sig)
+
+	entry := testPeerEntry(t, chainHash, nodeC.LocalPK())
+	require.NoError(t, c.UpdatePeerEntry(ctx, entry))
+
+	peers, err := c.PeersOfChainHash(ctx, chainHash)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	require.Equal(t, nodeC.LocalPK(), peers[0].DmsgAddr.PK)
+
+	// Stopping the context stops serving without error.
+	cancel()
+	select {
+	case err := <-serveErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serving did not stop")
+	}
+}
+
+func TestConfig_Check(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	otherPK, _ := cipher.GenerateKeyPair()
+
+	valid := Config{PK: pk, SK: sk, DiscAddr: dmsg.DefaultDiscAddr, Port: DefaultPort}
+	require.NoError(t, valid.Check())
+
+	for _, conf := range []Config{
+		{PK: otherPK, SK: sk, DiscAddr: dmsg.DefaultDiscAddr, Port: DefaultPort},
+		{PK: pk, DiscAddr: dmsg.DefaultDiscAddr, Port: DefaultPort},
+		{PK: pk, SK: sk, Port: DefaultPort},
+		{PK: pk, SK: sk, DiscAddr: dmsg.DefaultDiscAddr},
+	} {
+		require.Error(t, conf.Check())
+	}
+}
+
+func startDmsgServer(t *testing.T, dc disc.APIClient) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := dmsg.NewServer(pk, sk, dc, nil, nil)
+	go func() { _ = srv.Serve(lis, "") }()
+	t.Cleanup(func() { assert.NoError(t, srv.Close()) })
+
+	select {
+	case <-srv.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("dmsg server is not ready")
+	}
+}
+
+func startDmsgClient(t *testing.T, ctx context.Context, dc disc.APIClient) *dmsg.Client {
+	pk, sk := cipher.GenerateKeyPair()
+
+	dmsgC := dmsg.NewClient(pk, sk, dc, nil)
+	go dmsgC.Serve(ctx)
+	t.Cleanup(func() { assert.NoError(t, dmsgC.Close()) })
+
+	select {
+	case <-dmsgC.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("dmsg client is not ready")
+	}
+
+	// The dmsg server drops sessions which receive stream data within the
+	// same read as the session handshake, so let the handshake settle.
+	time.Sleep(100 * time.Millisecond)
+
+	return dmsgC
+}
+
+func testSpec(t *testing.T) (cxspec.SignedChainSpec, scipher.SHA256) {
+	pk, sk := scipher.GenerateKeyPair()
+
+	spec, err := cxspec.New("dmsgcoin", "DMSG", sk, scipher.AddressFromPubKey(pk), nil)
+	require.NoError(t, err)
+
+	signedSpec, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+
+	block, err := spec.GenerateGenesisBlock()
+	require.NoError(t, err)
+
+	return signedSpec, block.HashHeader()
+}
+
+func testPeerEntry(t *testing.T, chainHash scipher.SHA256, dmsgPK cipher.PubKey) cxspec.SignedPeerEntry {
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chainHash[:]): {DmsgAddr: dmsg.Addr{PK: dmsgPK, Port: 6001}},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry
+}
@@ -0,0 +1,224 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bus defaults.
+const (
+	DefaultHistory    = 1024 // Number of recent events kept for resuming subscriptions.
+	DefaultSubBufSize = 64   // Number of events buffered per subscription.
+)
+
+var (
+	// ErrInvalidToken occurs when a resume token cannot be parsed.
+	ErrInvalidToken = errors.New("invalid resume token")
+
+	// ErrTokenExpired occurs when events after a resume token are no longer
+	// kept by the bus (or the token is of a previous bus instance). The
+	// subscriber should reload state before subscribing without a token.
+	ErrTokenExpired = errors.New("resume token expired")
+
+	// ErrSlowSubscriber occurs when a subscription is dropped because its
+	// buffer is full. The subscriber may resume with the last received token.
+	ErrSlowSubscriber = errors.New("subscription dropped as subscriber is too slow")
+)
+
+// Bus publishes events to subscriptions. Recent events are kept so that
+// subscriptions can resume from the resume token (ID) of the last received
+// event.
+type Bus struct {
+	epoch   string // identifies the bus instance within resume tokens
+	seq     uint64 // sequence number of the last published event
+	history []Event
+	next    int // index of 'history' to write the next event to
+	subBuf  int
+	subs    map[*Subscription]struct{}
+	mx      sync.Mutex
+}
+
+// NewBus creates a new Bus which keeps up to 'history' recent events.
+func NewBus(history int) *Bus {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+
+	return &Bus{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		history: make([]Event, 0, history),
+		subBuf:  DefaultSubBufSize,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish publishes an event of type 't' for chain 'chain' (genesis hash in hex
+// representation). The published event is returned.
+func (b *Bus) Publish(t Type, chain string, data interface{}) Event {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.seq++
+	e := Event{
+		ID:    b.token(b.seq),
+		Type:  t,
+		Time:  time.Now().Unix(),
+		Chain: chain,
+		Data:  data,
+		seq:   b.seq,
+	}
+
+	if len(b.history) < cap(b.history) {
+		b.history = append(b.history, e)
+	} else {
+		b.history[b.next] = e
+	}
+	b.next = (b.next + 1) % cap(b.history)
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			b.drop(sub, ErrSlowSubscriber)
+		}
+	}
+
+	return e
+}
+
+// Subscribe subscribes to events selected by 'f'. If 'token' is not empty,
+// kept events published after the event of 'token' are delivered first.
+func (b *Bus) Subscribe(token string, f Filter) (*Subscription, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var backlog []Event
+	if token != "" {
+		after, err := b.parseToken(token)
+		if err != nil {
+			return nil, err
+		}
+
+		if oldest := b.oldestSeq(); after+1 < oldest {
+			return nil, fmt.Errorf("%w: events after '%s' are no longer kept", ErrTokenExpired, token)
+		}
+
+		for _, e := range b.ordered() {
+			if e.seq > after && f.Match(e) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		bus:    b,
+		filter: f,
+		ch:     make(chan Event, len(backlog)+b.subBuf),
+	}
+	for _, e := range backlog {
+		sub.ch <- e
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// SubscriptionCount returns the number of active subscriptions.
+func (b *Bus) SubscriptionCount() int {
+	b.mx.Lock()
+	n := len(b.subs)
+	b.mx.Unlock()
+
+	return n
+}
+
+// drop removes 'sub' and closes its channel. The caller is expected to hold
+// the lock.
+func (b *Bus) drop(sub *Subscription, err error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.ch)
+}
+
+// token returns the resume token of sequence number 'seq'.
+func (b *Bus) token(seq uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, seq)
+}
+
+// parseToken returns the sequence number of 'token'. The caller is expected
+// to hold the lock.
+func (b *Bus) parseToken(token string) (uint64, error) {
+	i := strings.LastIndexByte(token, '-')
+	if i < 0 {
+		return 0, fmt.Errorf("%w '%s'", ErrInvalidToken, token)
+	}
+
+	seq, err := strconv.ParseUint(token[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w '%s'", ErrInvalidToken, token)
+	}
+
+	if token[:i] != b.epoch {
+		return 0, fmt.Errorf("%w: token '%s' is of a previous tracker instance", ErrTokenExpired, token)
+	}
+	if seq > b.seq {
+		return 0, fmt.Errorf("%w '%s'", ErrInvalidToken, token)
+	}
+
+	return seq, nil
+}
+
+// oldestSeq returns the sequence number of the oldest kept event. The caller
+// is expected to hold the lock.
+func (b *Bus) oldestSeq() uint64 {
+	return b.seq - uint64(len(b.history)) + 1
+}
+
+// ordered returns kept events from oldest to newest. The caller is expected to
+// hold the lock.
+func (b *Bus) ordered() []Event {
+	if len(b.history) < cap(b.history) {
+		return b.history
+	}
+	return append(append([]Event(nil), b.history[b.next:]...), b.history[:b.next]...)
+}
+
+// Subscription receives events of a Bus.
+type Subscription struct {
+	bus    *Bus
+	filter Filter
+	ch     chan Event
+	err    error
+}
+
+// Events returns the channel which receives events. The channel is closed when
+// the subscription is closed or dropped.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Err returns why the subscription was dropped (if it was dropped).
+func (s *Subscription) Err() error {
+	s.bus.mx.Lock()
+	err := s.err
+	s.bus.mx.Unlock()
+
+	return err
+}
+
+// Close closes the subscription.
+func (s *Subscription) Close() {
+	s.bus.mx.Lock()
+	s.bus.drop(s, nil)
+	s.bus.mx.Unlock()
+}
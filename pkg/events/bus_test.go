@@ -0,0 +1,143 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	const history = 8
+
+	bus := NewBus(history)
+
+	t.Run("filter", func(t *testing.T) {
+		sub, err := bus.Subscribe("", Filter{Chains: []string{"a"}, Types: []Type{TypePeerUpdated}})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		bus.Publish(TypePeerUpdated, "b", nil)
+		bus.Publish(TypeSpecAdded, "a", nil)
+		e := bus.Publish(TypePeerUpdated, "a", nil)
+
+		require.Equal(t, e, receive(t, sub))
+		requireNoEvent(t, sub)
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		first := bus.Publish(TypeSpecAdded, "c", nil)
+		var exp []Event
+		for i := 0; i < history/2; i++ {
+			exp = append(exp, bus.Publish(TypeSpecAdded, "c", nil))
+		}
+
+		sub, err := bus.Subscribe(first.ID, Filter{Chains: []string{"c"}})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		for _, e := range exp {
+			require.Equal(t, e, receive(t, sub))
+		}
+		requireNoEvent(t, sub)
+
+		// Newly published events follow the backlog.
+		e := bus.Publish(TypeSpecDeleted, "c", nil)
+		require.Equal(t, e, receive(t, sub))
+	})
+
+	t.Run("resume_latest", func(t *testing.T) {
+		last := bus.Publish(TypeSpecAdded, "d", nil)
+
+		sub, err := bus.Subscribe(last.ID, Filter{})
+		require.NoError(t, err)
+		defer sub.Close()
+
+		requireNoEvent(t, sub)
+	})
+
+	t.Run("token_expired", func(t *testing.T) {
+		first := bus.Publish(TypeSpecAdded, "e", nil)
+		for i := 0; i <= history; i++ {
+			bus.Publish(TypeSpecAdded, "e", nil)
+		}
+
+		_, err := bus.Subscribe(first.ID, Filter{})
+		require.True(t, errors.Is(err, ErrTokenExpired), err)
+
+		// Tokens of a previous bus instance cannot be resumed from.
+		prev := NewBus(history).Publish(TypeSpecAdded, "e", nil)
+		time.Sleep(time.Millisecond)
+		_, err = NewBus(history).Subscribe(prev.ID, Filter{})
+		require.True(t, errors.Is(err, ErrTokenExpired), err)
+	})
+
+	t.Run("invalid_token", func(t *testing.T) {
+		seq := bus.Publish(TypeSpecAdded, "f", nil).seq
+
+		for _, token := range []string{"invalid", bus.epoch + "-x", bus.token(seq + 1)} {
+			_, err := bus.Subscribe(token, Filter{})
+			require.True(t, errors.Is(err, ErrInvalidToken), err)
+		}
+	})
+
+	t.Run("slow_subscriber", func(t *testing.T) {
+		sub, err := bus.Subscribe("", Filter{Chains: []string{"g"}})
+		require.NoError(t, err)
+
+		for i := 0; i <= DefaultSubBufSize; i++ {
+			bus.Publish(TypeSpecAdded, "g", nil)
+		}
+
+		n := 0
+		for range sub.Events() {
+			n++
+		}
+		require.Equal(t, DefaultSubBufSize, n)
+		require.True(t, errors.Is(sub.Err(), ErrSlowSubscriber))
+	})
+
+	require.Equal(t, 0, bus.SubscriptionCount())
+}
+
+func TestFilter_Match(t *testing.T) {
+	cases := []struct {
+		f   Filter
+		e   Event
+		exp bool
+	}{
+		{Filter{}, Event{Type: TypeSpecAdded, Chain: "a"}, true},
+		{Filter{Chains: []string{"a", "b"}}, Event{Type: TypeSpecAdded, Chain: "b"}, true},
+		{Filter{Chains: []string{"a"}}, Event{Type: TypeSpecAdded, Chain: "b"}, false},
+		{Filter{Types: []Type{TypePeerUpdated, TypePeerEvicted}}, Event{Type: TypePeerEvicted}, true},
+		{Filter{Types: []Type{TypePeerUpdated}}, Event{Type: TypeSpecAdded}, false},
+		{Filter{Chains: []string{"a"}, Types: []Type{TypeSpecAdded}}, Event{Type: TypeSpecDeleted, Chain: "a"}, false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			require.Equal(t, tc.exp, tc.f.Match(tc.e))
+		})
+	}
+}
+
+func receive(t *testing.T, sub *Subscription) Event {
+	select {
+	case e, ok := <-sub.Events():
+		require.True(t, ok, "subscription closed")
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func requireNoEvent(t *testing.T, sub *Subscription) {
+	select {
+	case e := <-sub.Events():
+		t.Fatalf("unexpected event: %v", e)
+	default:
+	}
+}
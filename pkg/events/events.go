@@ -0,0 +1,84 @@
+// Package events implements an in-process bus of chain spec and peer change
+// events.
+package events
+
+import (
+	"fmt"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+)
+
+// Type is the type of an event.
+type Type string
+
+// Event types.
+const (
+	TypeSpecAdded   Type = "spec_added"   // A chain spec is added.
+	TypeSpecRevised Type = "spec_revised" // A chain spec is revised.
+	TypeSpecDeleted Type = "spec_deleted" // A chain spec is deleted.
+	TypePeerUpdated Type = "peer_updated" // A peer announces addresses of a chain.
+	TypePeerEvicted Type = "peer_evicted" // Timed out peer addresses of a chain are garbage collected, or evicted to enforce store limits.
+	TypePeerLeft    Type = "peer_left"    // A peer leaves a chain with a signed leave.
+)
+
+// Types contains all event types.
+var Types = []Type{TypeSpecAdded, TypeSpecRevised, TypeSpecDeleted, TypePeerUpdated, TypePeerEvicted, TypePeerLeft}
+
+// ParseType parses an event Type from a string.
+func ParseType(s string) (Type, error) {
+	for _, t := range Types {
+		if Type(s) == t {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("invalid event type '%s'", s)
+}
+
+// Event is a change of a chain spec or of the peers of a chain.
+type Event struct {
+	ID    string      `json:"id"`             // Resume token of the event.
+	Type  Type        `json:"type"`           // Type of the event.
+	Time  int64       `json:"time"`           // Unix timestamp of when the event was published.
+	Chain string      `json:"chain"`          // Genesis hash of the chain (hex representation).
+	Data  interface{} `json:"data,omitempty"` // SpecData, PeerData or nil.
+
+	seq uint64 // sequence number within the bus
+}
+
+// SpecData is the data of spec events. Spec is not set for TypeSpecDeleted.
+type SpecData struct {
+	Revision uint64                  `json:"revision,omitempty"`
+	Spec     *cxspec.SignedChainSpec `json:"spec,omitempty"`
+}
+
+// PeerData is the data of peer events. PublicKey is not set for
+// TypePeerEvicted as evicted addresses are not associated with a peer entry.
+type PeerData struct {
+	PublicKey *cipher.PubKey            `json:"public_key,omitempty"`
+	Addrs     []cxspec.CXChainAddresses `json:"addrs"`
+}
+
+// Filter selects events by chain and type. Empty fields match all events.
+type Filter struct {
+	Chains []string // Genesis hashes (hex representation).
+	Types  []Type
+}
+
+// Match returns whether 'e' is selected by the filter.
+func (f Filter) Match(e Event) bool {
+	return matchAny(len(f.Chains), func(i int) bool { return f.Chains[i] == e.Chain }) &&
+		matchAny(len(f.Types), func(i int) bool { return f.Types[i] == e.Type })
+}
+
+func matchAny(n int, match func(i int) bool) bool {
+	if n == 0 {
+		return true
+	}
+	for i := 0; i < n; i++ {
+		if match(i) {
+			return true
+		}
+	}
+	return false
+}
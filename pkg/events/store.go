@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+	scipher "github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// SpecStore wraps a store.SpecStore so that successful changes are published
+// to a Bus.
+type SpecStore struct {
+	store.SpecStore
+	bus *Bus
+}
+
+// WrapSpecStore wraps 'ss' to publish events to 'bus'.
+func WrapSpecStore(ss store.SpecStore, bus *Bus) *SpecStore {
+	return &SpecStore{SpecStore: ss, bus: bus}
+}
+
+// AddSpec implements store.SpecStore.
+func (s *SpecStore) AddSpec(ctx context.Context, spec cxspec.SignedChainSpec) error {
+	if err := s.SpecStore.AddSpec(ctx, spec); err != nil {
+		return err
+	}
+
+	if hash, err := store.SpecGenesisHash(spec); err == nil {
+		s.bus.Publish(TypeSpecAdded, hash.Hex(), SpecData{Revision: 1, Spec: &spec})
+	}
+	return nil
+}
+
+// ReviseSpec implements store.SpecStore.
+func (s *SpecStore) ReviseSpec(ctx context.Context, spec cxspec.SignedChainSpec) (uint64, error) {
+	rev, err := s.SpecStore.ReviseSpec(ctx, spec)
+	if err != nil {
+		return rev, err
+	}
+
+	if hash, err := store.SpecGenesisHash(spec); err == nil {
+		s.bus.Publish(TypeSpecRevised, hash.Hex(), SpecData{Revision: rev, Spec: &spec})
+	}
+	return rev, nil
+}
+
+// DelSpec implements store.SpecStore.
+func (s *SpecStore) DelSpec(ctx context.Context, hash scipher.SHA256) error {
+	if err := s.SpecStore.DelSpec(ctx, hash); err != nil {
+		return err
+	}
+
+	s.bus.Publish(TypeSpecDeleted, hash.Hex(), nil)
+	return nil
+}
+
+// PeersStore wraps a store.PeersStore so that peer updates and evictions are
+// published to a Bus.
+type PeersStore struct {
+	store.PeersStore
+	bus *Bus
+
+	onEvict store.EvictionHandler
+	mx      sync.Mutex
+}
+
+// WrapPeersStore wraps 'ps' to publish events to 'bus'. The eviction handler of
+// 'ps' is replaced, use SetEvictionHandler of the returned store instead.
+func WrapPeersStore(ps store.PeersStore, bus *Bus) *PeersStore {
+	s := &PeersStore{PeersStore: ps, bus: bus}
+	ps.SetEvictionHandler(s.evicted)
+	return s
+}
+
+// UpdateEntry implements store.PeersStore.
+func (s *PeersStore) UpdateEntry(ctx context.Context, entry cxspec.SignedPeerEntry) error {
+	if err := s.PeersStore.UpdateEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	pk := entry.Entry.PublicKey
+	for hashStr, addrs := range entry.Entry.CXChains {
+		s.bus.Publish(TypePeerUpdated, hashStr, PeerData{
+			PublicKey: &pk,
+			Addrs:     []cxspec.CXChainAddresses{addrs},
+		})
+	}
+	return nil
+}
+
+// RemoveEntry implements store.PeersStore.
+func (s *PeersStore) RemoveEntry(ctx context.Context, pk cipher.PubKey, chains []cipher.SHA256) (map[cipher.SHA256]cxspec.CXChainAddresses, error) {
+	removed, err := s.PeersStore.RemoveEntry(ctx, pk, chains)
+	if err != nil {
+		return nil, err
+	}
+
+	for hash, addrs := range removed {
+		s.bus.Publish(TypePeerLeft, hex.EncodeToString(hash[:]), PeerData{
+			PublicKey: &pk,
+			Addrs:     []cxspec.CXChainAddresses{addrs},
+		})
+	}
+	return removed, nil
+}
+
+// SetEvictionHandler implements store.PeersStore. 'h' is called after the
+// eviction is published.
+func (s *PeersStore) SetEvictionHandler(h store.EvictionHandler) {
+	s.mx.Lock()
+	s.onEvict = h
+	s.mx.Unlock()
+}
+
+func (s *PeersStore) evicted(hash cipher.SHA256, evicted []cxspec.CXChainAddresses) {
+	s.bus.Publish(TypePeerEvicted, hex.EncodeToString(hash[:]), PeerData{Addrs: evicted})
+
+	s.mx.Lock()
+	onEvict := s.onEvict
+	s.mx.Unlock()
+
+	if onEvict != nil {
+		onEvict(hash, evicted)
+	}
+}
@@ -0,0 +1,589 @@
+// Package federation replicates chain specs and peer entries between
+// cx-tracker instances.
+//
+// Chain specs are pulled from peer trackers, and fresh peer entries are relayed
+// to peer trackers. As chain specs and peer entries are signed, federated
+// trackers do not need to trust each other with their contents. Relays are
+// authenticated with a federation token shared by the federated trackers, so
+// that clients cannot spoof the relay path of a peer entry.
+//
+// Peer leaves are not relayed: a peer which leaves its chains is only removed
+// from the tracker which received the leave, while federated trackers keep it
+// until its entry times out.
+package federation
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// Default config values.
+const (
+	DefaultPullInterval = time.Minute * 5
+	DefaultMaxHops      = 3
+	DefaultTimeout      = time.Second * 30
+)
+
+const (
+	pullPageSize   = 100 // number of chain spec summaries obtained per request
+	relayQueueSize = 256 // number of peer entries queued per peer tracker
+)
+
+// Config configures the Federation.
+type Config struct {
+	ID           string        // ID of this tracker within relay paths.
+	Peers        []string      // HTTP addresses of peer trackers.
+	PullInterval time.Duration // Duration between pulling chain specs from peer trackers.
+	MaxHops      int           // Maximum number of trackers that relay a peer entry.
+	Timeout      time.Duration // Timeout of requests to peer trackers.
+	Token        string        // Federation token which authenticates relays to peer trackers.
+}
+
+// DefaultConfig returns the default values for Config.
+// A random ID is generated.
+func DefaultConfig() Config {
+	return Config{
+		ID:           RandID(),
+		PullInterval: DefaultPullInterval,
+		MaxHops:      DefaultMaxHops,
+		Timeout:      DefaultTimeout,
+	}
+}
+
+// RandID generates a random tracker ID.
+func RandID() string {
+	return hex.EncodeToString(cipher.RandByte(8))
+}
+
+// Check checks the config for errors.
+func (c Config) Check() error {
+	if c.ID == "" {
+		return errors.New("federation ID is not set")
+	}
+	if strings.ContainsAny(c.ID, ", ") {
+		return fmt.Errorf("federation ID '%s' cannot contain commas or spaces", c.ID)
+	}
+	for _, addr := range c.Peers {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("invalid peer tracker address '%s': %w", addr, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("peer tracker address '%s' should have the form 'http://host:port'", addr)
+		}
+	}
+	if c.MaxHops < 1 {
+		return fmt.Errorf("max hops should be at least 1")
+	}
+	return nil
+}
+
+// PeerStatus contains bookkeeping of a peer tracker.
+type PeerStatus struct {
+	Addr           string `json:"addr"`
+	LastPull       int64  `json:"last_pull,omitempty"` // Unix timestamp of the last finished pull.
+	LastPullError  string `json:"last_pull_error,omitempty"`
+	SpecsImported  uint64 `json:"specs_imported"` // Chain specs pulled and added to the local store.
+	SpecsRevised   uint64 `json:"specs_revised"`  // Newer revisions of local chain specs pulled and stored.
+	SpecsRejected  uint64 `json:"specs_rejected"` // Chain specs which failed verification or admission.
+	EntriesRelayed uint64 `json:"entries_relayed"`
+	EntriesKnown   uint64 `json:"entries_known"` // Relayed entries which the peer tracker already had.
+	RelayErrors    uint64 `json:"relay_errors"`
+	RelayDropped   uint64 `json:"relay_dropped"` // Entries dropped as the relay queue is full.
+	LastRelayError string `json:"last_relay_error,omitempty"`
+}
+
+// OriginStatus contains bookkeeping of peer entries per origin tracker (the
+// tracker where the peer entries were first posted).
+type OriginStatus struct {
+	Origin          string `json:"origin"`
+	EntriesReceived uint64 `json:"entries_received"`
+	LoopsSuppressed uint64 `json:"loops_suppressed"` // Entries which were relayed back to this tracker.
+	HopsExceeded    uint64 `json:"hops_exceeded"`    // Entries not relayed further due to MaxHops.
+	LastReceived    int64  `json:"last_received"`    // Unix timestamp.
+}
+
+// Status is the status of the Federation.
+type Status struct {
+	ID      string         `json:"id"`
+	Peers   []PeerStatus   `json:"peers"`
+	Origins []OriginStatus `json:"origins"`
+}
+
+// Federation pulls chain specs from peer trackers and relays peer entries to
+// peer trackers.
+type Federation struct {
+	log   logrus.FieldLogger
+	conf  Config
+	ss    store.SpecStore
+	peers []*peerTracker
+
+	origins map[string]*OriginStatus
+	deleted map[cipher.SHA256]map[string]struct{} // key: genesis hash, value: signatures of deleted revisions
+	mx      sync.Mutex
+}
+
+type peerTracker struct {
+	c      *api.Client
+	relayQ chan relayJob
+	status PeerStatus // guarded by Federation.mx
+}
+
+type relayJob struct {
+	entry cxspec.SignedPeerEntry
+	path  []string
+}
+
+// New creates a new Federation which adds pulled chain specs to 'ss'.
+func New(log logrus.FieldLogger, conf Config, ss store.SpecStore) (*Federation, error) {
+	if log == nil {
+		l := logrus.New()
+		l.Level = logrus.FatalLevel
+		log = l
+	}
+	if conf.PullInterval <= 0 {
+		conf.PullInterval = DefaultPullInterval
+	}
+	if conf.MaxHops == 0 {
+		conf.MaxHops = DefaultMaxHops
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultTimeout
+	}
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+
+	httpC := &http.Client{Timeout: conf.Timeout}
+
+	peers := make([]*peerTracker, len(conf.Peers))
+	for i, addr := range conf.Peers {
+		peers[i] = &peerTracker{
+			c:      api.NewClient(log, httpC, addr),
+			relayQ: make(chan relayJob, relayQueueSize),
+			status: PeerStatus{Addr: addr},
+		}
+	}
+
+	return &Federation{
+		log:     log,
+		conf:    conf,
+		ss:      ss,
+		peers:   peers,
+		origins: make(map[string]*OriginStatus),
+		deleted: make(map[cipher.SHA256]map[string]struct{}),
+	}, nil
+}
+
+// ID returns the ID of this tracker.
+func (f *Federation) ID() string {
+	return f.conf.ID
+}
+
+// Run relays peer entries, and pulls chain specs every interval until the
+// context is canceled.
+func (f *Federation) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(len(f.peers))
+	for _, p := range f.peers {
+		go func(p *peerTracker) {
+			defer wg.Done()
+			f.relayLoop(ctx, p)
+		}(p)
+	}
+	defer wg.Wait()
+
+	t := time.NewTicker(f.conf.PullInterval)
+	defer t.Stop()
+
+	for {
+		start := time.Now()
+		f.PullAll(ctx)
+		f.log.WithField("elapsed", time.Since(start)).Debug("Finished pulling chain specs.")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// PullAll pulls chain specs from all peer trackers.
+func (f *Federation) PullAll(ctx context.Context) {
+	for _, p := range f.peers {
+		err := f.pull(ctx, p)
+
+		f.mx.Lock()
+		p.status.LastPull = time.Now().Unix()
+		p.status.LastPullError = ""
+		if err != nil {
+			p.status.LastPullError = err.Error()
+		}
+		f.mx.Unlock()
+
+		if err != nil {
+			f.log.WithError(err).
+				WithField("peer", p.status.Addr).
+				Warn("Failed to pull chain specs from peer tracker.")
+		}
+	}
+}
+
+// pull adds the chain specs of a peer tracker which are missing locally, and
+// stores newer revisions of local chain specs. Only summaries are listed, and
+// full chain specs are only obtained for missing or outdated chain specs.
+func (f *Federation) pull(ctx context.Context, p *peerTracker) error {
+	q := store.SpecQuery{Limit: pullPageSize}
+
+	for {
+		summaries, next, err := p.c.QuerySpecSummaries(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, sum := range summaries {
+			if err := f.pullSpec(ctx, p, sum); err != nil {
+				f.mx.Lock()
+				p.status.SpecsRejected++
+				f.mx.Unlock()
+
+				f.log.WithError(err).
+					WithField("peer", p.status.Addr).
+					WithField("genesis_hash", sum.GenesisHash).
+					Warn("Rejected chain spec of peer tracker.")
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+		q.Cursor = next
+	}
+}
+
+// pullSpec adds the chain spec of summary 'sum' from a peer tracker if it is
+// missing locally, or revises the local chain spec if the peer tracker has a
+// newer revision. Chain specs which were deleted locally are not pulled again.
+func (f *Federation) pullSpec(ctx context.Context, p *peerTracker, sum api.SpecSummary) error {
+	hash, err := cipher.SHA256FromHex(sum.GenesisHash)
+	if err != nil {
+		return fmt.Errorf("invalid genesis hash: %w", err)
+	}
+
+	if f.isDeleted(hash, sum.Sig) {
+		return nil
+	}
+
+	local, err := f.ss.ChainSpec(ctx, hash)
+	exists := err == nil
+	switch {
+	case exists && local.Sig == sum.Sig:
+		return nil // up to date
+	case exists:
+		newer, err := f.isNewer(ctx, p, hash, local.Sig, sum.Sig)
+		if err != nil || !newer {
+			return err
+		}
+	case !errors.Is(err, store.ErrBboltObjectNotExist):
+		return err
+	}
+
+	spec, err := p.c.SpecByGenesisHash(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("failed to obtain chain spec: %w", err)
+	}
+
+	if err := spec.Verify(); err != nil {
+		return fmt.Errorf("failed to verify chain spec: %w", err)
+	}
+
+	if specHash, err := store.SpecGenesisHash(spec); err != nil {
+		return fmt.Errorf("failed to generate genesis block: %w", err)
+	} else if specHash != hash {
+		return fmt.Errorf("chain spec has genesis hash '%s'", specHash.Hex())
+	}
+
+	// The chain spec may have been revised since it was listed.
+	if spec.Sig != sum.Sig && (f.isDeleted(hash, spec.Sig) || exists && spec.Sig == local.Sig) {
+		return nil
+	}
+
+	if exists {
+		if _, err := f.ss.ReviseSpec(ctx, spec); err != nil {
+			return fmt.Errorf("failed to revise chain spec: %w", err)
+		}
+
+		f.mx.Lock()
+		p.status.SpecsRevised++
+		f.mx.Unlock()
+
+		return nil
+	}
+
+	if err := f.ss.AddSpec(ctx, spec); err != nil {
+		return fmt.Errorf("failed to add chain spec: %w", err)
+	}
+
+	f.mx.Lock()
+	p.status.SpecsImported++
+	f.mx.Unlock()
+
+	return nil
+}
+
+// isNewer reports whether the chain spec revision of signature 'sig' of a peer
+// tracker is newer than the local revision of signature 'localSig'.
+// A revision is older if it is in the local revision history, and newer if the
+// local revision is in the revision history of the peer tracker. Otherwise,
+// the histories have diverged, and the revision with the higher revision
+// number (or signature, on ties) is newer, so that all trackers converge on
+// the same revision.
+func (f *Federation) isNewer(ctx context.Context, p *peerTracker, hash cipher.SHA256, localSig, sig string) (bool, error) {
+	localRevs, err := f.ss.SpecRevisions(ctx, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to obtain local revisions: %w", err)
+	}
+	for _, rev := range localRevs {
+		if rev.Spec.Sig == sig {
+			return false, nil
+		}
+	}
+
+	peerRevs, err := p.c.SpecRevisions(ctx, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to obtain revisions: %w", err)
+	}
+	for _, rev := range peerRevs {
+		if rev.Sig == localSig {
+			return true, nil
+		}
+	}
+
+	if len(peerRevs) != len(localRevs) {
+		return len(peerRevs) > len(localRevs), nil
+	}
+	return sig > localSig, nil
+}
+
+// isDeleted reports whether the chain spec revision of genesis hash 'hash' and
+// signature 'sig' was deleted locally.
+func (f *Federation) isDeleted(hash cipher.SHA256, sig string) bool {
+	f.mx.Lock()
+	_, ok := f.deleted[hash][sig]
+	f.mx.Unlock()
+
+	return ok
+}
+
+// relayLoop relays queued peer entries to a peer tracker until the context is
+// canceled.
+func (f *Federation) relayLoop(ctx context.Context, p *peerTracker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case job := <-p.relayQ:
+			err := p.c.RelayPeerEntry(ctx, f.conf.Token, job.entry, job.path)
+
+			var hErr *api.HTTPError
+			known := errors.As(err, &hErr) && hErr.Reason == api.ReasonStale
+
+			f.mx.Lock()
+			switch {
+			case err == nil:
+				p.status.EntriesRelayed++
+			case known:
+				p.status.EntriesKnown++
+			default:
+				p.status.RelayErrors++
+				p.status.LastRelayError = err.Error()
+			}
+			f.mx.Unlock()
+
+			if err != nil && !known && ctx.Err() == nil {
+				f.log.WithError(err).
+					WithField("peer", p.status.Addr).
+					Warn("Failed to relay peer entry.")
+			}
+		}
+	}
+}
+
+// looped reports whether a peer entry of relay path 'path' was relayed back to
+// this tracker.
+func (f *Federation) looped(path []string) bool {
+	for _, id := range path {
+		if id == f.conf.ID {
+			f.mx.Lock()
+			f.origin(path).LoopsSuppressed++
+			f.mx.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// relay queues a peer entry to be relayed to all peer trackers. 'path' is the
+// relay path which the entry was received with.
+func (f *Federation) relay(entry cxspec.SignedPeerEntry, path []string) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	st := f.origin(path)
+	st.EntriesReceived++
+	st.LastReceived = time.Now().Unix()
+
+	if len(path) >= f.conf.MaxHops {
+		st.HopsExceeded++
+		return
+	}
+
+	next := append(append(make([]string, 0, len(path)+1), path...), f.conf.ID)
+	for _, p := range f.peers {
+		select {
+		case p.relayQ <- relayJob{entry: entry, path: next}:
+		default:
+			p.status.RelayDropped++
+		}
+	}
+}
+
+// origin returns the bookkeeping of the origin tracker of relay path 'path'.
+// The caller is expected to hold the lock.
+func (f *Federation) origin(path []string) *OriginStatus {
+	origin := f.conf.ID
+	if len(path) > 0 {
+		origin = path[0]
+	}
+
+	st, ok := f.origins[origin]
+	if !ok {
+		st = &OriginStatus{Origin: origin}
+		f.origins[origin] = st
+	}
+	return st
+}
+
+// Status returns the status of the federation.
+func (f *Federation) Status() Status {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	s := Status{
+		ID:      f.conf.ID,
+		Peers:   make([]PeerStatus, len(f.peers)),
+		Origins: make([]OriginStatus, 0, len(f.origins)),
+	}
+	for i, p := range f.peers {
+		s.Peers[i] = p.status
+	}
+	for _, st := range f.origins {
+		s.Origins = append(s.Origins, *st)
+	}
+
+	return s
+}
+
+// ServeHTTP serves the status of the federation as JSON.
+func (f *Federation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		api.WriteError(f.log, w, r, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(f.Status()); err != nil {
+		f.log.WithError(err).Warn("Failed to write federation status.")
+	}
+}
+
+// SpecStore wraps a store.SpecStore so that chain specs which are deleted
+// locally are not pulled from peer trackers again.
+//
+// Deleted revisions are remembered in memory. Peer trackers which still hold a
+// deleted revision are ignored for that chain spec, while newer revisions
+// signed by the chain owner are pulled as usual. As deletions are not
+// federated, they should be submitted to every federated tracker.
+type SpecStore struct {
+	store.SpecStore
+	f *Federation
+}
+
+// WrapSpecStore wraps 'ss' to remember chain specs which are deleted locally.
+func (f *Federation) WrapSpecStore(ss store.SpecStore) *SpecStore {
+	return &SpecStore{SpecStore: ss, f: f}
+}
+
+// DelSpec implements store.SpecStore.
+func (s *SpecStore) DelSpec(ctx context.Context, hash cipher.SHA256) error {
+	revs, err := s.SpecStore.SpecRevisions(ctx, hash)
+	if err != nil && !errors.Is(err, store.ErrBboltObjectNotExist) {
+		return err
+	}
+
+	if err := s.SpecStore.DelSpec(ctx, hash); err != nil {
+		return err
+	}
+
+	s.f.mx.Lock()
+	defer s.f.mx.Unlock()
+
+	sigs, ok := s.f.deleted[hash]
+	if !ok {
+		sigs = make(map[string]struct{}, len(revs))
+		s.f.deleted[hash] = sigs
+	}
+	for _, rev := range revs {
+		sigs[rev.Spec.Sig] = struct{}{}
+	}
+
+	return nil
+}
+
+// PeersStore wraps a store.PeersStore so that fresh peer entries are relayed
+// to peer trackers.
+type PeersStore struct {
+	store.PeersStore
+	f *Federation
+}
+
+// WrapPeersStore wraps 'ps' to relay fresh peer entries with the federation.
+func (f *Federation) WrapPeersStore(ps store.PeersStore) *PeersStore {
+	return &PeersStore{PeersStore: ps, f: f}
+}
+
+// UpdateEntry implements store.PeersStore. Entries which are relayed back to
+// this tracker are stored, but are not relayed again. Entries which are not
+// fresh are rejected by the underlying store, and are therefore not relayed.
+func (s *PeersStore) UpdateEntry(ctx context.Context, entry cxspec.SignedPeerEntry) error {
+	path := api.RelayPathFromContext(ctx)
+	looped := s.f.looped(path)
+
+	if err := s.PeersStore.UpdateEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	if !looped {
+		s.f.relay(entry, path)
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package federation
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func TestFederation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Trackers are federated in a line: A <-> B <-> C.
+	a, b, c := newTestTracker(t, "a"), newTestTracker(t, "b"), newTestTracker(t, "c")
+	a.federate(t, b)
+	b.federate(t, a, c)
+	c.federate(t, b)
+
+	t.Run("pull_specs", func(t *testing.T) {
+		spec, hash, _ := testSpec(t)
+		require.NoError(t, a.c.PostSpec(ctx, spec))
+
+		// Specs are pulled transitively.
+		c.f.PullAll(ctx)
+		requireHasSpec(t, c, hash, false)
+
+		b.f.PullAll(ctx)
+		requireHasSpec(t, b, hash, true)
+
+		c.f.PullAll(ctx)
+		requireHasSpec(t, c, hash, true)
+		require.Equal(t, uint64(1), c.f.Status().Peers[0].SpecsImported)
+
+		// Existing specs are not pulled again.
+		c.f.PullAll(ctx)
+		require.Equal(t, uint64(1), c.f.Status().Peers[0].SpecsImported)
+	})
+
+	t.Run("revise_specs", func(t *testing.T) {
+		spec, hash, sk := testSpec(t)
+		require.NoError(t, a.c.PostSpec(ctx, spec))
+		b.f.PullAll(ctx)
+		c.f.PullAll(ctx)
+		requireHasSpec(t, c, hash, true)
+
+		spec.Spec.Node.DefaultConnections = []string{"10.0.0.1:6001", "10.0.0.2:6001"}
+		revised, err := cxspec.MakeSignedChainSpec(spec.Spec, sk)
+		require.NoError(t, err)
+		_, err = a.c.ReviseSpec(ctx, revised)
+		require.NoError(t, err)
+
+		// Older revisions are not pulled.
+		a.f.PullAll(ctx)
+		requireSpecSig(t, a, hash, revised.Sig)
+
+		// Newer revisions are pulled transitively.
+		b.f.PullAll(ctx)
+		requireSpecSig(t, b, hash, revised.Sig)
+		require.Equal(t, uint64(1), b.f.Status().Peers[0].SpecsRevised)
+
+		c.f.PullAll(ctx)
+		requireSpecSig(t, c, hash, revised.Sig)
+		require.Equal(t, uint64(1), c.f.Status().Peers[0].SpecsRevised)
+
+		// Up to date specs are not pulled again.
+		b.f.PullAll(ctx)
+		require.Equal(t, uint64(1), b.f.Status().Peers[0].SpecsRevised)
+	})
+
+	t.Run("keep_deleted_specs", func(t *testing.T) {
+		spec, hash, sk := testSpec(t)
+		require.NoError(t, a.c.PostSpec(ctx, spec))
+		b.f.PullAll(ctx)
+		requireHasSpec(t, b, hash, true)
+
+		// Specs deleted locally are not pulled again.
+		require.NoError(t, b.c.DelSpec(ctx, hash, sk))
+		b.f.PullAll(ctx)
+		requireHasSpec(t, b, hash, false)
+
+		// Unless the chain owner signs a new revision.
+		spec.Spec.Node.DefaultConnections = []string{"10.0.0.1:6001", "10.0.0.2:6001"}
+		revised, err := cxspec.MakeSignedChainSpec(spec.Spec, sk)
+		require.NoError(t, err)
+		_, err = a.c.ReviseSpec(ctx, revised)
+		require.NoError(t, err)
+
+		b.f.PullAll(ctx)
+		requireSpecSig(t, b, hash, revised.Sig)
+	})
+
+	t.Run("reject_invalid_specs", func(t *testing.T) {
+		spec, hash, _ := testSpec(t)
+		spec.Spec.CoinName = "tampered" // invalidates the signature, but not the genesis hash
+		require.Error(t, spec.Verify())
+
+		// A malicious tracker serves the tampered spec.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/specs", func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, json.NewEncoder(w).Encode([]api.SpecSummary{{GenesisHash: hash.Hex()}}))
+		})
+		mux.HandleFunc("/api/specs/"+hash.Hex(), func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, json.NewEncoder(w).Encode(spec))
+		})
+		evil := httptest.NewServer(mux)
+		defer evil.Close()
+
+		f, err := New(logrus.New(), Config{ID: "b", Peers: []string{evil.URL}, MaxHops: 1}, b.ss)
+		require.NoError(t, err)
+
+		f.PullAll(ctx)
+		requireHasSpec(t, b, hash, false)
+
+		status := f.Status().Peers[0]
+		require.Equal(t, uint64(0), status.SpecsImported)
+		require.Equal(t, uint64(1), status.SpecsRejected)
+		require.Empty(t, status.LastPullError)
+	})
+
+	t.Run("relay_entries", func(t *testing.T) {
+		for _, tt := range []*testTracker{a, b, c} {
+			go tt.f.Run(ctx)
+		}
+
+		entry := testPeerEntry(t)
+		require.NoError(t, a.c.UpdatePeerEntry(ctx, entry))
+
+		for _, tt := range []*testTracker{b, c} {
+			tt := tt
+			require.Eventually(t, func() bool {
+				_, err := tt.ps.Entry(ctx, entry.Entry.PublicKey)
+				return err == nil
+			}, 5*time.Second, 10*time.Millisecond, "entry should be relayed to %s", tt.f.ID())
+		}
+
+		// B relays the entry back to A, and C relays it back to B.
+		for _, tt := range []*testTracker{a, b} {
+			tt := tt
+			require.Eventually(t, func() bool {
+				return originStatus(tt.f, "a").LoopsSuppressed == 1
+			}, 5*time.Second, 10*time.Millisecond, "loop should be suppressed by %s", tt.f.ID())
+		}
+
+		require.Equal(t, uint64(1), originStatus(a.f, "a").EntriesReceived)
+		require.Equal(t, uint64(1), originStatus(b.f, "a").EntriesReceived)
+		require.Equal(t, uint64(1), originStatus(c.f, "a").EntriesReceived)
+
+		// Stale entries are not relayed.
+		require.Error(t, a.c.UpdatePeerEntry(ctx, entry))
+		require.Equal(t, uint64(1), originStatus(a.f, "a").EntriesReceived)
+	})
+}
+
+func TestFederation_Relay(t *testing.T) {
+	conf := Config{ID: "b", Peers: []string{"http://a", "http://c"}, MaxHops: 2}
+	f, err := New(nil, conf, nil)
+	require.NoError(t, err)
+
+	entry := testPeerEntry(t)
+
+	// Local entries are relayed to all peer trackers.
+	f.relay(entry, nil)
+	for _, p := range f.peers {
+		require.Equal(t, []string{"b"}, (<-p.relayQ).path)
+	}
+
+	// Relayed entries are relayed further until the hop limit.
+	f.relay(entry, []string{"a"})
+	for _, p := range f.peers {
+		require.Equal(t, []string{"a", "b"}, (<-p.relayQ).path)
+	}
+
+	f.relay(entry, []string{"a", "c"})
+	for _, p := range f.peers {
+		require.Len(t, p.relayQ, 0)
+	}
+	require.Equal(t, uint64(1), originStatus(f, "a").HopsExceeded)
+
+	// Entries that are relayed back are suppressed.
+	require.True(t, f.looped([]string{"a", "b", "c"}))
+	require.False(t, f.looped([]string{"a", "c"}))
+	require.Equal(t, uint64(1), originStatus(f, "a").LoopsSuppressed)
+}
+
+func TestPeersStore_UpdateEntry_looped(t *testing.T) {
+	f, err := New(nil, Config{ID: "b", Peers: []string{"http://a"}, MaxHops: 3}, nil)
+	require.NoError(t, err)
+	ps := f.WrapPeersStore(store.NewMemoryPeersStore(time.Minute, 10))
+
+	// Entries which are relayed back are stored, but are not relayed again.
+	entry := testPeerEntry(t)
+	ctx := api.WithRelayPath(context.TODO(), []string{"a", "b", "c"})
+	require.NoError(t, ps.UpdateEntry(ctx, entry))
+
+	_, err = ps.Entry(context.TODO(), entry.Entry.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, f.peers[0].relayQ, 0)
+	require.Equal(t, uint64(1), originStatus(f, "a").LoopsSuppressed)
+}
+
+func TestFederation_ServeHTTP(t *testing.T) {
+	f, err := New(nil, Config{ID: "a", Peers: []string{"http://b"}, MaxHops: 1}, nil)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/federation", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status Status
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+	require.Equal(t, "a", status.ID)
+
+	// Errors are written in the same format as API errors.
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/federation", nil)
+	r.Header.Set("Accept", "application/json")
+	f.ServeHTTP(w, r)
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	var httpErr api.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&httpErr))
+	require.Equal(t, api.ReasonMethodNotAllowed, httpErr.Reason)
+}
+
+func TestConfig_Check(t *testing.T) {
+	valid := DefaultConfig()
+	valid.Peers = []string{"http://127.0.0.1:9091"}
+	require.NoError(t, valid.Check())
+
+	for _, conf := range []Config{
+		{Peers: valid.Peers, MaxHops: 1},
+		{ID: "a,b", Peers: valid.Peers, MaxHops: 1},
+		{ID: "a", Peers: []string{"127.0.0.1:9091"}, MaxHops: 1},
+		{ID: "a", Peers: valid.Peers},
+	} {
+		require.Error(t, conf.Check())
+	}
+}
+
+// testToken is the federation token of test trackers.
+const testToken = "federation-token"
+
+type testTracker struct {
+	ss  store.SpecStore
+	ps  store.PeersStore
+	f   *Federation
+	srv *httptest.Server
+	c   *api.Client
+	h   http.Handler
+}
+
+func newTestTracker(t *testing.T, id string) *testTracker {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%s_%d.db", t.Name(), id, time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	})
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	tt := &testTracker{
+		ss: ss,
+		ps: store.NewMemoryPeersStore(time.Minute, 10),
+		f:  &Federation{conf: Config{ID: id}},
+	}
+
+	// The handler is set by federate, as the addresses of peer trackers are
+	// only known once their servers are started.
+	tt.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tt.h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(tt.srv.Close)
+
+	tt.c = api.NewClient(logrus.New(), tt.srv.Client(), tt.srv.URL)
+	return tt
+}
+
+// federate sets up the federation of the tracker with 'peers'.
+func (tt *testTracker) federate(t *testing.T, peers ...*testTracker) {
+	conf := Config{
+		ID:           tt.f.conf.ID,
+		PullInterval: time.Hour,
+		MaxHops:      DefaultMaxHops,
+		Token:        testToken,
+	}
+	for _, p := range peers {
+		conf.Peers = append(conf.Peers, p.srv.URL)
+	}
+
+	f, err := New(logrus.New(), conf, tt.ss)
+	require.NoError(t, err)
+
+	tt.f = f
+	tt.h = api.NewHTTPRouter(f.WrapSpecStore(tt.ss), f.WrapPeersStore(tt.ps), api.WithFederationToken(testToken))
+}
+
+func requireHasSpec(t *testing.T, tt *testTracker, hash cipher.SHA256, has bool) {
+	_, err := tt.ss.ChainSpec(context.TODO(), hash)
+	require.Equal(t, has, err == nil, "tracker %s has spec: %v", tt.f.ID(), err)
+}
+
+func requireSpecSig(t *testing.T, tt *testTracker, hash cipher.SHA256, sig string) {
+	spec, err := tt.ss.ChainSpec(context.TODO(), hash)
+	require.NoError(t, err)
+	require.Equal(t, sig, spec.Sig, "tracker %s has revision", tt.f.ID())
+}
+
+func originStatus(f *Federation, origin string) OriginStatus {
+	for _, st := range f.Status().Origins {
+		if st.Origin == origin {
+			return st
+		}
+	}
+	return OriginStatus{Origin: origin}
+}
+
+func testSpec(t *testing.T) (cxspec.SignedChainSpec, cipher.SHA256, cipher.SecKey) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	spec, err := cxspec.New("fedcoin", "FED", sk, cipher.AddressFromPubKey(pk), nil)
+	require.NoError(t, err)
+
+	signedSpec, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+
+	hash, err := store.SpecGenesisHash(signedSpec)
+	require.NoError(t, err)
+
+	return signedSpec, hash, sk
+}
+
+func testPeerEntry(t *testing.T) cxspec.SignedPeerEntry {
+	pk, sk := cipher2.GenerateKeyPair()
+	chain := cipher2.SumSHA256(pk[:])
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain[:]): {TCPAddr: "127.0.0.1:6001"},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry
+}
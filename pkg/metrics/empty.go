@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewEmpty implements Metrics, but does nothing.
+func NewEmpty() Metrics {
+	return empty{}
+}
+
+type empty struct{}
+
+func (empty) Collectors() []prometheus.Collector                 { return nil }
+func (empty) ObserveRequest(_, _ string, _ int, _ time.Duration) {}
+func (empty) RecordRejection(_, _ string)                        {}
+func (empty) RecordRateLimited(_ string)                         {}
+func (empty) ObserveGC(_ time.Duration, _ int)                   {}
@@ -0,0 +1,107 @@
+// Package metrics defines the prometheus metrics of cx-tracker.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Object kinds which can be rejected.
+const (
+	KindSpec = "spec"
+	KindPeer = "peer"
+)
+
+// Metrics collects metrics for prometheus.
+type Metrics interface {
+	Collectors() []prometheus.Collector
+	ObserveRequest(route, method string, code int, elapsed time.Duration)
+	RecordRejection(kind, reason string)
+	RecordRateLimited(limit string)
+	ObserveGC(elapsed time.Duration, evicted int)
+}
+
+// New returns the default implementation of Metrics.
+func New(namespace string) Metrics {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests per route.",
+	}, []string{"route", "method", "code"})
+	requestDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests per route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	rejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_posts_total",
+		Help:      "Total number of rejected spec and peer posts.",
+	}, []string{"kind", "reason"})
+	rateLimited := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Total number of requests rejected by rate limits.",
+	}, []string{"limit"})
+	gcDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "peers_gc_duration_seconds",
+		Help:      "Duration of peers store garbage collection.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	gcEvictions := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "peers_gc_evictions_total",
+		Help:      "Total number of peer addresses evicted by garbage collection.",
+	})
+
+	return &metrics{
+		requests:        requests,
+		requestDuration: requestDuration,
+		rejections:      rejections,
+		rateLimited:     rateLimited,
+		gcDuration:      gcDuration,
+		gcEvictions:     gcEvictions,
+	}
+}
+
+type metrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	rejections      *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+	gcDuration      prometheus.Histogram
+	gcEvictions     prometheus.Counter
+}
+
+func (m *metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requests,
+		m.requestDuration,
+		m.rejections,
+		m.rateLimited,
+		m.gcDuration,
+		m.gcEvictions,
+	}
+}
+
+func (m *metrics) ObserveRequest(route, method string, code int, elapsed time.Duration) {
+	m.requests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(elapsed.Seconds())
+}
+
+func (m *metrics) RecordRejection(kind, reason string) {
+	m.rejections.WithLabelValues(kind, reason).Inc()
+}
+
+func (m *metrics) RecordRateLimited(limit string) {
+	m.rateLimited.WithLabelValues(limit).Inc()
+}
+
+func (m *metrics) ObserveGC(elapsed time.Duration, evicted int) {
+	m.gcDuration.Observe(elapsed.Seconds())
+	m.gcEvictions.Add(float64(evicted))
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// storeCollectTimeout is the maximum duration of querying the stores on scrape.
+const storeCollectTimeout = time.Second * 10
+
+// NewStoreCollector returns a collector which reports the sizes of the given
+// spec and peers stores on scrape. Either store can be nil.
+func NewStoreCollector(namespace string, ss store.SpecStore, ps store.PeersStore) prometheus.Collector {
+	return &storeCollector{
+		ss: ss,
+		ps: ps,
+		specs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "specs"),
+			"Current number of registered chain specs.",
+			nil, nil),
+		entries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "peer_entries"),
+			"Current number of peer entries.",
+			nil, nil),
+		aggregates: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "chain_aggregates"),
+			"Current number of chains with peer aggregates.",
+			nil, nil),
+		chainPeers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "chain_peers"),
+			"Current number of live peers per chain.",
+			[]string{"chain"}, nil),
+	}
+}
+
+type storeCollector struct {
+	ss store.SpecStore
+	ps store.PeersStore
+
+	specs      *prometheus.Desc
+	entries    *prometheus.Desc
+	aggregates *prometheus.Desc
+	chainPeers *prometheus.Desc
+}
+
+// Describe implements prometheus.Collector.
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.specs
+	ch <- c.entries
+	ch <- c.aggregates
+	ch <- c.chainPeers
+}
+
+// Collect implements prometheus.Collector.
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeCollectTimeout)
+	defer cancel()
+
+	// Chains of registered specs are reported with no peers, rather than not
+	// at all, if none of their peers are live.
+	chainPeers := make(map[string]int)
+
+	if c.ss != nil {
+		if n, err := c.ss.SpecCount(ctx); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.specs, prometheus.GaugeValue, float64(n))
+		} else {
+			ch <- prometheus.NewInvalidMetric(c.specs, err)
+		}
+
+		if hashes, err := c.ss.SpecHashes(ctx); err == nil {
+			for _, hash := range hashes {
+				chainPeers[hash.Hex()] = 0
+			}
+		} else {
+			ch <- prometheus.NewInvalidMetric(c.chainPeers, err)
+		}
+	}
+
+	if c.ps != nil {
+		stats, err := c.ps.Stats(ctx)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(c.entries, err)
+			return
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries))
+		ch <- prometheus.MustNewConstMetric(c.aggregates, prometheus.GaugeValue, float64(len(stats.Chains)))
+
+		for hash, n := range stats.Chains {
+			chainPeers[hex.EncodeToString(hash[:])] = n
+		}
+
+		for hash, n := range chainPeers {
+			ch <- prometheus.MustNewConstMetric(c.chainPeers, prometheus.GaugeValue, float64(n), hash)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Package mirror keeps a verified, read-only copy of the chain specs and peers
+// of an upstream cx-tracker.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// Default config values.
+const (
+	DefaultInterval    = time.Second * 30
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = time.Minute * 5
+	DefaultTimeout     = time.Second * 30
+	DefaultPeerTimeout = time.Minute * 5
+)
+
+// Config configures the Mirror.
+type Config struct {
+	Upstream    string        // HTTP address of the upstream tracker.
+	Interval    time.Duration // Duration between successful syncs.
+	MinBackoff  time.Duration // Duration before retrying the first failed sync.
+	MaxBackoff  time.Duration // Maximum duration before retrying a failed sync.
+	Timeout     time.Duration // Timeout of requests to the upstream tracker.
+	PeerTimeout time.Duration // Mirrored peers not seen upstream within this duration are removed.
+}
+
+// DefaultConfig returns the default values for Config.
+func DefaultConfig() Config {
+	return Config{
+		Interval:    DefaultInterval,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		Timeout:     DefaultTimeout,
+		PeerTimeout: DefaultPeerTimeout,
+	}
+}
+
+// Check checks the config for errors.
+func (c Config) Check() error {
+	u, err := url.Parse(c.Upstream)
+	if err != nil {
+		return fmt.Errorf("invalid upstream address '%s': %w", c.Upstream, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("upstream address '%s' should have the form 'http://host:port'", c.Upstream)
+	}
+	if c.MinBackoff > c.MaxBackoff {
+		return errors.New("min backoff cannot be larger than max backoff")
+	}
+	return nil
+}
+
+// Status is the sync status of the Mirror.
+type Status struct {
+	Upstream     string  `json:"upstream"`
+	LastSync     int64   `json:"last_sync,omitempty"`     // Unix timestamp of when the last successful sync started.
+	LagSeconds   float64 `json:"lag_seconds"`             // Seconds since the last successful sync started (-1 if never synced).
+	LastAttempt  int64   `json:"last_attempt,omitempty"`  // Unix timestamp of the last sync attempt.
+	NextAttempt  int64   `json:"next_attempt,omitempty"`  // Unix timestamp of the next sync attempt.
+	Failures     int     `json:"failures"`                // Number of consecutive failed syncs.
+	LastError    string  `json:"last_error,omitempty"`    // Error of the last failed sync.
+	Specs        int     `json:"specs"`                   // Number of chain specs mirrored by the last successful sync.
+	Chains       int     `json:"chains"`                  // Number of chains with mirrored peers.
+	SpecsRemoved int     `json:"specs_removed,omitempty"` // Number of chain specs removed by the last successful sync.
+}
+
+// Mirror periodically syncs chain specs and peers from an upstream tracker.
+type Mirror struct {
+	log  logrus.FieldLogger
+	conf Config
+	c    *cxspec.CXTrackerClient
+	ss   store.SpecStore
+	ps   *PeersStore
+
+	status   Status
+	lastSync time.Time
+	mx       sync.Mutex
+}
+
+// New creates a new Mirror which syncs chain specs into 'ss'.
+// Mirrored peers are served by the PeersStore of the Mirror.
+func New(log logrus.FieldLogger, conf Config, ss store.SpecStore) (*Mirror, error) {
+	if log == nil {
+		l := logrus.New()
+		l.Level = logrus.FatalLevel
+		log = l
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultInterval
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = DefaultMinBackoff
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = DefaultMaxBackoff
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultTimeout
+	}
+	if conf.PeerTimeout <= 0 {
+		conf.PeerTimeout = DefaultPeerTimeout
+	}
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+
+	c := cxspec.NewCXTrackerClient(log, &http.Client{Timeout: conf.Timeout}, conf.Upstream)
+
+	return &Mirror{
+		log:    log,
+		conf:   conf,
+		c:      c,
+		ss:     ss,
+		ps:     newPeersStore(c, conf.PeerTimeout),
+		status: Status{Upstream: conf.Upstream},
+	}, nil
+}
+
+// PeersStore returns the read-only peers store which serves mirrored peers.
+func (m *Mirror) PeersStore() *PeersStore {
+	return m.ps
+}
+
+// Run syncs with the upstream tracker every interval until the context is
+// canceled. Failed syncs are retried with exponential backoff.
+func (m *Mirror) Run(ctx context.Context) {
+	for {
+		wait := m.conf.Interval
+		if err := m.Sync(ctx); err != nil {
+			wait = m.backoff()
+			m.log.WithError(err).
+				WithField("upstream", m.conf.Upstream).
+				WithField("retry_in", wait).
+				Warn("Failed to sync with upstream tracker.")
+		}
+
+		m.mx.Lock()
+		m.status.NextAttempt = time.Now().Add(wait).Unix()
+		m.mx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Sync syncs chain specs and peers with the upstream tracker once.
+func (m *Mirror) Sync(ctx context.Context) error {
+	start := time.Now()
+
+	specs, removed, err := m.syncSpecs(ctx)
+	if err == nil {
+		err = m.syncPeers(ctx, specs)
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.status.LastAttempt = start.Unix()
+	if err != nil {
+		m.status.Failures++
+		m.status.LastError = err.Error()
+		return err
+	}
+
+	m.lastSync = start
+	m.status.LastSync = start.Unix()
+	m.status.Failures = 0
+	m.status.LastError = ""
+	m.status.Specs = len(specs)
+	m.status.Chains = m.ps.chainCount()
+	m.status.SpecsRemoved = removed
+	return nil
+}
+
+// syncSpecs makes the chain specs of the local store match those of the
+// upstream tracker. The genesis hashes of upstream chain specs and the number
+// of removed local chain specs are returned.
+func (m *Mirror) syncSpecs(ctx context.Context) ([]cipher.SHA256, int, error) {
+	// AllSpecs verifies the signatures of the returned chain specs.
+	upstream, err := m.c.AllSpecs(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to obtain upstream chain specs: %w", err)
+	}
+
+	hashes := make([]cipher.SHA256, 0, len(upstream))
+	keep := make(map[cipher.SHA256]struct{}, len(upstream))
+
+	for _, spec := range upstream {
+		hash, err := store.SpecGenesisHash(spec)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to generate genesis block of upstream chain spec: %w", err)
+		}
+		hashes = append(hashes, hash)
+		keep[hash] = struct{}{}
+
+		local, err := m.ss.ChainSpec(ctx, hash)
+		switch {
+		case errors.Is(err, store.ErrBboltObjectNotExist):
+			if err := m.ss.AddSpec(ctx, spec); err != nil {
+				return nil, 0, fmt.Errorf("failed to add chain spec '%s': %w", hash.Hex(), err)
+			}
+		case err != nil:
+			return nil, 0, err
+		case local.Sig != spec.Sig:
+			if _, err := m.ss.ReviseSpec(ctx, spec); err != nil {
+				return nil, 0, fmt.Errorf("failed to revise chain spec '%s': %w", hash.Hex(), err)
+			}
+		}
+	}
+
+	local, err := m.ss.ChainSpecAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	removed := 0
+	for _, spec := range local {
+		hash, err := store.SpecGenesisHash(spec)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, ok := keep[hash]; ok {
+			continue
+		}
+		if err := m.ss.DelSpec(ctx, hash); err != nil {
+			return nil, 0, fmt.Errorf("failed to delete chain spec '%s': %w", hash.Hex(), err)
+		}
+		removed++
+	}
+
+	return hashes, removed, nil
+}
+
+// syncPeers obtains the peers of the given chains from the upstream tracker.
+func (m *Mirror) syncPeers(ctx context.Context, hashes []cipher.SHA256) error {
+	for _, hash := range hashes {
+		peers, err := m.c.PeersOfChainHash(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to obtain upstream peers of chain '%s': %w", hash.Hex(), err)
+		}
+		m.ps.update(hash, peers)
+	}
+	return nil
+}
+
+// backoff returns the duration before retrying a failed sync.
+func (m *Mirror) backoff() time.Duration {
+	m.mx.Lock()
+	failures := m.status.Failures
+	m.mx.Unlock()
+
+	return backoff(failures, m.conf.MinBackoff, m.conf.MaxBackoff)
+}
+
+func backoff(failures int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Status returns the sync status of the mirror.
+func (m *Mirror) Status() Status {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	s := m.status
+	s.LagSeconds = -1
+	if !m.lastSync.IsZero() {
+		s.LagSeconds = time.Since(m.lastSync).Seconds()
+	}
+	return s
+}
+
+// ServeHTTP serves the sync status of the mirror as JSON.
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		api.WriteError(m.log, w, r, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Status()); err != nil {
+		m.log.WithError(err).Warn("Failed to write mirror status.")
+	}
+}
@@ -0,0 +1,229 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/cx-tracker/pkg/api"
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+
+	upstreamSS := newTestSpecStore(t, "upstream")
+	upstream := httptest.NewServer(api.NewHTTPRouter(upstreamSS, store.NewMemoryPeersStore(time.Minute, 10)))
+	defer upstream.Close()
+	upstreamC := api.NewClient(logrus.New(), upstream.Client(), upstream.URL)
+
+	ss := newTestSpecStore(t, "mirror")
+	m, err := New(nil, Config{Upstream: upstream.URL}, ss)
+	require.NoError(t, err)
+	ps := m.PeersStore()
+
+	require.Equal(t, float64(-1), m.Status().LagSeconds)
+
+	spec, sk, hash := testSpec(t)
+	require.NoError(t, upstreamC.PostSpec(ctx, spec))
+
+	entry := testPeerEntry(t, hash)
+	require.NoError(t, upstreamC.UpdatePeerEntry(ctx, entry))
+
+	t.Run("mirror_specs_and_peers", func(t *testing.T) {
+		require.NoError(t, m.Sync(ctx))
+
+		got, err := ss.ChainSpec(ctx, hash)
+		require.NoError(t, err)
+		require.Equal(t, spec.Sig, got.Sig)
+
+		peers, err := ps.PeersOfChain(ctx, cipher2.SHA256(hash))
+		require.NoError(t, err)
+		require.Equal(t, []cxspec.CXChainAddresses{entry.Entry.CXChains[hash.Hex()]}, peers)
+
+		gotEntry, err := ps.Entry(ctx, entry.Entry.PublicKey)
+		require.NoError(t, err)
+		require.Equal(t, entry, gotEntry)
+
+		status := m.Status()
+		require.Equal(t, 1, status.Specs)
+		require.Equal(t, 1, status.Chains)
+		require.Equal(t, 0, status.Failures)
+		require.True(t, status.LagSeconds >= 0)
+	})
+
+	t.Run("reject_writes", func(t *testing.T) {
+		err := ps.UpdateEntry(ctx, testPeerEntry(t, hash))
+		require.True(t, errors.Is(err, store.ErrReadOnly))
+	})
+
+	t.Run("mirror_revisions", func(t *testing.T) {
+		revised := spec.Spec
+		revised.Node.DefaultConnections = []string{"127.0.0.1:6001", "127.0.0.1:6002"}
+		signedRevised, err := cxspec.MakeSignedChainSpec(revised, sk)
+		require.NoError(t, err)
+
+		_, err = upstreamC.ReviseSpec(ctx, signedRevised)
+		require.NoError(t, err)
+		require.NoError(t, m.Sync(ctx))
+
+		got, err := ss.ChainSpec(ctx, hash)
+		require.NoError(t, err)
+		require.Equal(t, signedRevised.Sig, got.Sig)
+	})
+
+	t.Run("mirror_deletions", func(t *testing.T) {
+		require.NoError(t, upstreamC.DelSpec(ctx, hash, sk))
+		require.NoError(t, m.Sync(ctx))
+
+		_, err := ss.ChainSpec(ctx, hash)
+		require.True(t, errors.Is(err, store.ErrBboltObjectNotExist))
+		require.Equal(t, 0, m.Status().Specs)
+		require.Equal(t, 1, m.Status().SpecsRemoved)
+	})
+
+	t.Run("upstream_down", func(t *testing.T) {
+		lastSync := m.Status().LastSync
+		upstream.Close()
+
+		require.Error(t, m.Sync(ctx))
+		require.Error(t, m.Sync(ctx))
+
+		status := m.Status()
+		require.Equal(t, 2, status.Failures)
+		require.NotEmpty(t, status.LastError)
+		require.Equal(t, lastSync, status.LastSync)
+		require.True(t, status.LagSeconds >= 0)
+		require.Equal(t, 2*DefaultMinBackoff, m.backoff())
+	})
+
+	t.Run("expire_peers", func(t *testing.T) {
+		var evicted []cxspec.CXChainAddresses
+		ps.SetEvictionHandler(func(_ cipher2.SHA256, addrs []cxspec.CXChainAddresses) {
+			evicted = append(evicted, addrs...)
+		})
+
+		require.Equal(t, 0, ps.GarbageCollect(ctx))
+
+		ps.now = func() time.Time { return time.Now().Add(DefaultPeerTimeout * 2) }
+		require.Equal(t, 1, ps.GarbageCollect(ctx))
+		require.Len(t, evicted, 1)
+
+		chains, err := ps.Chains(ctx)
+		require.NoError(t, err)
+		require.Empty(t, chains)
+	})
+}
+
+func TestReadOnlyRouter(t *testing.T) {
+	ss := newTestSpecStore(t, "mirror")
+	m, err := New(nil, Config{Upstream: "http://127.0.0.1:1"}, ss)
+	require.NoError(t, err)
+
+	httpS := httptest.NewServer(api.NewHTTPRouter(ss, m.PeersStore(), api.WithReadOnly("http://127.0.0.1:1")))
+	defer httpS.Close()
+	httpC := api.NewClient(logrus.New(), httpS.Client(), httpS.URL)
+
+	spec, _, hash := testSpec(t)
+	for _, err := range []error{
+		httpC.PostSpec(context.TODO(), spec),
+		httpC.UpdatePeerEntry(context.TODO(), testPeerEntry(t, hash)),
+	} {
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "read-only mirror")
+	}
+
+	specs, err := httpC.AllSpecs(context.TODO())
+	require.NoError(t, err)
+	require.Empty(t, specs)
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: time.Second},
+		{failures: 2, want: 2 * time.Second},
+		{failures: 4, want: 8 * time.Second},
+		{failures: 6, want: 30 * time.Second},
+		{failures: 1000, want: 30 * time.Second},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, backoff(c.failures, time.Second, 30*time.Second), "failures: %d", c.failures)
+	}
+}
+
+func TestConfig_Check(t *testing.T) {
+	valid := DefaultConfig()
+	valid.Upstream = "http://127.0.0.1:9091"
+	require.NoError(t, valid.Check())
+
+	for _, conf := range []Config{
+		{},
+		{Upstream: "127.0.0.1:9091"},
+		{Upstream: valid.Upstream, MinBackoff: time.Minute, MaxBackoff: time.Second},
+	} {
+		require.Error(t, conf.Check())
+	}
+}
+
+func newTestSpecStore(t *testing.T, name string) store.SpecStore {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%s_%d.db", t.Name(), name, time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	})
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	return ss
+}
+
+func testSpec(t *testing.T) (cxspec.SignedChainSpec, cipher.SecKey, cipher.SHA256) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	spec, err := cxspec.New("mirrorcoin", "MIR", sk, cipher.AddressFromPubKey(pk), nil)
+	require.NoError(t, err)
+
+	signedSpec, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+
+	hash, err := store.SpecGenesisHash(signedSpec)
+	require.NoError(t, err)
+
+	return signedSpec, sk, hash
+}
+
+func testPeerEntry(t *testing.T, chain cipher.SHA256) cxspec.SignedPeerEntry {
+	pk, sk := cipher2.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			chain.Hex(): {TCPAddr: "127.0.0.1:6001"},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry
+}
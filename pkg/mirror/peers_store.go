@@ -0,0 +1,275 @@
+package mirror
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+	scipher "github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// PeersStore is a read-only store.PeersStore of peers mirrored from an
+// upstream tracker.
+//
+// The upstream tracker only serves a random sample of the peers of each chain
+// per request, so mirrored peers accumulate over syncs and are removed on
+// GarbageCollect once they are no longer seen within the peer timeout. Peer
+// entries are obtained from the upstream tracker on request.
+type PeersStore struct {
+	c       *cxspec.CXTrackerClient
+	timeout time.Duration
+	now     func() time.Time
+
+	chains map[cipher.SHA256]map[cxspec.CXChainAddresses]time.Time // value: last seen upstream
+
+	reach     store.Reachability
+	reachMode store.ReachabilityMode
+	onEvict   store.EvictionHandler
+	mx        sync.Mutex
+}
+
+func newPeersStore(c *cxspec.CXTrackerClient, timeout time.Duration) *PeersStore {
+	return &PeersStore{
+		c:       c,
+		timeout: timeout,
+		now:     time.Now,
+		chains:  make(map[cipher.SHA256]map[cxspec.CXChainAddresses]time.Time),
+	}
+}
+
+// update records that 'peers' of chain 'hash' are seen upstream.
+func (ps *PeersStore) update(hash scipher.SHA256, peers []cxspec.CXChainAddresses) {
+	now := ps.now()
+
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	chain, ok := ps.chains[cipher.SHA256(hash)]
+	if !ok {
+		chain = make(map[cxspec.CXChainAddresses]time.Time, len(peers))
+		ps.chains[cipher.SHA256(hash)] = chain
+	}
+	for _, addrs := range peers {
+		chain[addrs] = now
+	}
+}
+
+func (ps *PeersStore) chainCount() int {
+	ps.mx.Lock()
+	n := len(ps.chains)
+	ps.mx.Unlock()
+
+	return n
+}
+
+// UpdateEntry implements store.PeersStore. It always fails with
+// store.ErrReadOnly.
+func (ps *PeersStore) UpdateEntry(_ context.Context, _ cxspec.SignedPeerEntry) error {
+	return store.ErrReadOnly
+}
+
+// Entry implements store.PeersStore. The entry is obtained from the upstream
+// tracker, and is verified.
+func (ps *PeersStore) Entry(ctx context.Context, pk cipher.PubKey) (cxspec.SignedPeerEntry, error) {
+	entry, err := ps.c.PeerEntryOfPK(ctx, scipher.PubKey(pk))
+	if err != nil {
+		return cxspec.SignedPeerEntry{}, fmt.Errorf("failed to obtain entry of pk '%s' from upstream: %w", pk.Hex(), err)
+	}
+	return entry, nil
+}
+
+// RemoveEntry implements store.PeersStore. It always fails with
+// store.ErrReadOnly.
+func (ps *PeersStore) RemoveEntry(_ context.Context, _ cipher.PubKey, _ []cipher.SHA256) (map[cipher.SHA256]cxspec.CXChainAddresses, error) {
+	return nil, store.ErrReadOnly
+}
+
+// ChainsOfEntry implements store.PeersStore. Leaves are not mirrored, so all
+// chains of the upstream entry are returned.
+func (ps *PeersStore) ChainsOfEntry(ctx context.Context, pk cipher.PubKey) ([]cipher.SHA256, error) {
+	entry, err := ps.Entry(ctx, pk)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]cipher.SHA256, 0, len(entry.Entry.CXChains))
+	for hashStr := range entry.Entry.CXChains {
+		var hash cipher.SHA256
+		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+			return nil, fmt.Errorf("invalid chain of upstream entry: %w", err)
+		}
+		out = append(out, hash)
+	}
+	return out, nil
+}
+
+// UpdateStatus implements store.PeersStore. It always fails with
+// store.ErrReadOnly.
+func (ps *PeersStore) UpdateStatus(_ context.Context, _ store.SignedPeerStatus) error {
+	return store.ErrReadOnly
+}
+
+// Status implements store.PeersStore. Peer statuses are not mirrored, so no
+// status is ever returned.
+func (ps *PeersStore) Status(_ context.Context, _ cipher.PubKey) (*store.SignedPeerStatus, error) {
+	return nil, nil
+}
+
+// SetReachability implements store.PeersStore.
+func (ps *PeersStore) SetReachability(r store.Reachability, mode store.ReachabilityMode) {
+	ps.mx.Lock()
+	ps.reach = r
+	ps.reachMode = mode
+	ps.mx.Unlock()
+}
+
+// SetEvictionHandler implements store.PeersStore.
+func (ps *PeersStore) SetEvictionHandler(h store.EvictionHandler) {
+	ps.mx.Lock()
+	ps.onEvict = h
+	ps.mx.Unlock()
+}
+
+// RandPeersOfChain implements store.PeersStore.
+func (ps *PeersStore) RandPeersOfChain(ctx context.Context, hash cipher.SHA256, max int) ([]cxspec.CXChainAddresses, error) {
+	all, _ := ps.PeersOfChain(ctx, hash)
+
+	ps.mx.Lock()
+	reach, reachMode := ps.reach, ps.reachMode
+	ps.mx.Unlock()
+
+	return store.SelectReachable(all, max, reach, reachMode), nil
+}
+
+// QueryPeersOfChain implements store.PeersStore. Peer statuses are not
+// mirrored, so no peers match a non-zero q.MinHeight, and peers are ordered by
+// the last time they were seen upstream for store.StrategyFreshest.
+func (ps *PeersStore) QueryPeersOfChain(_ context.Context, hash cipher.SHA256, q store.PeerQuery) ([]cxspec.CXChainAddresses, error) {
+	ps.mx.Lock()
+	chain := ps.chains[hash]
+	infos := make([]store.PeerInfo, 0, len(chain))
+	for addrs, lastSeen := range chain {
+		infos = append(infos, store.PeerInfo{Addrs: addrs, LastSeen: lastSeen.Unix()})
+	}
+	reach, reachMode := ps.reach, ps.reachMode
+	ps.mx.Unlock()
+
+	return store.SelectPeers(infos, q, reach, reachMode)
+}
+
+// PeersOfChain implements store.PeersStore.
+func (ps *PeersStore) PeersOfChain(_ context.Context, hash cipher.SHA256) ([]cxspec.CXChainAddresses, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	chain := ps.chains[hash]
+	out := make([]cxspec.CXChainAddresses, 0, len(chain))
+	for addrs := range chain {
+		out = append(out, addrs)
+	}
+
+	return out, nil
+}
+
+// Chains implements store.PeersStore.
+func (ps *PeersStore) Chains(_ context.Context) ([]cipher.SHA256, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	out := make([]cipher.SHA256, 0, len(ps.chains))
+	for hash := range ps.chains {
+		out = append(out, hash)
+	}
+
+	return out, nil
+}
+
+// Stats implements store.PeersStore. Peer entries are not mirrored, so the
+// number of entries is always zero.
+func (ps *PeersStore) Stats(_ context.Context) (store.PeersStats, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	stats := store.PeersStats{Chains: make(map[cipher.SHA256]int, len(ps.chains))}
+	for hash, chain := range ps.chains {
+		stats.Chains[hash] = len(chain)
+	}
+
+	return stats, nil
+}
+
+// ChainStats implements store.PeersStore. Only the upstream peer lists are
+// mirrored, so FirstSeen, AnnounceRate and BestHeight are always 0, and
+// LastSeen is the last time a peer was seen upstream.
+func (ps *PeersStore) ChainStats(_ context.Context) (map[cipher.SHA256]store.ChainStats, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	out := make(map[cipher.SHA256]store.ChainStats, len(ps.chains))
+	for hash, chain := range ps.chains {
+		out[hash] = chainStats(chain)
+	}
+
+	return out, nil
+}
+
+// StatsOfChain implements store.PeersStore. As with ChainStats, FirstSeen,
+// AnnounceRate and BestHeight are always 0.
+func (ps *PeersStore) StatsOfChain(_ context.Context, hash cipher.SHA256) (store.ChainStats, bool, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	chain, ok := ps.chains[hash]
+	if !ok {
+		return store.ChainStats{}, false, nil
+	}
+
+	return chainStats(chain), true, nil
+}
+
+// chainStats returns the statistics of the mirrored peers of a chain.
+func chainStats(chain map[cxspec.CXChainAddresses]time.Time) store.ChainStats {
+	var stats store.ChainStats
+	for addrs, lastSeen := range chain {
+		stats.AddPeer(addrs, 0, lastSeen.Unix())
+	}
+	return stats
+}
+
+// GarbageCollect implements store.PeersStore. Peers which were not seen
+// upstream within the peer timeout are removed.
+func (ps *PeersStore) GarbageCollect(_ context.Context) int {
+	deadline := ps.now().Add(-ps.timeout)
+
+	ps.mx.Lock()
+	evictions := make(map[cipher.SHA256][]cxspec.CXChainAddresses)
+	evicted := 0
+	for hash, chain := range ps.chains {
+		for addrs, lastSeen := range chain {
+			if lastSeen.Before(deadline) {
+				delete(chain, addrs)
+				evictions[hash] = append(evictions[hash], addrs)
+				evicted++
+			}
+		}
+		if len(chain) == 0 {
+			delete(ps.chains, hash)
+		}
+	}
+	onEvict := ps.onEvict
+	ps.mx.Unlock()
+
+	if onEvict != nil {
+		for hash, removed := range evictions {
+			onEvict(hash, removed)
+		}
+	}
+
+	return evicted
+}
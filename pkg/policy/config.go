@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// Config configures a Policy. The zero value admits all chain specs.
+type Config struct {
+	// UniqueTicker rejects coin tickers that are registered by a different
+	// chain public key.
+	UniqueTicker bool `json:"unique_ticker"`
+
+	// UniqueCoinName rejects coin names that are registered by a different
+	// chain public key.
+	UniqueCoinName bool `json:"unique_coin_name"`
+
+	// ReservedTickers maps reserved coin tickers to the chain public keys
+	// (hex) which are allowed to use them.
+	ReservedTickers map[string][]string `json:"reserved_tickers,omitempty"`
+
+	// TickerPattern is a regular expression that coin tickers must match.
+	TickerPattern string `json:"ticker_pattern,omitempty"`
+
+	// CoinNamePattern is a regular expression that coin names must match.
+	CoinNamePattern string `json:"coin_name_pattern,omitempty"`
+
+	// MaxSpecsPerPubKey is the maximum number of chain specs per chain
+	// public key (0 for no limit).
+	MaxSpecsPerPubKey int `json:"max_specs_per_pubkey,omitempty"`
+}
+
+// LoadConfig reads a JSON encoded Config from file.
+func LoadConfig(filename string) (Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	var conf Config
+	if err := dec.Decode(&conf); err != nil {
+		return Config{}, fmt.Errorf("failed to decode policy config '%s': %w", filename, err)
+	}
+
+	return conf, nil
+}
+
+// Policy builds a Policy from the config.
+// Static rules (reserved tickers and patterns) are checked before rules which
+// query the spec store.
+func (c Config) Policy() (*Policy, error) {
+	var rules []Rule
+
+	if len(c.ReservedTickers) > 0 {
+		for ticker, pks := range c.ReservedTickers {
+			for _, pk := range pks {
+				if _, err := cipher.PubKeyFromHex(pk); err != nil {
+					return nil, fmt.Errorf("invalid chain pk '%s' for reserved ticker '%s': %w", pk, ticker, err)
+				}
+			}
+		}
+		rules = append(rules, ReservedTickers(c.ReservedTickers))
+	}
+
+	if c.TickerPattern != "" {
+		re, err := regexp.Compile(c.TickerPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ticker pattern: %w", err)
+		}
+		rules = append(rules, TickerPattern(re))
+	}
+
+	if c.CoinNamePattern != "" {
+		re, err := regexp.Compile(c.CoinNamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coin name pattern: %w", err)
+		}
+		rules = append(rules, CoinNamePattern(re))
+	}
+
+	if c.UniqueTicker {
+		rules = append(rules, UniqueTicker())
+	}
+
+	if c.UniqueCoinName {
+		rules = append(rules, UniqueCoinName())
+	}
+
+	switch {
+	case c.MaxSpecsPerPubKey < 0:
+		return nil, fmt.Errorf("max specs per pubkey cannot be negative")
+	case c.MaxSpecsPerPubKey > 0:
+		rules = append(rules, MaxSpecsPerPubKey(c.MaxSpecsPerPubKey))
+	}
+
+	return New(rules...), nil
+}
@@ -0,0 +1,114 @@
+// Package policy implements admission policies for chain specs.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// ErrRejected occurs when a chain spec is rejected by an admission policy.
+var ErrRejected = errors.New("chain spec rejected by admission policy")
+
+// Reasons of rejections.
+const (
+	ReasonDuplicateTicker   = "duplicate_ticker"
+	ReasonDuplicateCoinName = "duplicate_coin_name"
+	ReasonReservedTicker    = "reserved_ticker"
+	ReasonInvalidTicker     = "invalid_ticker"
+	ReasonInvalidCoinName   = "invalid_coin_name"
+	ReasonQuotaExceeded     = "quota_exceeded"
+)
+
+// Rejection is returned by rules which reject a chain spec.
+type Rejection struct {
+	Reason string // Machine-readable reason of the rejection.
+	Msg    string // Human-readable description of the rejection.
+}
+
+// Reject returns a new Rejection.
+func Reject(reason, format string, a ...interface{}) *Rejection {
+	return &Rejection{Reason: reason, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Error implements error.
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%v: %s", ErrRejected, r.Msg)
+}
+
+// Unwrap allows errors.Is(err, ErrRejected).
+func (r *Rejection) Unwrap() error {
+	return ErrRejected
+}
+
+// Rule checks whether a chain spec may be admitted.
+// A *Rejection should be returned if the chain spec is not admitted. Other
+// errors are treated as internal errors.
+type Rule interface {
+	Check(ctx context.Context, ss store.SpecStore, spec cxspec.ChainSpec) error
+}
+
+// RuleFunc implements Rule with a function.
+type RuleFunc func(ctx context.Context, ss store.SpecStore, spec cxspec.ChainSpec) error
+
+// Check implements Rule.
+func (f RuleFunc) Check(ctx context.Context, ss store.SpecStore, spec cxspec.ChainSpec) error {
+	return f(ctx, ss, spec)
+}
+
+// Policy is a set of rules which all need to pass for a chain spec to be
+// admitted.
+type Policy struct {
+	rules []Rule
+}
+
+// New creates a new Policy with the given rules.
+func New(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Len returns the number of rules of the policy.
+func (p *Policy) Len() int {
+	return len(p.rules)
+}
+
+// Admit checks 'spec' against all rules of the policy. The first rejection is
+// returned.
+func (p *Policy) Admit(ctx context.Context, ss store.SpecStore, spec cxspec.SignedChainSpec) error {
+	for _, r := range p.rules {
+		if err := r.Check(ctx, ss, spec.Spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpecStore wraps a store.SpecStore so that chain specs are admitted by a
+// Policy before they are added.
+type SpecStore struct {
+	store.SpecStore
+	p  *Policy
+	mx sync.Mutex // serializes admission and addition of chain specs
+}
+
+// WrapSpecStore wraps 'ss' with the policy 'p'.
+func WrapSpecStore(ss store.SpecStore, p *Policy) *SpecStore {
+	return &SpecStore{SpecStore: ss, p: p}
+}
+
+// AddSpec implements store.SpecStore.
+func (s *SpecStore) AddSpec(ctx context.Context, spec cxspec.SignedChainSpec) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if err := s.p.Admit(ctx, s.SpecStore, spec); err != nil {
+		return err
+	}
+
+	return s.SpecStore.AddSpec(ctx, spec)
+}
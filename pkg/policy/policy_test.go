@@ -0,0 +1,174 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func TestConfig_Policy(t *testing.T) {
+	ownerPK, ownerSK := cipher.GenerateKeyPair()
+	_, otherSK := cipher.GenerateKeyPair()
+
+	conf := Config{
+		UniqueTicker:      true,
+		UniqueCoinName:    true,
+		ReservedTickers:   map[string][]string{"sky": {ownerPK.Hex()}},
+		TickerPattern:     "^[A-Z0-9]{2,8}$",
+		CoinNamePattern:   "^[a-z0-9]{2,32}$",
+		MaxSpecsPerPubKey: 3,
+	}
+
+	cases := []struct {
+		name   string
+		coin   string
+		ticker string
+		sk     cipher.SecKey
+		reason string // expected rejection reason (empty if admitted)
+	}{
+		{"reserved_owner", "skycoin", "SKY", ownerSK, ""},
+		{"reserved_other", "skycoin2", "SKY", otherSK, ReasonReservedTicker},
+		{"duplicate_ticker", "other", "OWN", otherSK, ReasonDuplicateTicker},
+		{"duplicate_ticker_same_owner", "owncoin2", "OWN", ownerSK, ""},
+		{"duplicate_coin_name", "owncoin2", "OTH", otherSK, ReasonDuplicateCoinName},
+		{"invalid_ticker", "longcoin", "TOOLONGTICKER", otherSK, ReasonInvalidTicker},
+		{"invalid_coin_name", "x", "XX", otherSK, ReasonInvalidCoinName},
+		{"quota_exceeded", "owncoin3", "OWN3", ownerSK, ReasonQuotaExceeded},
+		{"admitted", "othercoin", "OTH", otherSK, ""},
+	}
+
+	p, err := conf.Policy()
+	require.NoError(t, err)
+
+	ss := WrapSpecStore(testSpecStore(t), p)
+
+	// The owner starts with one registered spec of ticker 'OWN'.
+	require.NoError(t, ss.AddSpec(context.TODO(), testSpec(t, "owncoin", "OWN", ownerSK)))
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ss.AddSpec(context.TODO(), testSpec(t, tc.coin, tc.ticker, tc.sk))
+			if tc.reason == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var rej *Rejection
+			require.True(t, errors.As(err, &rej), err)
+			require.Equal(t, tc.reason, rej.Reason)
+			require.True(t, errors.Is(err, ErrRejected))
+		})
+	}
+}
+
+func TestSpecStore_ConcurrentAdmission(t *testing.T) {
+	const n = 10
+
+	ss := WrapSpecStore(testSpecStore(t), New(UniqueTicker()))
+
+	var (
+		wg       sync.WaitGroup
+		admitted = make(chan struct{}, n)
+	)
+
+	for i := 0; i < n; i++ {
+		_, sk := cipher.GenerateKeyPair()
+		spec := testSpec(t, fmt.Sprintf("coin%d", i), "SAME", sk)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ss.AddSpec(context.TODO(), spec); err == nil {
+				admitted <- struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, admitted, 1)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadConfig")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, os.RemoveAll(dir)) }()
+
+	writeConf := func(t *testing.T, name, data string) string {
+		filename := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(filename, []byte(data), 0600))
+		return filename
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		filename := writeConf(t, "valid.json", `{"unique_ticker": true, "max_specs_per_pubkey": 2}`)
+
+		conf, err := LoadConfig(filename)
+		require.NoError(t, err)
+		require.Equal(t, Config{UniqueTicker: true, MaxSpecsPerPubKey: 2}, conf)
+
+		p, err := conf.Policy()
+		require.NoError(t, err)
+		require.Equal(t, 2, p.Len())
+	})
+
+	t.Run("unknown_field", func(t *testing.T) {
+		_, err := LoadConfig(writeConf(t, "unknown.json", `{"unique_tickers": true}`))
+		require.Error(t, err)
+	})
+
+	t.Run("invalid_values", func(t *testing.T) {
+		for _, conf := range []Config{
+			{TickerPattern: "["},
+			{CoinNamePattern: "("},
+			{ReservedTickers: map[string][]string{"SKY": {"not a pk"}}},
+			{MaxSpecsPerPubKey: -1},
+		} {
+			_, err := conf.Policy()
+			require.Error(t, err)
+		}
+	})
+}
+
+func testSpecStore(t *testing.T) store.SpecStore {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%d.db", t.Name(), time.Now().UnixNano()))
+
+	db, err := store.OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	})
+
+	ss, err := store.NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	return ss
+}
+
+// testSpec generates a signed chain spec of chain key 'sk'. A random genesis
+// address is used so that specs of the same chain key have unique genesis
+// hashes.
+func testSpec(t *testing.T, coin, ticker string, sk cipher.SecKey) cxspec.SignedChainSpec {
+	genPK, _ := cipher.GenerateKeyPair()
+
+	spec, err := cxspec.New(coin, ticker, sk, cipher.AddressFromPubKey(genPK), nil)
+	require.NoError(t, err)
+
+	signedSpec, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+
+	return signedSpec
+}
@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// UniqueTicker rejects chain specs with a coin ticker that is already used by
+// a chain spec of a different chain public key.
+func UniqueTicker() Rule {
+	return RuleFunc(func(ctx context.Context, ss store.SpecStore, spec cxspec.ChainSpec) error {
+		owner, err := otherOwner(ctx, ss, store.SpecQuery{CoinTicker: spec.CoinTicker}, spec.ChainPubKey)
+		if err != nil || owner == "" {
+			return err
+		}
+
+		return Reject(ReasonDuplicateTicker, "coin ticker '%s' is already registered by chain pk '%s'",
+			store.NormalizeCoinTicker(spec.CoinTicker), owner)
+	})
+}
+
+// UniqueCoinName rejects chain specs with a coin name that is already used by
+// a chain spec of a different chain public key.
+func UniqueCoinName() Rule {
+	return RuleFunc(func(ctx context.Context, ss store.SpecStore, spec cxspec.ChainSpec) error {
+		owner, err := otherOwner(ctx, ss, store.SpecQuery{CoinName: spec.CoinName}, spec.ChainPubKey)
+		if err != nil || owner == "" {
+			return err
+		}
+
+		return Reject(ReasonDuplicateCoinName, "coin name '%s' is already registered by chain pk '%s'",
+			store.NormalizeCoinName(spec.CoinName), owner)
+	})
+}
+
+// ReservedTickers rejects chain specs which use a reserved coin ticker. The
+// keys of 'reserved' are coin tickers, and the values are the chain public keys
+// (hex) which are allowed to use the ticker.
+func ReservedTickers(reserved map[string][]string) Rule {
+	owners := make(map[string]map[string]struct{}, len(reserved))
+	for ticker, pks := range reserved {
+		m := make(map[string]struct{}, len(pks))
+		for _, pk := range pks {
+			m[store.NormalizeChainPubKey(pk)] = struct{}{}
+		}
+		owners[store.NormalizeCoinTicker(ticker)] = m
+	}
+
+	return RuleFunc(func(_ context.Context, _ store.SpecStore, spec cxspec.ChainSpec) error {
+		ticker := store.NormalizeCoinTicker(spec.CoinTicker)
+
+		allowed, ok := owners[ticker]
+		if !ok {
+			return nil
+		}
+		if _, ok := allowed[store.NormalizeChainPubKey(spec.ChainPubKey)]; ok {
+			return nil
+		}
+
+		return Reject(ReasonReservedTicker, "coin ticker '%s' is reserved", ticker)
+	})
+}
+
+// TickerPattern rejects chain specs with a coin ticker that does not match
+// 're'.
+func TickerPattern(re *regexp.Regexp) Rule {
+	return RuleFunc(func(_ context.Context, _ store.SpecStore, spec cxspec.ChainSpec) error {
+		if re.MatchString(spec.CoinTicker) {
+			return nil
+		}
+		return Reject(ReasonInvalidTicker, "coin ticker '%s' does not match pattern '%s'", spec.CoinTicker, re)
+	})
+}
+
+// CoinNamePattern rejects chain specs with a coin name that does not match
+// 're'.
+func CoinNamePattern(re *regexp.Regexp) Rule {
+	return RuleFunc(func(_ context.Context, _ store.SpecStore, spec cxspec.ChainSpec) error {
+		if re.MatchString(spec.CoinName) {
+			return nil
+		}
+		return Reject(ReasonInvalidCoinName, "coin name '%s' does not match pattern '%s'", spec.CoinName, re)
+	})
+}
+
+// MaxSpecsPerPubKey rejects chain specs of a chain public key which already
+// has 'max' or more chain specs registered.
+func MaxSpecsPerPubKey(max int) Rule {
+	return RuleFunc(func(ctx context.Context, ss store.SpecStore, spec cxspec.ChainSpec) error {
+		page, err := ss.QuerySpecs(ctx, store.SpecQuery{ChainPubKey: spec.ChainPubKey, Limit: max})
+		if err != nil {
+			return err
+		}
+
+		if len(page.Entries) < max {
+			return nil
+		}
+
+		return Reject(ReasonQuotaExceeded, "chain pk '%s' already has %d or more chain specs registered",
+			spec.ChainPubKey, max)
+	})
+}
+
+// otherOwner returns the chain public key of a chain spec which matches 'q'
+// but is not owned by 'pk'. An empty string is returned if there are no such
+// chain specs.
+func otherOwner(ctx context.Context, ss store.SpecStore, q store.SpecQuery, pk string) (string, error) {
+	page, err := ss.QuerySpecs(ctx, q)
+	if err != nil {
+		return "", err
+	}
+
+	pk = store.NormalizeChainPubKey(pk)
+	for _, e := range page.Entries {
+		if owner := store.NormalizeChainPubKey(e.Spec.Spec.ChainPubKey); owner != pk {
+			return owner, nil
+		}
+	}
+
+	return "", nil
+}
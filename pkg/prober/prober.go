@@ -0,0 +1,307 @@
+// Package prober periodically dials the TCP addresses announced by cx chain
+// peers and records whether they are reachable.
+package prober
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+// Default config values.
+const (
+	DefaultInterval    = time.Second * 30
+	DefaultTimeout     = time.Second * 5
+	DefaultConcurrency = 16
+)
+
+// ErrNonPublicAddr is returned when a TCP address does not resolve to a
+// public address, and is therefore not dialed.
+var ErrNonPublicAddr = errors.New("address is not public")
+
+// nonPublicNets are the networks which are not dialed, on top of those which
+// are not global unicast (loopback, link-local, multicast and unspecified).
+var nonPublicNets = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // RFC1918
+	"100.64.0.0/10",  // RFC6598 shared address space
+	"172.16.0.0/12",  // RFC1918
+	"192.168.0.0/16", // RFC1918
+	"fc00::/7",       // RFC4193 unique local addresses
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, ipNet)
+	}
+	return out
+}
+
+// IsPublicIP returns true if the given IP is a global unicast address which
+// is not within a private or shared address space.
+func IsPublicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, ipNet := range nonPublicNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Result is the result of probing a TCP address.
+type Result struct {
+	Reachable   bool          `json:"reachable"`
+	Latency     time.Duration `json:"latency"`
+	LastChecked time.Time     `json:"last_checked"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Config configures the Prober.
+type Config struct {
+	Interval    time.Duration // Duration between probing rounds.
+	Timeout     time.Duration // Dial timeout of a single probe.
+	Concurrency int           // Maximum number of concurrent probes.
+	AllowLocal  bool          // Also dial loopback, link-local and private addresses.
+}
+
+// DefaultConfig returns the default values for Config.
+func DefaultConfig() Config {
+	return Config{
+		Interval:    DefaultInterval,
+		Timeout:     DefaultTimeout,
+		Concurrency: DefaultConcurrency,
+	}
+}
+
+// TargetsFunc returns the TCP addresses to probe.
+type TargetsFunc func(ctx context.Context) ([]string, error)
+
+// TargetsOfPeersStore returns a TargetsFunc which obtains the TCP addresses of
+// all peers within the given PeersStore.
+func TargetsOfPeersStore(ps store.PeersStore) TargetsFunc {
+	return func(ctx context.Context) ([]string, error) {
+		hashes, err := ps.Chains(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := make(map[string]struct{})
+		var out []string
+
+		for _, hash := range hashes {
+			peers, err := ps.PeersOfChain(ctx, hash)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, p := range peers {
+				if p.TCPAddr == "" {
+					continue
+				}
+				if _, ok := seen[p.TCPAddr]; ok {
+					continue
+				}
+				seen[p.TCPAddr] = struct{}{}
+				out = append(out, p.TCPAddr)
+			}
+		}
+
+		return out, nil
+	}
+}
+
+// Prober periodically dials TCP addresses and records the results.
+// It implements store.Reachability.
+type Prober struct {
+	log     logrus.FieldLogger
+	targets TargetsFunc
+	conf    Config
+	dialer  net.Dialer
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	results map[string]Result
+	mx      sync.RWMutex
+}
+
+// New creates a new Prober.
+func New(log logrus.FieldLogger, targets TargetsFunc, conf Config) *Prober {
+	if log == nil {
+		l := logrus.New()
+		l.Level = logrus.FatalLevel
+		log = l
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = DefaultInterval
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultTimeout
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = DefaultConcurrency
+	}
+
+	return &Prober{
+		log:     log,
+		targets: targets,
+		conf:    conf,
+		dialer:  net.Dialer{Timeout: conf.Timeout},
+		lookup:  net.DefaultResolver.LookupIPAddr,
+		results: make(map[string]Result),
+	}
+}
+
+// Run probes all targets every interval until the context is canceled.
+func (p *Prober) Run(ctx context.Context) {
+	t := time.NewTicker(p.conf.Interval)
+	defer t.Stop()
+
+	for {
+		start := time.Now()
+		if err := p.ProbeAll(ctx); err != nil {
+			p.log.WithError(err).Warn("Failed to probe peers.")
+		} else {
+			p.log.WithField("elapsed", time.Since(start)).Debug("Finished probing peers.")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ProbeAll probes all targets once. Results of addresses that are no longer
+// targets are discarded.
+func (p *Prober) ProbeAll(ctx context.Context) error {
+	addrs, err := p.targets(ctx)
+	if err != nil {
+		return err
+	}
+
+	results := make([]Result, len(addrs))
+	sem := make(chan struct{}, p.conf.Concurrency)
+
+	var wg sync.WaitGroup
+	wg.Add(len(addrs))
+
+	for i, addr := range addrs {
+		sem <- struct{}{}
+		go func(i int, addr string) {
+			results[i] = p.Probe(ctx, addr)
+			<-sem
+			wg.Done()
+		}(i, addr)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	newResults := make(map[string]Result, len(addrs))
+	for i, addr := range addrs {
+		newResults[addr] = results[i]
+	}
+
+	p.mx.Lock()
+	p.results = newResults
+	p.mx.Unlock()
+
+	return nil
+}
+
+// Probe dials the given TCP address once.
+// Unless Config.AllowLocal is set, addresses which do not resolve to a public
+// IP are reported unreachable without being dialed, so that peers cannot use
+// the tracker to scan its own host or network.
+func (p *Prober) Probe(ctx context.Context, addr string) Result {
+	start := time.Now()
+	conn, err := p.dial(ctx, addr)
+	latency := time.Since(start)
+
+	if err != nil {
+		return Result{
+			Reachable:   false,
+			Latency:     latency,
+			LastChecked: start,
+			Error:       err.Error(),
+		}
+	}
+
+	if err := conn.Close(); err != nil {
+		p.log.WithError(err).WithField("addr", addr).Debug("Failed to close probe connection.")
+	}
+
+	return Result{
+		Reachable:   true,
+		Latency:     latency,
+		LastChecked: start,
+	}
+}
+
+// dial resolves the host of the given TCP address and dials the first
+// resolved IP which may be dialed. The resolved IP is dialed rather than the
+// host name, so that the host cannot resolve to a different IP in between.
+func (p *Prober) dial(ctx context.Context, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := p.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range ips {
+		if !p.conf.AllowLocal && !IsPublicIP(ip.IP) {
+			continue
+		}
+		return p.dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNonPublicAddr, addr)
+}
+
+// Result returns the last probe result of the given TCP address.
+func (p *Prober) Result(addr string) (Result, bool) {
+	p.mx.RLock()
+	res, ok := p.results[addr]
+	p.mx.RUnlock()
+
+	return res, ok
+}
+
+// Results returns the last probe results of all TCP addresses.
+func (p *Prober) Results() map[string]Result {
+	p.mx.RLock()
+	out := make(map[string]Result, len(p.results))
+	for addr, res := range p.results {
+		out[addr] = res
+	}
+	p.mx.RUnlock()
+
+	return out
+}
+
+// Reachable implements store.Reachability.
+func (p *Prober) Reachable(tcpAddr string) (reachable, probed bool) {
+	res, ok := p.Result(tcpAddr)
+	return res.Reachable, ok
+}
@@ -0,0 +1,176 @@
+package prober
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skycoin/cx-tracker/pkg/store"
+)
+
+func TestProber(t *testing.T) {
+	// Stand-in node which accepts TCP connections.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close() //nolint:errcheck
+		}
+	}()
+
+	// Address which does not accept TCP connections.
+	closedLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closedLis.Addr().String()
+	require.NoError(t, closedLis.Close())
+
+	chain := cipher.SumSHA256([]byte("chain"))
+
+	ps := store.NewMemoryPeersStore(time.Minute, 10)
+	require.NoError(t, ps.UpdateEntry(context.TODO(), randPeerEntry(t, chain, lis.Addr().String())))
+	require.NoError(t, ps.UpdateEntry(context.TODO(), randPeerEntry(t, chain, closedAddr)))
+
+	p := New(nil, TargetsOfPeersStore(ps), Config{Timeout: time.Second, AllowLocal: true})
+	ps.SetReachability(p, store.ReachabilityRequire)
+
+	// No peers should be returned before they are probed.
+	peers, err := ps.RandPeersOfChain(context.TODO(), chain, 10)
+	require.NoError(t, err)
+	require.Len(t, peers, 0)
+
+	require.NoError(t, p.ProbeAll(context.TODO()))
+
+	res, ok := p.Result(lis.Addr().String())
+	require.True(t, ok)
+	require.True(t, res.Reachable)
+	require.False(t, res.LastChecked.IsZero())
+
+	res, ok = p.Result(closedAddr)
+	require.True(t, ok)
+	require.False(t, res.Reachable)
+	require.NotEmpty(t, res.Error)
+
+	// Only the reachable peer should be returned when reachability is required.
+	peers, err = ps.RandPeersOfChain(context.TODO(), chain, 10)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	require.Equal(t, lis.Addr().String(), peers[0].TCPAddr)
+
+	// Reachable peers should be returned first when reachability is preferred.
+	ps.SetReachability(p, store.ReachabilityPrefer)
+	for i := 0; i < 10; i++ {
+		peers, err = ps.RandPeersOfChain(context.TODO(), chain, 1)
+		require.NoError(t, err)
+		require.Len(t, peers, 1)
+		require.Equal(t, lis.Addr().String(), peers[0].TCPAddr)
+	}
+
+	peers, err = ps.RandPeersOfChain(context.TODO(), chain, 10)
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+}
+
+func TestProber_Probe_nonPublic(t *testing.T) {
+	// Stand-in local service which counts accepted TCP connections.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, lis.Close()) }()
+
+	accepted := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close() //nolint:errcheck
+			accepted <- struct{}{}
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+
+	p := New(nil, nil, Config{Timeout: time.Second})
+	p.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host == "local.example" {
+			return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+		}
+		return net.DefaultResolver.LookupIPAddr(ctx, host)
+	}
+
+	for _, host := range []string{"127.0.0.1", "local.example", "0.0.0.0", "10.1.2.3", "169.254.1.1", "192.168.1.1", "::1", "fe80::1"} {
+		res := p.Probe(context.TODO(), net.JoinHostPort(host, port))
+		require.False(t, res.Reachable, host)
+		require.Contains(t, res.Error, ErrNonPublicAddr.Error(), host)
+	}
+
+	select {
+	case <-accepted:
+		t.Fatal("non-public address was dialed")
+	default:
+	}
+
+	// Local addresses are dialed when explicitly allowed.
+	p.conf.AllowLocal = true
+	res := p.Probe(context.TODO(), net.JoinHostPort("local.example", port))
+	require.True(t, res.Reachable, res.Error)
+	<-accepted
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, public := range map[string]bool{
+		"1.1.1.1":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.0.0.1":        false,
+		"172.16.0.1":      false,
+		"192.168.0.1":     false,
+		"100.64.0.1":      false,
+		"169.254.0.1":     false,
+		"0.0.0.0":         false,
+		"255.255.255.255": false,
+		"224.0.0.1":       false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+	} {
+		require.Equal(t, public, IsPublicIP(net.ParseIP(ip)), ip)
+	}
+}
+
+// randPeerEntry generates a signed peer entry of a random public key which
+// hosts the chain of given genesis hash on 'tcpAddr'.
+func randPeerEntry(t *testing.T, chain cipher.SHA256, tcpAddr string) cxspec.SignedPeerEntry {
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain[:]): {
+				DmsgAddr: dmsg.Addr{PK: pk, Port: 9090},
+				TCPAddr:  tcpAddr,
+			},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry
+}
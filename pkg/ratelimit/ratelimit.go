@@ -0,0 +1,238 @@
+// Package ratelimit limits the rate of requests with token buckets which are
+// keyed by client IP, peer public key and chain public key.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of keys which requests are limited by.
+const (
+	KindIP      = "ip"
+	KindPeerPK  = "peer_pk"
+	KindChainPK = "chain_pk"
+)
+
+// Default limits.
+var (
+	DefaultIPLimit      = Limit{Events: 120, Per: time.Minute}
+	DefaultPeerPKLimit  = Limit{Events: 12, Per: time.Minute}
+	DefaultChainPKLimit = Limit{Events: 20, Per: time.Hour}
+)
+
+// limitOff is the string representation of a disabled Limit.
+const limitOff = "off"
+
+// Limit allows a burst of Events, which are refilled at a rate of Events per
+// duration Per. The zero value disables the limit.
+type Limit struct {
+	Events int
+	Per    time.Duration
+}
+
+// ParseLimit parses a Limit of format "<events>/<duration>" (for example
+// "60/1m"), or "off".
+func ParseLimit(s string) (Limit, error) {
+	if s == limitOff {
+		return Limit{}, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("rate limit '%s' should be of format '<events>/<duration>' or '%s'", s, limitOff)
+	}
+
+	events, err := strconv.Atoi(parts[0])
+	if err != nil || events <= 0 {
+		return Limit{}, fmt.Errorf("rate limit '%s' has invalid number of events", s)
+	}
+
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("rate limit '%s' has invalid duration", s)
+	}
+
+	return Limit{Events: events, Per: per}, nil
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Events > 0 && l.Per > 0
+}
+
+// String implements fmt.Stringer and flag.Value.
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return limitOff
+	}
+	// Trim zero units, so that "1h0m0s" is printed as "1h".
+	per := l.Per.String()
+	if strings.HasSuffix(per, "m0s") {
+		per = strings.TrimSuffix(per, "0s")
+	}
+	if strings.HasSuffix(per, "h0m") {
+		per = strings.TrimSuffix(per, "0m")
+	}
+	return fmt.Sprintf("%d/%s", l.Events, per)
+}
+
+// Set implements flag.Value.
+func (l *Limit) Set(s string) error {
+	v, err := ParseLimit(s)
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// rate returns the refill rate in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Events) / l.Per.Seconds()
+}
+
+// Config configures the Limiter.
+type Config struct {
+	IP      Limit    // Limit of requests per client IP.
+	PeerPK  Limit    // Limit of peer entries per peer public key.
+	ChainPK Limit    // Limit of chain specs per chain public key.
+	Exempt  []string // Client IPs which are not limited by IP.
+}
+
+// DefaultConfig returns the default values for Config.
+func DefaultConfig() Config {
+	return Config{
+		IP:      DefaultIPLimit,
+		PeerPK:  DefaultPeerPKLimit,
+		ChainPK: DefaultChainPKLimit,
+	}
+}
+
+// Limiter limits the rate of requests per key of each kind.
+type Limiter struct {
+	buckets map[string]*buckets // key: kind
+	exempt  map[string]struct{}
+}
+
+// New creates a Limiter with the given config.
+func New(conf Config) *Limiter {
+	l := &Limiter{
+		buckets: map[string]*buckets{
+			KindIP:      newBuckets(conf.IP),
+			KindPeerPK:  newBuckets(conf.PeerPK),
+			KindChainPK: newBuckets(conf.ChainPK),
+		},
+		exempt: make(map[string]struct{}, len(conf.Exempt)),
+	}
+	for _, ip := range conf.Exempt {
+		l.exempt[ip] = struct{}{}
+	}
+
+	return l
+}
+
+// Allow takes a token of the bucket of 'key' of the given kind. If no token is
+// available, false is returned alongside the duration until a token becomes
+// available. Keys of unknown kinds are not limited.
+func (l *Limiter) Allow(kind, key string) (bool, time.Duration) {
+	if kind == KindIP {
+		if _, ok := l.exempt[key]; ok {
+			return true, 0
+		}
+	}
+
+	b, ok := l.buckets[kind]
+	if !ok {
+		return true, 0
+	}
+
+	return b.allow(key)
+}
+
+// Limit returns the limit of the given kind.
+func (l *Limiter) Limit(kind string) Limit {
+	b, ok := l.buckets[kind]
+	if !ok {
+		return Limit{}
+	}
+	return b.limit
+}
+
+// buckets contains the token buckets of the keys of a kind.
+type buckets struct {
+	limit Limit
+	now   func() time.Time
+
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	mx        sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // time 'tokens' was last updated
+}
+
+func newBuckets(limit Limit) *buckets {
+	return &buckets{
+		limit:     limit,
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (bs *buckets) allow(key string) (bool, time.Duration) {
+	if !bs.limit.Enabled() {
+		return true, 0
+	}
+
+	now := bs.now()
+	burst := float64(bs.limit.Events)
+	rate := bs.limit.rate()
+
+	bs.mx.Lock()
+	defer bs.mx.Unlock()
+
+	bs.sweep(now)
+
+	b, ok := bs.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		bs.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep removes the buckets which are refilled, as they are equivalent to new
+// buckets. Buckets are swept at most once per limit period.
+// The caller is expected to hold the lock.
+func (bs *buckets) sweep(now time.Time) {
+	if now.Sub(bs.lastSweep) < bs.limit.Per {
+		return
+	}
+	bs.lastSweep = now
+
+	burst := float64(bs.limit.Events)
+	rate := bs.limit.rate()
+	for key, b := range bs.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(bs.buckets, key)
+		}
+	}
+}
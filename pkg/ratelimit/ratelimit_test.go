@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	cases := []struct {
+		in  string
+		exp Limit
+		err bool
+	}{
+		{in: "off", exp: Limit{}},
+		{in: "60/1m", exp: Limit{Events: 60, Per: time.Minute}},
+		{in: "5/30s", exp: Limit{Events: 5, Per: 30 * time.Second}},
+		{in: "20/1h", exp: Limit{Events: 20, Per: time.Hour}},
+		{in: "", err: true},
+		{in: "60", err: true},
+		{in: "0/1m", err: true},
+		{in: "-1/1m", err: true},
+		{in: "60/0s", err: true},
+		{in: "60/minute", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			l, err := ParseLimit(c.in)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, l)
+
+			// The string representation should parse to the same limit.
+			l2, err := ParseLimit(l.String())
+			require.NoError(t, err)
+			require.Equal(t, l, l2)
+		})
+	}
+
+	require.Equal(t, "20/1h", DefaultChainPKLimit.String())
+	require.Equal(t, "90/1m30s", Limit{Events: 90, Per: 90 * time.Second}.String())
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	const burst = 3
+
+	now := time.Now()
+	l := New(Config{IP: Limit{Events: burst, Per: time.Minute}})
+	l.buckets[KindIP].now = func() time.Time { return now }
+
+	for i := 0; i < burst; i++ {
+		ok, _ := l.Allow(KindIP, "1.1.1.1")
+		require.True(t, ok)
+	}
+
+	ok, wait := l.Allow(KindIP, "1.1.1.1")
+	require.False(t, ok)
+	require.Equal(t, 20*time.Second, wait)
+
+	// Keys have separate buckets.
+	ok, _ = l.Allow(KindIP, "2.2.2.2")
+	require.True(t, ok)
+
+	// Tokens are refilled over time.
+	now = now.Add(wait)
+	ok, _ = l.Allow(KindIP, "1.1.1.1")
+	require.True(t, ok)
+	ok, _ = l.Allow(KindIP, "1.1.1.1")
+	require.False(t, ok)
+
+	// Disabled limits allow everything.
+	for i := 0; i < burst*2; i++ {
+		ok, _ := l.Allow(KindPeerPK, "pk")
+		require.True(t, ok)
+		ok, _ = l.Allow("unknown", "key")
+		require.True(t, ok)
+	}
+}
+
+func TestLimiter_Exempt(t *testing.T) {
+	l := New(Config{
+		IP:     Limit{Events: 1, Per: time.Minute},
+		PeerPK: Limit{Events: 1, Per: time.Minute},
+		Exempt: []string{"1.1.1.1"},
+	})
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow(KindIP, "1.1.1.1")
+		require.True(t, ok)
+	}
+
+	// Exempt IPs are only exempt from the IP limit.
+	ok, _ := l.Allow(KindPeerPK, "1.1.1.1")
+	require.True(t, ok)
+	ok, _ = l.Allow(KindPeerPK, "1.1.1.1")
+	require.False(t, ok)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	l := New(DefaultConfig())
+	bs := l.buckets[KindPeerPK]
+	bs.now = func() time.Time { return now }
+
+	for i := 0; i < DefaultPeerPKLimit.Events; i++ {
+		ok, _ := l.Allow(KindPeerPK, "busy")
+		require.True(t, ok)
+	}
+	ok, _ := l.Allow(KindPeerPK, "idle")
+	require.True(t, ok)
+	require.Len(t, bs.buckets, 2)
+
+	// Only buckets which are refilled are removed.
+	now = now.Add(DefaultPeerPKLimit.Per / 2)
+	bs.lastSweep = now.Add(-DefaultPeerPKLimit.Per)
+	ok, _ = l.Allow(KindPeerPK, "busy")
+	require.True(t, ok)
+	require.Len(t, bs.buckets, 1)
+	require.Contains(t, bs.buckets, "busy")
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+// bboltCounter describes an object count of countBucket. The count is keyed
+// by the name of the bucket which contains the counted objects.
+type bboltCounter struct {
+	bucket []byte
+	count  func(b *bbolt.Bucket) (uint64, error) // counts the objects of the bucket
+}
+
+// bboltCounters are the object counts which are maintained by the stores.
+var bboltCounters = []bboltCounter{
+	{bucket: specBucket, count: bboltCountKeys},      // chain specs
+	{bucket: peerEntryBucket, count: bboltCountKeys}, // peer entries (including expired ones until garbage collected)
+	{bucket: peersBucket, count: bboltCountNested},   // chain addresses of all chains
+}
+
+func bboltCountKeys(b *bbolt.Bucket) (uint64, error) {
+	var n uint64
+	err := b.ForEach(func(_, _ []byte) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func bboltCountNested(b *bbolt.Bucket) (uint64, error) {
+	var n uint64
+	err := b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return ErrBboltInvalidValue
+		}
+		nb := b.Bucket(k)
+		if nb == nil {
+			return ErrBboltInvalidValue
+		}
+		m, err := bboltCountKeys(nb)
+		n += m
+		return err
+	})
+	return n, err
+}
+
+// BboltCountDrift is an object count which does not match the number of
+// stored objects.
+type BboltCountDrift struct {
+	Bucket string `json:"bucket"`
+	Stored uint64 `json:"stored"` // Count stored in the count bucket.
+	Actual uint64 `json:"actual"` // Number of stored objects.
+}
+
+// bboltCountDrifts recounts the objects of each counter.
+// Counters of missing buckets are skipped.
+func bboltCountDrifts(tx *bbolt.Tx) ([]BboltCountDrift, error) {
+	if tx.Bucket(countBucket) == nil {
+		return nil, nil
+	}
+
+	var drifts []BboltCountDrift
+	for _, c := range bboltCounters {
+		b := tx.Bucket(c.bucket)
+		if b == nil {
+			continue
+		}
+
+		n, err := c.count(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if stored := objectCount(tx, c.bucket); stored != n {
+			drifts = append(drifts, BboltCountDrift{Bucket: string(c.bucket), Stored: stored, Actual: n})
+		}
+	}
+
+	return drifts, nil
+}
+
+// ReconcileBboltCounts recounts the stored objects and repairs the object
+// counts which drifted. The repaired drifts are returned.
+func ReconcileBboltCounts(db *bbolt.DB) ([]BboltCountDrift, error) {
+	var drifts []BboltCountDrift
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		if drifts, err = bboltCountDrifts(tx); err != nil {
+			return err
+		}
+
+		for _, d := range drifts {
+			v := make([]byte, 8)
+			binaryEnc.PutUint64(v, d.Actual)
+			if err := tx.Bucket(countBucket).Put([]byte(d.Bucket), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func TestBboltPeersStore_Counts(t *testing.T) {
+	const timeout = time.Minute
+
+	db, err := OpenBboltDB(filepath.Join(testBboltMaintenanceDir(t), "peers.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+
+	ps, err := NewBboltPeersStore(db, timeout)
+	require.NoError(t, err)
+
+	requireCounts := func(entries, addrs uint64) {
+		require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+			require.Equal(t, entries, objectCount(tx, peerEntryBucket))
+			require.Equal(t, addrs, objectCount(tx, peersBucket))
+			return nil
+		}))
+	}
+
+	chain1 := cipher.SumSHA256([]byte("chain1"))
+	chain2 := cipher.SumSHA256([]byte("chain2"))
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain1[:]): {DmsgAddr: dmsg.Addr{PK: pk, Port: 9090}},
+			hex.EncodeToString(chain2[:]): {DmsgAddr: dmsg.Addr{PK: pk, Port: 9091}},
+		},
+	}
+	update := func(entry cxspec.PeerEntry) {
+		signed, err := cxspec.MakeSignedPeerEntry(entry, sk)
+		require.NoError(t, err)
+		require.NoError(t, ps.UpdateEntry(context.TODO(), signed))
+	}
+
+	update(entry)
+	requireCounts(1, 2)
+
+	// Re-announcing the same addresses should not change the counts.
+	entry.LastSeen++
+	update(entry)
+	requireCounts(1, 2)
+
+	// Changed addresses are new objects until the old ones time out.
+	entry.LastSeen++
+	entry.CXChains[hex.EncodeToString(chain1[:])] = cxspec.CXChainAddresses{TCPAddr: "127.0.0.1:6001"}
+	update(entry)
+	requireCounts(1, 3)
+
+	other, _ := randPeerEntry(t, chain1, "127.0.0.1:6002")
+	require.NoError(t, ps.UpdateEntry(context.TODO(), other))
+	requireCounts(2, 4)
+
+	ps.now = func() time.Time { return time.Now().Add(timeout * 2) }
+	require.Equal(t, 4, ps.GarbageCollect(context.TODO()))
+	requireCounts(0, 0)
+
+	drifts, err := ReconcileBboltCounts(db)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
+
+func TestReconcileBboltCounts(t *testing.T) {
+	db, _ := testBboltMaintenanceDB(t, filepath.Join(testBboltMaintenanceDir(t), "counts.db"), 3)
+
+	drifts, err := ReconcileBboltCounts(db)
+	require.NoError(t, err)
+	require.Empty(t, drifts, "counts should be maintained by the stores")
+
+	// Counts drift, e.g. when they were not maintained by older versions.
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(countBucket).Delete(peerEntryBucket); err != nil {
+			return err
+		}
+		return incrementObjectCount(tx, specBucket, 2)
+	}))
+
+	report, err := VerifyBboltDB(db)
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 2)
+
+	drifts, err = ReconcileBboltCounts(db)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []BboltCountDrift{
+		{Bucket: string(specBucket), Stored: 5, Actual: 3},
+		{Bucket: string(peerEntryBucket), Stored: 0, Actual: 1},
+	}, drifts)
+
+	report, err = VerifyBboltDB(db)
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.Issues)
+
+	drifts, err = ReconcileBboltCounts(db)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
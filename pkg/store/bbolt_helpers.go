@@ -48,15 +48,63 @@ var (
 	// value: [json encoded chain spec]
 	specBucket = []byte("spec")
 
+	// specRevisionBucket is the identifier for the chain spec revisions bucket
+	//   key: [32B: genesis block hash]
+	// value: [bucket of "8B revision number:json encoded spec revision"]
+	specRevisionBucket = []byte("spec_revisions")
+
+	// specTickerIndexBucket indexes chain specs by normalized coin ticker
+	//   key: [normalized coin ticker]
+	// value: [bucket of "32B genesis block hash:empty"]
+	specTickerIndexBucket = []byte("spec_index_ticker")
+
+	// specCoinNameIndexBucket indexes chain specs by normalized coin name
+	//   key: [normalized coin name]
+	// value: [bucket of "32B genesis block hash:empty"]
+	specCoinNameIndexBucket = []byte("spec_index_coin_name")
+
+	// specChainPKIndexBucket indexes chain specs by chain public key
+	//   key: [normalized (lower case hex) chain public key]
+	// value: [bucket of "32B genesis block hash:empty"]
+	specChainPKIndexBucket = []byte("spec_index_chain_pk")
+
 	// peersBucket is the identifier for the peers bucket
 	//   key: [32B: genesis block hash]
 	// value: [bucket of "addresses:timestamp"]
 	peersBucket = []byte("client_nodes")
 
+	// peerEntryBucket is the identifier for the signed peer entry bucket
+	//   key: [33B: peer public key]
+	// value: [8B: timestamp][json encoded signed peer entry]
+	peerEntryBucket = []byte("peer_entries")
+
+	// peerStatusBucket is the identifier for the signed peer status bucket
+	// Statuses are removed alongside the entry of their peer.
+	//   key: [33B: peer public key]
+	// value: [json encoded signed peer status]
+	peerStatusBucket = []byte("peer_statuses")
+
 	// countBucket contains counts of various objects
+	//   key: [name of the bucket which contains the counted objects]
+	// value: [8B: count]
 	countBucket = []byte("count")
+
+	// metaBucket contains metadata of the database
+	//   key: [metadata name]
+	// value: [metadata value]
+	metaBucket = []byte("meta")
+
+	// schemaVersionKey is the metaBucket key of the schema version
+	// value: [8B: schema version]
+	schemaVersionKey = []byte("schema_version")
 )
 
+func encodeRevision(rev uint64) []byte {
+	b := make([]byte, 8)
+	binaryEnc.PutUint64(b, rev)
+	return b
+}
+
 func objectCount(tx *bbolt.Tx, key []byte) uint64 {
 	v := tx.Bucket(countBucket).Get(key)
 	if len(v) != 8 {
@@ -83,7 +131,13 @@ func decrementObjectCount(tx *bbolt.Tx, key []byte, delta uint64) error {
 	if len(v) != 8 {
 		v = make([]byte, 8)
 	}
-	binaryEnc.PutUint64(v, binaryEnc.Uint64(v)-delta)
+	// A drifted count should not wrap around, it is repaired by
+	// ReconcileBboltCounts.
+	n := binaryEnc.Uint64(v)
+	if delta > n {
+		delta = n
+	}
+	binaryEnc.PutUint64(v, n-delta)
 	return b.Put(key, v)
 }
 
@@ -0,0 +1,557 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"go.etcd.io/bbolt"
+)
+
+// OpenBboltDBReadOnly opens a bbolt database file in read-only mode.
+// It fails if the file does not exist, or is opened by a running tracker.
+func OpenBboltDBReadOnly(filename string) (*bbolt.DB, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+
+	opts := *bbolt.DefaultOptions
+	opts.Timeout = bboltFileOpenTimeout
+	opts.ReadOnly = true
+
+	return bbolt.Open(filename, bboltFileMode, &opts)
+}
+
+// BboltBucketInfo describes a top-level bucket of a bbolt database.
+type BboltBucketInfo struct {
+	Name       string `json:"name"`
+	Keys       int    `json:"keys"`        // Number of keys, including those of nested buckets.
+	Buckets    int    `json:"buckets"`     // Number of nested buckets.
+	Depth      int    `json:"depth"`       // Number of levels of the bucket B+tree.
+	BytesInUse int    `json:"bytes_inuse"` // Bytes used by keys and values.
+	BytesAlloc int    `json:"bytes_alloc"` // Bytes allocated for the pages of the bucket.
+}
+
+// BboltInfo describes a bbolt database.
+type BboltInfo struct {
+	Path          string            `json:"path"`
+	SchemaVersion uint64            `json:"schema_version"` // 0 if the database is not versioned.
+	FileSize      int64             `json:"file_size"`
+	PageSize      int               `json:"page_size"`
+	FreePages     int               `json:"free_pages"` // Number of free pages, which are reclaimed by compaction.
+	Buckets       []BboltBucketInfo `json:"buckets"`
+	Counts        map[string]uint64 `json:"counts"` // Object counts of the count bucket.
+}
+
+// InspectBboltDB describes the buckets of a bbolt database.
+func InspectBboltDB(db *bbolt.DB) (BboltInfo, error) {
+	info := BboltInfo{
+		Path:   db.Path(),
+		Counts: make(map[string]uint64),
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		info.SchemaVersion = bboltSchemaVersion(tx)
+		info.FileSize = tx.Size()
+		info.PageSize = db.Info().PageSize
+
+		err := tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			s := b.Stats()
+			info.Buckets = append(info.Buckets, BboltBucketInfo{
+				Name:       string(name),
+				Keys:       s.KeyN,
+				Buckets:    s.BucketN - 1,
+				Depth:      s.Depth,
+				BytesInUse: s.BranchInuse + s.LeafInuse,
+				BytesAlloc: s.BranchAlloc + s.LeafAlloc,
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if b := tx.Bucket(countBucket); b != nil {
+			return b.ForEach(func(k, v []byte) error {
+				if len(v) == 8 {
+					info.Counts[string(k)] = binaryEnc.Uint64(v)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return BboltInfo{}, err
+	}
+
+	info.FreePages = db.Stats().FreePageN
+	return info, nil
+}
+
+// BboltIssue is a problem found by VerifyBboltDB.
+type BboltIssue struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key,omitempty"` // Hex representation of the key.
+	Err    string `json:"error"`
+}
+
+// BboltVerifyReport is the result of VerifyBboltDB.
+type BboltVerifyReport struct {
+	Specs       int          `json:"specs"`
+	Revisions   int          `json:"revisions"`
+	PeerEntries int          `json:"peer_entries"`
+	PeerAddrs   int          `json:"peer_addrs"`
+	Issues      []BboltIssue `json:"issues"`
+}
+
+// OK returns true if no issues are found.
+func (r *BboltVerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *BboltVerifyReport) issue(bucket []byte, key []byte, err error) {
+	r.Issues = append(r.Issues, BboltIssue{
+		Bucket: string(bucket),
+		Key:    hex.EncodeToString(key),
+		Err:    err.Error(),
+	})
+}
+
+// VerifyBboltDB checks the consistency of a bbolt database.
+// The following is checked:
+// - Pages of the database file are consistent.
+// - Chain specs and spec revisions decode, and pass SignedChainSpec.Verify.
+// - Chain specs are stored under their genesis hash, and are indexed.
+// - Peer entries and peer addresses decode.
+// - Object counts match the number of stored objects.
+// Problems with stored values are reported as issues wrapping
+// ErrBboltInvalidValue. An error is only returned if the database cannot be
+// read.
+func VerifyBboltDB(db *bbolt.DB) (BboltVerifyReport, error) {
+	var r BboltVerifyReport
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			r.issue(nil, nil, err)
+		}
+
+		verifyBboltSpecs(tx, &r)
+		verifyBboltPeers(tx, &r)
+		verifyBboltCounts(tx, &r)
+		return nil
+	})
+
+	return r, err
+}
+
+func verifyBboltSpecs(tx *bbolt.Tx, r *BboltVerifyReport) {
+	specB := tx.Bucket(specBucket)
+	if specB == nil {
+		return
+	}
+
+	revB := tx.Bucket(specRevisionBucket)
+
+	_ = specB.ForEach(func(k, v []byte) error { //nolint:errcheck
+		r.Specs++
+
+		spec, err := decodeBboltSpec(k, v)
+		if err != nil {
+			r.issue(specBucket, k, err)
+			return nil
+		}
+
+		for _, idx := range specIndexes {
+			key := idx.field(spec.Spec)
+			if key == "" {
+				continue
+			}
+			b := tx.Bucket(idx.bucket)
+			if b == nil || b.Bucket([]byte(key)) == nil || b.Bucket([]byte(key)).Get(k) == nil {
+				r.issue(idx.bucket, k, fmt.Errorf("%w: chain spec is not indexed under '%s'", ErrBboltInvalidValue, key))
+			}
+		}
+
+		if revB == nil || revB.Bucket(k) == nil {
+			r.issue(specRevisionBucket, k, fmt.Errorf("%w: chain spec has no revisions", ErrBboltInvalidValue))
+		}
+		return nil
+	})
+
+	if revB != nil {
+		_ = revB.ForEach(func(hash, _ []byte) error { //nolint:errcheck
+			b := revB.Bucket(hash)
+			if b == nil {
+				r.issue(specRevisionBucket, hash, fmt.Errorf("%w: expected bucket", ErrBboltInvalidValue))
+				return nil
+			}
+			if specB.Get(hash) == nil {
+				r.issue(specRevisionBucket, hash, fmt.Errorf("%w: revisions of missing chain spec", ErrBboltInvalidValue))
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				r.Revisions++
+
+				var rev SpecRevision
+				if err := json.Unmarshal(v, &rev); err != nil {
+					r.issue(specRevisionBucket, append(hash, k...), fmt.Errorf("%w: %v", ErrBboltInvalidValue, err))
+					return nil
+				}
+				if err := checkBboltSpec(hash, rev.Spec); err != nil {
+					r.issue(specRevisionBucket, append(hash, k...), err)
+				}
+				return nil
+			})
+		})
+	}
+
+}
+
+func verifyBboltPeers(tx *bbolt.Tx, r *BboltVerifyReport) {
+	if b := tx.Bucket(peerEntryBucket); b != nil {
+		_ = b.ForEach(func(k, v []byte) error { //nolint:errcheck
+			r.PeerEntries++
+
+			var entry cxspec.SignedPeerEntry
+			switch {
+			case len(v) < 8:
+				r.issue(peerEntryBucket, k, fmt.Errorf("%w: value is too short", ErrBboltInvalidValue))
+			case json.Unmarshal(v[8:], &entry) != nil:
+				r.issue(peerEntryBucket, k, fmt.Errorf("%w: failed to decode peer entry", ErrBboltInvalidValue))
+			case !bytes.Equal(entry.Entry.PublicKey[:], k):
+				r.issue(peerEntryBucket, k, fmt.Errorf("%w: peer entry is stored under the wrong public key", ErrBboltInvalidValue))
+			}
+			return nil
+		})
+	}
+
+	if b := tx.Bucket(peersBucket); b != nil {
+		_ = b.ForEach(func(hash, _ []byte) error { //nolint:errcheck
+			chainB := b.Bucket(hash)
+			if len(hash) != 32 || chainB == nil {
+				r.issue(peersBucket, hash, fmt.Errorf("%w: expected bucket of chain hash", ErrBboltInvalidValue))
+				return nil
+			}
+
+			return chainB.ForEach(func(k, v []byte) error {
+				r.PeerAddrs++
+
+				var addrs cxspec.CXChainAddresses
+				if err := json.Unmarshal(k, &addrs); err != nil || len(v) != 8 {
+					r.issue(peersBucket, append(hash, k...), fmt.Errorf("%w: failed to decode peer addresses", ErrBboltInvalidValue))
+				}
+				return nil
+			})
+		})
+	}
+
+	if b := tx.Bucket(peerStatusBucket); b != nil {
+		entryB := tx.Bucket(peerEntryBucket)
+		_ = b.ForEach(func(k, v []byte) error { //nolint:errcheck
+			var status SignedPeerStatus
+			switch {
+			case json.Unmarshal(v, &status) != nil:
+				r.issue(peerStatusBucket, k, fmt.Errorf("%w: failed to decode peer status", ErrBboltInvalidValue))
+			case !bytes.Equal(status.Status.PublicKey[:], k):
+				r.issue(peerStatusBucket, k, fmt.Errorf("%w: peer status is stored under the wrong public key", ErrBboltInvalidValue))
+			case entryB == nil || entryB.Get(k) == nil:
+				r.issue(peerStatusBucket, k, fmt.Errorf("%w: status of missing peer entry", ErrBboltInvalidValue))
+			}
+			return nil
+		})
+	}
+}
+
+func verifyBboltCounts(tx *bbolt.Tx, r *BboltVerifyReport) {
+	// Objects which cannot be counted are already reported above.
+	drifts, _ := bboltCountDrifts(tx) //nolint:errcheck
+	for _, d := range drifts {
+		r.issue(countBucket, []byte(d.Bucket), fmt.Errorf("%w: count of '%s' is %d, but %d objects are stored",
+			ErrBboltInvalidValue, d.Bucket, d.Stored, d.Actual))
+	}
+}
+
+// decodeBboltSpec decodes and verifies a chain spec of the spec bucket.
+func decodeBboltSpec(k, v []byte) (cxspec.SignedChainSpec, error) {
+	var spec cxspec.SignedChainSpec
+	if err := json.Unmarshal(v, &spec); err != nil {
+		return spec, fmt.Errorf("%w: %v", ErrBboltInvalidValue, err)
+	}
+	return spec, checkBboltSpec(k, spec)
+}
+
+func checkBboltSpec(hash []byte, spec cxspec.SignedChainSpec) error {
+	if err := spec.Verify(); err != nil {
+		return fmt.Errorf("%w: %v", ErrBboltInvalidValue, err)
+	}
+
+	genHash, err := SpecGenesisHash(spec)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBboltInvalidValue, err)
+	}
+	if !bytes.Equal(genHash[:], hash) {
+		return fmt.Errorf("%w: chain spec of genesis hash '%s' is stored under the wrong key",
+			ErrBboltInvalidValue, genHash.Hex())
+	}
+	return nil
+}
+
+// CompactBboltDB copies all buckets of 'src' into the empty database 'dst',
+// leaving out free pages. Writes are committed every 'txMaxSize' bytes (or in
+// a single transaction if zero).
+func CompactBboltDB(dst, src *bbolt.DB, txMaxSize int64) error {
+	var size int64
+
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }() //nolint:errcheck
+
+	err = walkBboltDB(src, func(keys [][]byte, k, v []byte, seq uint64) error {
+		// Commit regularly, as a single transaction of a large database
+		// would use a lot of memory.
+		sz := int64(len(k) + len(v))
+		if txMaxSize != 0 && size+sz > txMaxSize {
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			if tx, err = dst.Begin(true); err != nil {
+				return err
+			}
+			size = 0
+		}
+		size += sz
+
+		// Top-level buckets.
+		if len(keys) == 0 {
+			b, err := tx.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return b.SetSequence(seq)
+		}
+
+		b := tx.Bucket(keys[0])
+		for _, key := range keys[1:] {
+			b = b.Bucket(key)
+		}
+		b.FillPercent = 1.0
+
+		// Nested buckets have no value.
+		if v == nil {
+			nb, err := b.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return nb.SetSequence(seq)
+		}
+
+		return b.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// walkBboltFunc is called for each bucket and key of a database. 'keys' is the
+// path of buckets which contain key 'k'. 'v' is nil for buckets.
+type walkBboltFunc func(keys [][]byte, k, v []byte, seq uint64) error
+
+func walkBboltDB(db *bbolt.DB, fn walkBboltFunc) error {
+	return db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			return walkBboltBucket(b, nil, name, nil, b.Sequence(), fn)
+		})
+	})
+}
+
+func walkBboltBucket(b *bbolt.Bucket, keys [][]byte, k, v []byte, seq uint64, fn walkBboltFunc) error {
+	if err := fn(keys, k, v, seq); err != nil {
+		return err
+	}
+	if v != nil {
+		return nil
+	}
+
+	// Copy the path, so that sibling buckets do not share a backing array.
+	keys = append(append(make([][]byte, 0, len(keys)+1), keys...), k)
+
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nb := b.Bucket(k)
+			return walkBboltBucket(nb, keys, k, nil, nb.Sequence(), fn)
+		}
+		return walkBboltBucket(b, keys, k, v, b.Sequence(), fn)
+	})
+}
+
+// CompactBboltFile compacts the database file 'src' into the new file 'dst'.
+// The sizes of both files are returned.
+func CompactBboltFile(dst, src string) (srcSize, dstSize int64, err error) {
+	if _, err := os.Stat(dst); err == nil {
+		return 0, 0, fmt.Errorf("file '%s' already exists", dst)
+	}
+
+	srcDB, err := OpenBboltDBReadOnly(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = srcDB.Close() }() //nolint:errcheck
+
+	dstDB, err := OpenBboltDB(dst)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := CompactBboltDB(dstDB, srcDB, bboltCompactTxMaxSize); err != nil {
+		_ = dstDB.Close()  //nolint:errcheck
+		_ = os.Remove(dst) //nolint:errcheck
+		return 0, 0, err
+	}
+	if err := dstDB.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	return fileSize(src), fileSize(dst), nil
+}
+
+// bboltCompactTxMaxSize is the maximum size of a compaction transaction.
+const bboltCompactTxMaxSize = 64 << 20
+
+// BackupBboltDB writes a consistent snapshot of the database to 'w'.
+// It can be called while the database is in use.
+func BackupBboltDB(db *bbolt.DB, w io.Writer) (int64, error) {
+	var n int64
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// BboltFileChecksum returns the hex encoded SHA256 checksum of a database (or
+// backup) file.
+func BboltFileChecksum(filename string) (string, error) {
+	f, err := os.Open(filename) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BackupBboltFile writes a consistent snapshot of the database file 'src' to
+// the new file 'dst'.
+func BackupBboltFile(dst, src string) (int64, error) {
+	db, err := OpenBboltDBReadOnly(src)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = db.Close() }() //nolint:errcheck
+
+	return writeFileAtomic(dst, false, func(f *os.File) (int64, error) {
+		return BackupBboltDB(db, f)
+	})
+}
+
+// RestoreBboltFile replaces the database file 'dst' with the backup file 'src'.
+// The backup is verified before it replaces 'dst'. If 'dst' exists, it is
+// only replaced if 'overwrite' is true. Restoring fails while 'dst' is opened
+// by a running tracker.
+func RestoreBboltFile(dst, src string, overwrite bool) (BboltVerifyReport, error) {
+	srcDB, err := OpenBboltDBReadOnly(src)
+	if err != nil {
+		return BboltVerifyReport{}, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() { _ = srcDB.Close() }() //nolint:errcheck
+
+	report, err := VerifyBboltDB(srcDB)
+	if err != nil {
+		return report, err
+	}
+	if !report.OK() {
+		return report, fmt.Errorf("backup file '%s' has %d issues: %w", src, len(report.Issues), ErrBboltInvalidValue)
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		if !overwrite {
+			return report, fmt.Errorf("database file '%s' already exists", dst)
+		}
+
+		// Fail if the database is in use, instead of replacing it under a
+		// running tracker.
+		opts := *bbolt.DefaultOptions
+		opts.Timeout = time.Second
+		dstDB, err := bbolt.Open(dst, bboltFileMode, &opts)
+		if err != nil {
+			return report, fmt.Errorf("database file '%s' is in use: %w", dst, err)
+		}
+		if err := dstDB.Close(); err != nil {
+			return report, err
+		}
+	}
+
+	_, err = writeFileAtomic(dst, true, func(f *os.File) (int64, error) {
+		return BackupBboltDB(srcDB, f)
+	})
+	return report, err
+}
+
+// writeFileAtomic writes a file with 'write' and then renames it into place,
+// so that a partially written file never replaces 'filename'.
+func writeFileAtomic(filename string, overwrite bool, write func(f *os.File) (int64, error)) (int64, error) {
+	if _, err := os.Stat(filename); err == nil && !overwrite {
+		return 0, fmt.Errorf("file '%s' already exists", filename)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	tmp := f.Name()
+
+	n, err := write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, bboltFileMode)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmp) //nolint:errcheck
+		return 0, err
+	}
+	return n, nil
+}
+
+func fileSize(filename string) int64 {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	cipher2 "github.com/skycoin/dmsg/cipher"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func TestVerifyBboltDB(t *testing.T) {
+	dir := testBboltMaintenanceDir(t)
+	db, hashes := testBboltMaintenanceDB(t, filepath.Join(dir, "tracker.db"), 3)
+
+	report, err := VerifyBboltDB(db)
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.Issues)
+	require.Equal(t, 3, report.Specs)
+	require.Equal(t, 4, report.Revisions)
+	require.Equal(t, 1, report.PeerEntries)
+	require.Equal(t, 1, report.PeerAddrs)
+
+	// Corrupt a chain spec, tamper with the signature of another one, and
+	// store a peer entry under the wrong public key.
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(specBucket)
+		if err := b.Put(hashes[0][:], []byte("{not json")); err != nil {
+			return err
+		}
+
+		var spec cxspec.SignedChainSpec
+		if err := json.Unmarshal(b.Get(hashes[1][:]), &spec); err != nil {
+			return err
+		}
+		spec.Spec.CoinName = "tampered"
+		v, err := json.Marshal(spec)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(hashes[1][:], v); err != nil {
+			return err
+		}
+
+		pb := tx.Bucket(peerEntryBucket)
+		_, v = pb.Cursor().First()
+		otherPK, _ := cipher2.GenerateKeyPair()
+		return pb.Put(otherPK[:], append([]byte(nil), v...))
+	}))
+
+	report, err = VerifyBboltDB(db)
+	require.NoError(t, err)
+	require.False(t, report.OK())
+
+	bad := make(map[string]int)
+	for _, issue := range report.Issues {
+		bad[issue.Bucket]++
+	}
+	require.Equal(t, 2, bad[string(specBucket)], report.Issues)
+	require.Equal(t, 1, bad[string(peerEntryBucket)], report.Issues)
+}
+
+func TestCompactBboltFile(t *testing.T) {
+	dir := testBboltMaintenanceDir(t)
+	src := filepath.Join(dir, "tracker.db")
+	dst := filepath.Join(dir, "compact.db")
+
+	db, hashes := testBboltMaintenanceDB(t, src, 20)
+
+	// Deleting chain specs leaves free pages behind.
+	ss, err := NewBboltSpecStore(db)
+	require.NoError(t, err)
+	for _, hash := range hashes[1:] {
+		require.NoError(t, ss.DelSpec(context.TODO(), hash))
+	}
+	require.NoError(t, db.Close())
+
+	srcSize, dstSize, err := CompactBboltFile(dst, src)
+	require.NoError(t, err)
+	require.Less(t, dstSize, srcSize)
+
+	_, _, err = CompactBboltFile(dst, src)
+	require.Error(t, err, "existing files should not be overwritten")
+
+	requireSameBboltFiles(t, src, dst)
+}
+
+func TestBackupRestoreBboltFile(t *testing.T) {
+	dir := testBboltMaintenanceDir(t)
+	src := filepath.Join(dir, "tracker.db")
+	backup := filepath.Join(dir, "backup.db")
+	restored := filepath.Join(dir, "restored.db")
+
+	db, _ := testBboltMaintenanceDB(t, src, 3)
+
+	// Backups can be taken while the database is in use.
+	var buf bytes.Buffer
+	n, err := BackupBboltDB(db, &buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	require.NoError(t, ioutil.WriteFile(backup, buf.Bytes(), 0600))
+
+	_, err = BackupBboltFile(backup, src)
+	require.Error(t, err, "existing files should not be overwritten")
+
+	// The database file is locked by 'db'.
+	_, err = RestoreBboltFile(src, backup, true)
+	require.Error(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = RestoreBboltFile(src, backup, false)
+	require.Error(t, err, "existing database files require overwrite")
+
+	report, err := RestoreBboltFile(restored, backup, false)
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	requireSameBboltFiles(t, src, restored)
+
+	// Invalid backups are rejected.
+	require.NoError(t, ioutil.WriteFile(backup, []byte("not a database"), 0600))
+	_, err = RestoreBboltFile(src, backup, true)
+	require.Error(t, err)
+	requireSameBboltFiles(t, src, restored)
+}
+
+func TestInspectBboltDB(t *testing.T) {
+	dir := testBboltMaintenanceDir(t)
+	db, _ := testBboltMaintenanceDB(t, filepath.Join(dir, "tracker.db"), 3)
+
+	info, err := InspectBboltDB(db)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), info.Counts[string(specBucket)])
+
+	buckets := make(map[string]BboltBucketInfo)
+	for _, b := range info.Buckets {
+		buckets[b.Name] = b
+	}
+	require.Equal(t, 3, buckets[string(specBucket)].Keys)
+	require.Equal(t, 3, buckets[string(specRevisionBucket)].Buckets)
+	require.Equal(t, 1, buckets[string(peerEntryBucket)].Keys)
+}
+
+func testBboltMaintenanceDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", strings.ReplaceAll(t.Name(), "/", "_"))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, os.RemoveAll(dir)) })
+	return dir
+}
+
+// testBboltMaintenanceDB creates a database with 'n' chain specs (the first of
+// which is revised once) and a peer entry of the first chain.
+func testBboltMaintenanceDB(t *testing.T, filename string, n int) (*bbolt.DB, []cipher.SHA256) {
+	db, err := OpenBboltDB(filename)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+
+	ss, err := NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	pk, sk := cipher.GenerateKeyPair()
+	spec, err := cxspec.New("coin", "COIN", sk, cipher.AddressFromPubKey(pk), nil)
+	require.NoError(t, err)
+
+	hashes := make([]cipher.SHA256, n)
+	for i := range hashes {
+		signedSpec := randSignedSpec(t, fmt.Sprintf("coin%d", i), fmt.Sprintf("COIN%d", i), uint64(1000+i))
+		if i == 0 {
+			signedSpec, err = cxspec.MakeSignedChainSpec(*spec, sk)
+			require.NoError(t, err)
+		}
+		require.NoError(t, ss.AddSpec(context.TODO(), signedSpec))
+
+		hashes[i], err = SpecGenesisHash(signedSpec)
+		require.NoError(t, err)
+	}
+
+	spec.Node.DefaultConnections = []string{"127.0.0.1:6001", "127.0.0.1:6002"}
+	revised, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+	_, err = ss.ReviseSpec(context.TODO(), revised)
+	require.NoError(t, err)
+
+	ps, err := NewBboltPeersStore(db, time.Minute)
+	require.NoError(t, err)
+	entry, _ := randPeerEntry(t, cipher2.SHA256(hashes[0]), "127.0.0.1:6001")
+	require.NoError(t, ps.UpdateEntry(context.TODO(), entry))
+
+	return db, hashes
+}
+
+// requireSameBboltFiles ensures that both database files have the same keys
+// and values.
+func requireSameBboltFiles(t *testing.T, a, b string) {
+	dump := func(filename string) map[string]string {
+		db, err := OpenBboltDBReadOnly(filename)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, db.Close()) }()
+
+		out := make(map[string]string)
+		require.NoError(t, walkBboltDB(db, func(keys [][]byte, k, v []byte, _ uint64) error {
+			out[fmt.Sprintf("%x/%x", keys, k)] = string(v)
+			return nil
+		}))
+		return out
+	}
+
+	require.Equal(t, dump(a), dump(b))
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrBboltSchemaTooNew occurs when a database was migrated by a newer version
+// of cx-tracker.
+var ErrBboltSchemaTooNew = errors.New("bbolt db schema is newer than supported")
+
+// BboltMigration migrates the bbolt schema to Version.
+type BboltMigration struct {
+	Version uint64 `json:"version"`
+	Name    string `json:"name"`
+	migrate func(tx *bbolt.Tx) error
+}
+
+// bboltMigrations is the ordered registry of schema migrations.
+//
+// Databases created before the schema was versioned have version 0, and may
+// have the layout of any of the versions below. Hence, migrations should only
+// change what is missing. New migrations are appended to the end of the list,
+// with the next version number.
+var bboltMigrations = []BboltMigration{
+	{
+		Version: 1,
+		Name:    "create_spec_buckets",
+		migrate: bboltCreateSpecBuckets,
+	},
+	{
+		Version: 2,
+		Name:    "backfill_spec_revisions",
+		migrate: bboltBackfillSpecRevisions,
+	},
+	{
+		Version: 3,
+		Name:    "init_spec_count",
+		migrate: bboltInitSpecCount,
+	},
+	{
+		Version: 4,
+		Name:    "build_spec_indexes",
+		migrate: bboltInitSpecIndexes,
+	},
+}
+
+// BboltSchemaVersion is the current schema version of bbolt databases.
+var BboltSchemaVersion = bboltMigrations[len(bboltMigrations)-1].Version
+
+// errBboltDryRun rolls back the transaction of a dry run.
+var errBboltDryRun = errors.New("dry run")
+
+// MigrateBboltDB migrates a database to BboltSchemaVersion. Each migration is
+// applied in a transaction, together with the update of the schema version.
+// The applied migrations are returned.
+//
+// If 'dryRun' is true, all pending migrations are applied in a single
+// transaction which is then rolled back. The migrations which would be
+// applied are returned.
+func MigrateBboltDB(db *bbolt.DB, dryRun bool) ([]BboltMigration, error) {
+	var version uint64
+	err := db.View(func(tx *bbolt.Tx) error {
+		version = bboltSchemaVersion(tx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if version > BboltSchemaVersion {
+		return nil, fmt.Errorf("%w: database is at version %d, but only up to version %d is supported",
+			ErrBboltSchemaTooNew, version, BboltSchemaVersion)
+	}
+
+	var pending []BboltMigration
+	for _, m := range bboltMigrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	if dryRun {
+		err := db.Update(func(tx *bbolt.Tx) error {
+			for _, m := range pending {
+				if err := bboltApplyMigration(tx, m); err != nil {
+					return err
+				}
+			}
+			return errBboltDryRun
+		})
+		if !errors.Is(err, errBboltDryRun) {
+			return nil, err
+		}
+		return pending, nil
+	}
+
+	applied := make([]BboltMigration, 0, len(pending))
+	for _, m := range pending {
+		m := m
+		err := db.Update(func(tx *bbolt.Tx) error {
+			// Another store may have migrated the database in the meantime.
+			if bboltSchemaVersion(tx) >= m.Version {
+				return nil
+			}
+			return bboltApplyMigration(tx, m)
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+func bboltApplyMigration(tx *bbolt.Tx, m BboltMigration) error {
+	if err := m.migrate(tx); err != nil {
+		return fmt.Errorf("migration to schema version %d (%s) failed: %w", m.Version, m.Name, err)
+	}
+	return bboltSetSchemaVersion(tx, m.Version)
+}
+
+// bboltSchemaVersion obtains the schema version of the database (0 if the
+// database is not versioned).
+func bboltSchemaVersion(tx *bbolt.Tx) uint64 {
+	b := tx.Bucket(metaBucket)
+	if b == nil {
+		return 0
+	}
+
+	v := b.Get(schemaVersionKey)
+	if len(v) != 8 {
+		return 0
+	}
+	return binaryEnc.Uint64(v)
+}
+
+func bboltSetSchemaVersion(tx *bbolt.Tx, version uint64) error {
+	b, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+
+	v := make([]byte, 8)
+	binaryEnc.PutUint64(v, version)
+	return b.Put(schemaVersionKey, v)
+}
+
+// bboltCreateSpecBuckets creates the buckets of the initial schema.
+func bboltCreateSpecBuckets(tx *bbolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(specBucket); err != nil {
+		return err
+	}
+
+	_, err := tx.CreateBucketIfNotExists(countBucket)
+	return err
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func TestBboltMigrations_Registry(t *testing.T) {
+	for i, m := range bboltMigrations {
+		require.Equal(t, uint64(i+1), m.Version, "versions should be consecutive")
+		require.NotEmpty(t, m.Name)
+		require.NotNil(t, m.migrate)
+	}
+	require.Equal(t, uint64(len(bboltMigrations)), BboltSchemaVersion)
+}
+
+func TestMigrateBboltDB_Fixtures(t *testing.T) {
+	specs := []cxspec.SignedChainSpec{
+		randSignedSpec(t, "skycoin", "SKY", 1),
+		randSignedSpec(t, "bitcoin", "BTC", 2),
+	}
+
+	// Databases created before the schema was versioned have the layout of
+	// one of the schema versions, but no version marker.
+	for version := uint64(1); version <= BboltSchemaVersion; version++ {
+		version := version
+
+		t.Run(fmt.Sprintf("unversioned_v%d", version), func(t *testing.T) {
+			filename := filepath.Join(testBboltMaintenanceDir(t), "fixture.db")
+			writeBboltFixture(t, filename, version, specs)
+
+			db, err := OpenBboltDB(filename)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+
+			// A dry run reports all migrations, but does not change the
+			// database.
+			pending, err := MigrateBboltDB(db, true)
+			require.NoError(t, err)
+			require.Len(t, pending, len(bboltMigrations))
+			require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+				require.Equal(t, uint64(0), bboltSchemaVersion(tx))
+				require.Equal(t, version >= 2, tx.Bucket(specRevisionBucket) != nil)
+				return nil
+			}))
+
+			ss, err := NewBboltSpecStore(db)
+			require.NoError(t, err)
+			requireMigratedBboltDB(t, ss, specs)
+		})
+	}
+
+	t.Run("partially_migrated", func(t *testing.T) {
+		filename := filepath.Join(testBboltMaintenanceDir(t), "fixture.db")
+		writeBboltFixture(t, filename, 2, specs)
+
+		db, err := OpenBboltDB(filename)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+		require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+			return bboltSetSchemaVersion(tx, 2)
+		}))
+
+		applied, err := MigrateBboltDB(db, false)
+		require.NoError(t, err)
+		require.Len(t, applied, 2)
+		require.Equal(t, uint64(3), applied[0].Version)
+
+		ss, err := NewBboltSpecStore(db)
+		require.NoError(t, err)
+		requireMigratedBboltDB(t, ss, specs)
+
+		applied, err = MigrateBboltDB(db, false)
+		require.NoError(t, err)
+		require.Empty(t, applied)
+	})
+
+	t.Run("failed_migration_is_rolled_back", func(t *testing.T) {
+		filename := filepath.Join(testBboltMaintenanceDir(t), "fixture.db")
+		writeBboltFixture(t, filename, 1, specs)
+
+		orig := bboltMigrations
+		t.Cleanup(func() { bboltMigrations = orig })
+
+		bboltMigrations = append([]BboltMigration(nil), orig...)
+		bboltMigrations[2].migrate = func(tx *bbolt.Tx) error {
+			if err := bboltInitSpecCount(tx); err != nil {
+				return err
+			}
+			return errors.New("failure")
+		}
+
+		db, err := OpenBboltDB(filename)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+
+		applied, err := MigrateBboltDB(db, false)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), bboltMigrations[2].Name)
+		require.Len(t, applied, 2)
+
+		require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+			require.Equal(t, uint64(2), bboltSchemaVersion(tx))
+			require.Nil(t, tx.Bucket(countBucket).Get(specBucket), "changes of the failed migration should be rolled back")
+			return nil
+		}))
+	})
+
+	t.Run("too_new", func(t *testing.T) {
+		filename := filepath.Join(testBboltMaintenanceDir(t), "fixture.db")
+		writeBboltFixture(t, filename, BboltSchemaVersion, specs)
+
+		db, err := OpenBboltDB(filename)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+		require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+			return bboltSetSchemaVersion(tx, BboltSchemaVersion+1)
+		}))
+
+		_, err = NewBboltSpecStore(db)
+		require.True(t, errors.Is(err, ErrBboltSchemaTooNew))
+	})
+}
+
+// requireMigratedBboltDB ensures that the database of 'ss' is at the current
+// schema version and contains 'specs'.
+func requireMigratedBboltDB(t *testing.T, ss *BboltSpecStore, specs []cxspec.SignedChainSpec) {
+	require.NoError(t, ss.db.View(func(tx *bbolt.Tx) error {
+		require.Equal(t, BboltSchemaVersion, bboltSchemaVersion(tx))
+		return nil
+	}))
+
+	report, err := VerifyBboltDB(ss.db)
+	require.NoError(t, err)
+	require.True(t, report.OK(), report.Issues)
+
+	n, err := ss.SpecCount(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(specs)), n)
+
+	for _, spec := range specs {
+		hash, err := SpecGenesisHash(spec)
+		require.NoError(t, err)
+
+		rev, err := ss.SpecRevision(context.TODO(), hash, 1)
+		require.NoError(t, err)
+		require.Equal(t, spec.Sig, rev.Spec.Sig)
+
+		page, err := ss.QuerySpecs(context.TODO(), SpecQuery{CoinTicker: spec.Spec.CoinTicker})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+	}
+}
+
+// writeBboltFixture writes a database file with the layout of schema
+// 'version', as written by cx-tracker before the schema was versioned.
+func writeBboltFixture(t *testing.T, filename string, version uint64, specs []cxspec.SignedChainSpec) {
+	db, err := OpenBboltDB(filename)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, db.Close()) }()
+
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		// Version 1: chain specs, and an unset spec count.
+		specB, err := tx.CreateBucket(specBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(countBucket); err != nil {
+			return err
+		}
+
+		for _, spec := range specs {
+			hash, err := SpecGenesisHash(spec)
+			if err != nil {
+				return err
+			}
+			v, err := json.Marshal(spec)
+			if err != nil {
+				return err
+			}
+			if err := specB.Put(hash[:], v); err != nil {
+				return err
+			}
+
+			// Version 2: spec revisions.
+			if version >= 2 {
+				revB, err := tx.CreateBucketIfNotExists(specRevisionBucket)
+				if err != nil {
+					return err
+				}
+				b, err := revB.CreateBucket(hash[:])
+				if err != nil {
+					return err
+				}
+				rev, err := json.Marshal(SpecRevision{Revision: 1, Created: time.Now().Unix(), Spec: spec})
+				if err != nil {
+					return err
+				}
+				if err := b.Put(encodeRevision(1), rev); err != nil {
+					return err
+				}
+			}
+
+			// Version 4: spec indexes.
+			if version >= 4 {
+				for _, idx := range specIndexes {
+					if _, err := tx.CreateBucketIfNotExists(idx.bucket); err != nil {
+						return err
+					}
+				}
+				if err := bboltIndexSpec(tx, hash, spec.Spec); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Version 3: spec count.
+		if version >= 3 {
+			return incrementObjectCount(tx, specBucket, uint64(len(specs)))
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,876 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+	"go.etcd.io/bbolt"
+)
+
+// BboltPeersStore implements PeersStore with a bbolt.DB database.
+// Unlike MemoryPeersStore, peer announcements survive restarts.
+type BboltPeersStore struct {
+	db      *bbolt.DB
+	timeout time.Duration
+	now     func() time.Time
+
+	reach     Reachability
+	reachMode ReachabilityMode
+	onEvict   EvictionHandler
+
+	// Announcements are counted in memory, so announce rates restart with
+	// the store.
+	announces map[cipher.SHA256]*announceCounter
+	mx        sync.Mutex // guards reach, reachMode, onEvict and announces
+}
+
+// NewBboltPeersStore creates a new BboltPeersStore with a given database file.
+// Entries and chain addresses that are not updated within 'timeout' are
+// removed on GarbageCollect.
+func NewBboltPeersStore(db *bbolt.DB, timeout time.Duration) (*BboltPeersStore, error) {
+	updateFunc := func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(peersBucket); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(peerEntryBucket); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(peerStatusBucket); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(countBucket); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if err := db.Update(updateFunc); err != nil {
+		return nil, err
+	}
+
+	s := &BboltPeersStore{
+		db:        db,
+		timeout:   timeout,
+		now:       time.Now,
+		announces: make(map[cipher.SHA256]*announceCounter),
+	}
+	return s, nil
+}
+
+// UpdateEntry implements PeersStore.
+func (ps *BboltPeersStore) UpdateEntry(ctx context.Context, entry cxspec.SignedPeerEntry) error {
+	pk := entry.Entry.PublicKey
+
+	hashes := make([]cipher.SHA256, 0, len(entry.Entry.CXChains))
+	addrsB := make([][]byte, 0, len(entry.Entry.CXChains))
+
+	for hashStr, addrs := range entry.Entry.CXChains {
+		var hash cipher.SHA256
+		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+			return fmt.Errorf("invalid chain hash '%s': %w", hashStr, err)
+		}
+
+		b, err := json.Marshal(addrs)
+		if err != nil {
+			return fmt.Errorf("failed to encode chain addresses: %w", err)
+		}
+
+		hashes = append(hashes, hash)
+		addrsB = append(addrsB, b)
+	}
+
+	entryB, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode peer entry: %w", err)
+	}
+
+	action := func() error {
+		return ps.db.Update(func(tx *bbolt.Tx) error {
+			now := encodeTime(ps.now())
+
+			// check 'last_seen' value
+			var oldEntry cxspec.SignedPeerEntry
+			err := bboltPeerEntryByPK(tx, pk, &oldEntry, nil)
+			if err == nil && entry.Entry.LastSeen <= oldEntry.Entry.LastSeen {
+				return fmt.Errorf("updated entry's 'last_seen' field should be higher than that of last entry '%d'", oldEntry.Entry.LastSeen)
+			}
+			if err != nil && err != ErrBboltObjectNotExist {
+				return err
+			}
+
+			if err := tx.Bucket(peerEntryBucket).Put(pk[:], append(now, entryB...)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(peerStatusBucket).Delete(pk[:]); err != nil {
+				return err
+			}
+			if err == ErrBboltObjectNotExist {
+				if err := incrementObjectCount(tx, peerEntryBucket, 1); err != nil {
+					return err
+				}
+			}
+
+			var added uint64
+			for i, hash := range hashes {
+				b, err := tx.Bucket(peersBucket).CreateBucketIfNotExists(hash[:])
+				if err != nil {
+					return err
+				}
+
+				if b.Get(addrsB[i]) == nil {
+					added++
+				}
+				if err := b.Put(addrsB[i], now); err != nil {
+					return err
+				}
+			}
+
+			return incrementObjectCount(tx, peersBucket, added)
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return err
+	}
+
+	now := ps.now().Unix()
+	ps.mx.Lock()
+	for _, hash := range hashes {
+		c, ok := ps.announces[hash]
+		if !ok {
+			c = new(announceCounter)
+			ps.announces[hash] = c
+		}
+		c.add(now)
+	}
+	ps.mx.Unlock()
+
+	return nil
+}
+
+// Entry implements PeersStore.
+func (ps *BboltPeersStore) Entry(ctx context.Context, pk cipher.PubKey) (cxspec.SignedPeerEntry, error) {
+	var out cxspec.SignedPeerEntry
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			var updated time.Time
+			if err := bboltPeerEntryByPK(tx, pk, &out, &updated); err != nil {
+				return err
+			}
+
+			if ps.expired(updated) {
+				return ErrBboltObjectNotExist
+			}
+			return nil
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		if err == ErrBboltObjectNotExist {
+			return cxspec.SignedPeerEntry{}, fmt.Errorf("entry of pk '%s' has timed out or does not exist", pk.Hex())
+		}
+		return cxspec.SignedPeerEntry{}, err
+	}
+
+	return out, nil
+}
+
+// UpdateStatus implements PeersStore.
+func (ps *BboltPeersStore) UpdateStatus(ctx context.Context, status SignedPeerStatus) error {
+	pk := status.Status.PublicKey
+
+	statusB, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to encode peer status: %w", err)
+	}
+
+	action := func() error {
+		return ps.db.Update(func(tx *bbolt.Tx) error {
+			var entry cxspec.SignedPeerEntry
+			var updated time.Time
+			if err := bboltPeerEntryByPK(tx, pk, &entry, &updated); err != nil {
+				if err == ErrBboltObjectNotExist {
+					return ErrPeerNotExist
+				}
+				return err
+			}
+			if ps.expired(updated) {
+				return ErrPeerNotExist
+			}
+			if entry.Entry.LastSeen != status.Status.LastSeen {
+				return ErrStaleStatus
+			}
+
+			return tx.Bucket(peerStatusBucket).Put(pk[:], statusB)
+		})
+	}
+
+	return doAsync(ctx, action)
+}
+
+// Status implements PeersStore.
+func (ps *BboltPeersStore) Status(ctx context.Context, pk cipher.PubKey) (*SignedPeerStatus, error) {
+	var out *SignedPeerStatus
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			var entry cxspec.SignedPeerEntry
+			var updated time.Time
+			if err := bboltPeerEntryByPK(tx, pk, &entry, &updated); err != nil {
+				if err == ErrBboltObjectNotExist {
+					return ErrPeerNotExist
+				}
+				return err
+			}
+			if ps.expired(updated) {
+				return ErrPeerNotExist
+			}
+
+			v := tx.Bucket(peerStatusBucket).Get(pk[:])
+			if v == nil {
+				return nil
+			}
+			out = new(SignedPeerStatus)
+			if err := json.Unmarshal(v, out); err != nil {
+				return ErrBboltInvalidValue
+			}
+			return nil
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ChainsOfEntry implements PeersStore.
+func (ps *BboltPeersStore) ChainsOfEntry(ctx context.Context, pk cipher.PubKey) ([]cipher.SHA256, error) {
+	var out []cipher.SHA256
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			var entry cxspec.SignedPeerEntry
+			var updated time.Time
+			if err := bboltPeerEntryByPK(tx, pk, &entry, &updated); err != nil {
+				if err == ErrBboltObjectNotExist {
+					return ErrPeerNotExist
+				}
+				return err
+			}
+			if ps.expired(updated) {
+				return ErrPeerNotExist
+			}
+
+			peersB := tx.Bucket(peersBucket)
+			out = make([]cipher.SHA256, 0, len(entry.Entry.CXChains))
+			for hashStr, addrs := range entry.Entry.CXChains {
+				var hash cipher.SHA256
+				if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+					return ErrBboltInvalidValue
+				}
+
+				b := peersB.Bucket(hash[:])
+				if b == nil {
+					continue
+				}
+				k, err := json.Marshal(addrs)
+				if err != nil {
+					return fmt.Errorf("failed to encode chain addresses: %w", err)
+				}
+				if b.Get(k) != nil {
+					out = append(out, hash)
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// RemoveEntry implements PeersStore.
+func (ps *BboltPeersStore) RemoveEntry(ctx context.Context, pk cipher.PubKey, chains []cipher.SHA256) (map[cipher.SHA256]cxspec.CXChainAddresses, error) {
+	leave := make(map[cipher.SHA256]struct{}, len(chains))
+	for _, hash := range chains {
+		leave[hash] = struct{}{}
+	}
+
+	var removed map[cipher.SHA256]cxspec.CXChainAddresses
+
+	action := func() error {
+		return ps.db.Update(func(tx *bbolt.Tx) error {
+			removed = make(map[cipher.SHA256]cxspec.CXChainAddresses)
+
+			var entry cxspec.SignedPeerEntry
+			var updated time.Time
+			if err := bboltPeerEntryByPK(tx, pk, &entry, &updated); err != nil {
+				if err == ErrBboltObjectNotExist {
+					return ErrPeerNotExist
+				}
+				return err
+			}
+			if ps.expired(updated) {
+				return ErrPeerNotExist
+			}
+
+			peersB := tx.Bucket(peersBucket)
+			for hashStr, addrs := range entry.Entry.CXChains {
+				var hash cipher.SHA256
+				if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+					return ErrBboltInvalidValue
+				}
+				if _, ok := leave[hash]; len(leave) > 0 && !ok {
+					continue
+				}
+
+				b := peersB.Bucket(hash[:])
+				if b == nil {
+					continue
+				}
+
+				k, err := json.Marshal(addrs)
+				if err != nil {
+					return fmt.Errorf("failed to encode chain addresses: %w", err)
+				}
+				if b.Get(k) == nil {
+					continue
+				}
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+				if err := decrementObjectCount(tx, peersBucket, 1); err != nil {
+					return err
+				}
+				removed[hash] = addrs
+
+				if k, _ := b.Cursor().First(); k == nil {
+					if err := peersB.DeleteBucket(hash[:]); err != nil {
+						return err
+					}
+				}
+			}
+
+			if len(leave) > 0 {
+				return nil
+			}
+			if err := tx.Bucket(peerEntryBucket).Delete(pk[:]); err != nil {
+				return err
+			}
+			if err := tx.Bucket(peerStatusBucket).Delete(pk[:]); err != nil {
+				return err
+			}
+			return decrementObjectCount(tx, peerEntryBucket, 1)
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return removed, nil
+}
+
+// SetReachability sets the reachability source and mode used by
+// RandPeersOfChain. It should be called before the store is in use.
+func (ps *BboltPeersStore) SetReachability(r Reachability, mode ReachabilityMode) {
+	ps.mx.Lock()
+	ps.reach = r
+	ps.reachMode = mode
+	ps.mx.Unlock()
+}
+
+// reachability returns the reachability source and mode.
+func (ps *BboltPeersStore) reachability() (Reachability, ReachabilityMode) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+	return ps.reach, ps.reachMode
+}
+
+// RandPeersOfChain implements PeersStore.
+func (ps *BboltPeersStore) RandPeersOfChain(ctx context.Context, hash cipher.SHA256, max int) ([]cxspec.CXChainAddresses, error) {
+	all, err := ps.PeersOfChain(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	reach, reachMode := ps.reachability()
+	return SelectReachable(all, max, reach, reachMode), nil
+}
+
+// QueryPeersOfChain implements PeersStore.
+func (ps *BboltPeersStore) QueryPeersOfChain(ctx context.Context, hash cipher.SHA256, q PeerQuery) ([]cxspec.CXChainAddresses, error) {
+	var infos []PeerInfo
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(peersBucket).Bucket(hash[:])
+			if b == nil {
+				return nil
+			}
+
+			heights, err := bboltChainHeights(tx, hash[:], ps.expiredValue)
+			if err != nil {
+				return err
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				if len(v) != 8 {
+					return ErrBboltInvalidValue
+				}
+				if ps.expired(decodeTime(v)) {
+					return nil
+				}
+
+				var addrs cxspec.CXChainAddresses
+				if err := json.Unmarshal(k, &addrs); err != nil {
+					return ErrBboltInvalidValue
+				}
+
+				infos = append(infos, PeerInfo{
+					Addrs:    addrs,
+					LastSeen: decodeTime(v).Unix(),
+					Height:   heights[addrs],
+				})
+				return nil
+			})
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	reach, reachMode := ps.reachability()
+	return SelectPeers(infos, q, reach, reachMode)
+}
+
+// SetEvictionHandler implements PeersStore.
+func (ps *BboltPeersStore) SetEvictionHandler(h EvictionHandler) {
+	ps.mx.Lock()
+	ps.onEvict = h
+	ps.mx.Unlock()
+}
+
+// PeersOfChain implements PeersStore.
+func (ps *BboltPeersStore) PeersOfChain(ctx context.Context, hash cipher.SHA256) ([]cxspec.CXChainAddresses, error) {
+	var out []cxspec.CXChainAddresses
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(peersBucket).Bucket(hash[:])
+			if b == nil {
+				return nil
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				if len(v) != 8 {
+					return ErrBboltInvalidValue
+				}
+				if ps.expired(decodeTime(v)) {
+					return nil
+				}
+
+				var addrs cxspec.CXChainAddresses
+				if err := json.Unmarshal(k, &addrs); err != nil {
+					return ErrBboltInvalidValue
+				}
+
+				out = append(out, addrs)
+				return nil
+			})
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Chains implements PeersStore.
+func (ps *BboltPeersStore) Chains(ctx context.Context) ([]cipher.SHA256, error) {
+	var out []cipher.SHA256
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			return tx.Bucket(peersBucket).ForEach(func(k, _ []byte) error {
+				var hash cipher.SHA256
+				if copy(hash[:], k) != len(hash) {
+					return ErrBboltInvalidValue
+				}
+
+				out = append(out, hash)
+				return nil
+			})
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Stats implements PeersStore.
+func (ps *BboltPeersStore) Stats(ctx context.Context) (PeersStats, error) {
+	stats := PeersStats{Chains: make(map[cipher.SHA256]int)}
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			err := tx.Bucket(peerEntryBucket).ForEach(func(_, v []byte) error {
+				if !ps.expiredValue(v) {
+					stats.Entries++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			peersB := tx.Bucket(peersBucket)
+			return peersB.ForEach(func(k, _ []byte) error {
+				var hash cipher.SHA256
+				if copy(hash[:], k) != len(hash) {
+					return ErrBboltInvalidValue
+				}
+
+				b := peersB.Bucket(k)
+				if b == nil {
+					return ErrBboltInvalidValue
+				}
+
+				n := 0
+				err := b.ForEach(func(_, v []byte) error {
+					if !ps.expiredValue(v) {
+						n++
+					}
+					return nil
+				})
+
+				stats.Chains[hash] = n
+				return err
+			})
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return PeersStats{}, err
+	}
+
+	return stats, nil
+}
+
+// ChainStats implements PeersStore. The time peers were first seen is not
+// stored, so FirstSeen is always 0.
+func (ps *BboltPeersStore) ChainStats(ctx context.Context) (map[cipher.SHA256]ChainStats, error) {
+	out := make(map[cipher.SHA256]ChainStats)
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			peersB := tx.Bucket(peersBucket)
+			return peersB.ForEach(func(k, _ []byte) error {
+				var hash cipher.SHA256
+				if copy(hash[:], k) != len(hash) {
+					return ErrBboltInvalidValue
+				}
+
+				b := peersB.Bucket(k)
+				if b == nil {
+					return ErrBboltInvalidValue
+				}
+
+				stats, err := ps.bboltChainStats(tx, b, hash)
+				out[hash] = stats
+				return err
+			})
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	now := ps.now().Unix()
+	ps.mx.Lock()
+	for hash, c := range ps.announces {
+		rate := c.rate(now)
+		if rate == 0 {
+			// No announcements within the window.
+			delete(ps.announces, hash)
+			continue
+		}
+
+		stats := out[hash]
+		stats.AnnounceRate = rate
+		out[hash] = stats
+	}
+	ps.mx.Unlock()
+
+	return out, nil
+}
+
+// StatsOfChain implements PeersStore. The time peers were first seen is not
+// stored, so FirstSeen is always 0.
+func (ps *BboltPeersStore) StatsOfChain(ctx context.Context, hash cipher.SHA256) (ChainStats, bool, error) {
+	var (
+		stats ChainStats
+		ok    bool
+	)
+
+	action := func() error {
+		return ps.db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(peersBucket).Bucket(hash[:])
+			if b == nil {
+				return nil
+			}
+
+			var err error
+			stats, err = ps.bboltChainStats(tx, b, hash)
+			ok = err == nil
+			return err
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return ChainStats{}, false, err
+	}
+
+	now := ps.now().Unix()
+	ps.mx.Lock()
+	if c, found := ps.announces[hash]; found {
+		if rate := c.rate(now); rate > 0 {
+			stats.AnnounceRate, ok = rate, true
+		}
+	}
+	ps.mx.Unlock()
+
+	return stats, ok, nil
+}
+
+// bboltChainStats returns the statistics of the live peers of the chain of
+// 'hash', whose peers are in bucket 'b'.
+func (ps *BboltPeersStore) bboltChainStats(tx *bbolt.Tx, b *bbolt.Bucket, hash cipher.SHA256) (ChainStats, error) {
+	heights, err := bboltChainHeights(tx, hash[:], ps.expiredValue)
+	if err != nil {
+		return ChainStats{}, err
+	}
+
+	var stats ChainStats
+	err = b.ForEach(func(k, v []byte) error {
+		if ps.expiredValue(v) {
+			return nil
+		}
+
+		var addrs cxspec.CXChainAddresses
+		if err := json.Unmarshal(k, &addrs); err != nil {
+			return ErrBboltInvalidValue
+		}
+
+		stats.AddPeer(addrs, 0, decodeTime(v[:8]).Unix())
+		if h := heights[addrs]; h > stats.BestHeight {
+			stats.BestHeight = h
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// GarbageCollect implements PeersStore.
+func (ps *BboltPeersStore) GarbageCollect(ctx context.Context) int {
+	evicted := 0
+	evictions := make(map[cipher.SHA256][]cxspec.CXChainAddresses)
+
+	ps.mx.Lock()
+	onEvict := ps.onEvict
+	ps.mx.Unlock()
+
+	action := func() error {
+		return ps.db.Update(func(tx *bbolt.Tx) error {
+			// remove timed out chain addresses and empty chain buckets
+			peersB := tx.Bucket(peersBucket)
+			var emptyChains [][]byte
+
+			err := peersB.ForEach(func(hash, _ []byte) error {
+				b := peersB.Bucket(hash)
+				if b == nil {
+					return nil
+				}
+
+				keys, err := deleteExpiredKeys(b, ps.expiredValue)
+				if err != nil {
+					return err
+				}
+				evicted += len(keys)
+				if err := decrementObjectCount(tx, peersBucket, uint64(len(keys))); err != nil {
+					return err
+				}
+
+				if onEvict != nil && len(keys) > 0 {
+					var h cipher.SHA256
+					copy(h[:], hash)
+					for _, k := range keys {
+						var addrs cxspec.CXChainAddresses
+						if err := json.Unmarshal(k, &addrs); err != nil {
+							return ErrBboltInvalidValue
+						}
+						evictions[h] = append(evictions[h], addrs)
+					}
+				}
+
+				if k, _ := b.Cursor().First(); k == nil {
+					emptyChains = append(emptyChains, append([]byte(nil), hash...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, hash := range emptyChains {
+				if err := peersB.DeleteBucket(hash); err != nil {
+					return err
+				}
+			}
+
+			// remove timed out peer entries alongside their statuses
+			keys, err := deleteExpiredKeys(tx.Bucket(peerEntryBucket), ps.expiredValue)
+			if err != nil {
+				return err
+			}
+			statusB := tx.Bucket(peerStatusBucket)
+			for _, k := range keys {
+				if err := statusB.Delete(k); err != nil {
+					return err
+				}
+			}
+			return decrementObjectCount(tx, peerEntryBucket, uint64(len(keys)))
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return 0
+	}
+
+	if onEvict != nil {
+		for hash, removed := range evictions {
+			onEvict(hash, removed)
+		}
+	}
+
+	return evicted
+}
+
+func (ps *BboltPeersStore) expired(updated time.Time) bool {
+	return updated.Add(ps.timeout).Before(ps.now())
+}
+
+// expiredValue reports whether a value prefixed with an encoded timestamp has
+// expired. Values that are too short to contain a timestamp are also reported
+// as expired.
+func (ps *BboltPeersStore) expiredValue(v []byte) bool {
+	if len(v) < 8 {
+		return true
+	}
+	return ps.expired(decodeTime(v[:8]))
+}
+
+/*
+	<<< HELPER FUNCTIONS >>>
+*/
+
+func bboltPeerEntryByPK(tx *bbolt.Tx, pk cipher.PubKey, entry *cxspec.SignedPeerEntry, updated *time.Time) error {
+	v := tx.Bucket(peerEntryBucket).Get(pk[:])
+	if v == nil {
+		return ErrBboltObjectNotExist
+	}
+	if len(v) < 8 {
+		return ErrBboltInvalidValue
+	}
+
+	if updated != nil {
+		*updated = decodeTime(v[:8])
+	}
+
+	return json.Unmarshal(v[8:], entry)
+}
+
+// bboltChainHeights returns the head block heights of the chain of 'hash'
+// reported by the statuses of live peers, keyed by the addresses of the peers.
+// 'expired' reports whether a peer entry value has expired.
+func bboltChainHeights(tx *bbolt.Tx, hash []byte, expired func(v []byte) bool) (map[cxspec.CXChainAddresses]uint64, error) {
+	hashStr := hex.EncodeToString(hash)
+	entryB := tx.Bucket(peerEntryBucket)
+	out := make(map[cxspec.CXChainAddresses]uint64)
+
+	err := tx.Bucket(peerStatusBucket).ForEach(func(pk, v []byte) error {
+		var status SignedPeerStatus
+		if err := json.Unmarshal(v, &status); err != nil {
+			return ErrBboltInvalidValue
+		}
+		height, ok := status.height(hashStr)
+		if !ok {
+			return nil
+		}
+
+		ev := entryB.Get(pk)
+		if ev == nil || expired(ev) {
+			return nil
+		}
+		var entry cxspec.SignedPeerEntry
+		if err := json.Unmarshal(ev[8:], &entry); err != nil {
+			return ErrBboltInvalidValue
+		}
+
+		if addrs, ok := entry.Entry.CXChains[hashStr]; ok {
+			out[addrs] = height
+		}
+		return nil
+	})
+
+	return out, err
+}
+
+// deleteExpiredKeys deletes all keys of bucket 'b' where 'expired' returns
+// true for the associated value. Keys are collected before deletion as bbolt
+// does not allow modifying a bucket during ForEach. The deleted keys are
+// returned.
+func deleteExpiredKeys(b *bbolt.Bucket, expired func(v []byte) bool) ([][]byte, error) {
+	var keys [][]byte
+
+	err := b.ForEach(func(k, v []byte) error {
+		if v != nil && expired(v) {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
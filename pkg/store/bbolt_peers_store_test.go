@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBboltPeersStore(t *testing.T) {
+	const timeout = time.Minute
+
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("TestBboltPeersStore_%d.db", time.Now().UnixNano()))
+	defer func() { assert.NoError(t, os.Remove(tempFilename)) }()
+
+	chain := cipher.SumSHA256([]byte("chain"))
+	entry, pk := randPeerEntry(t, chain, "127.0.0.1:6001")
+
+	// Write entry and close database.
+	db, err := OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+
+	ps, err := NewBboltPeersStore(db, timeout)
+	require.NoError(t, err)
+	require.NoError(t, ps.UpdateEntry(context.TODO(), entry))
+
+	// Entries with same 'last_seen' should be rejected.
+	require.Error(t, ps.UpdateEntry(context.TODO(), entry))
+	require.NoError(t, db.Close())
+
+	// Entry should survive reopening the database.
+	db, err = OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, db.Close()) }()
+
+	ps, err = NewBboltPeersStore(db, timeout)
+	require.NoError(t, err)
+
+	entry2, err := ps.Entry(context.TODO(), pk)
+	require.NoError(t, err)
+	require.Equal(t, entry.Sig, entry2.Sig)
+
+	peers, err := ps.RandPeersOfChain(context.TODO(), chain, 10)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	require.Equal(t, entry.Entry.CXChains[hex.EncodeToString(chain[:])], peers[0])
+
+	// Garbage collection should not remove fresh entries.
+	ps.GarbageCollect(context.TODO())
+	peers, err = ps.RandPeersOfChain(context.TODO(), chain, 10)
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+
+	// Garbage collection should remove timed out entries.
+	evictions := make(map[cipher.SHA256][]cxspec.CXChainAddresses)
+	ps.SetEvictionHandler(func(hash cipher.SHA256, evicted []cxspec.CXChainAddresses) {
+		evictions[hash] = evicted
+	})
+	ps.now = func() time.Time { return time.Now().Add(timeout * 2) }
+	require.Equal(t, 1, ps.GarbageCollect(context.TODO()))
+	ps.now = time.Now
+
+	require.Equal(t, map[cipher.SHA256][]cxspec.CXChainAddresses{chain: peers}, evictions)
+
+	peers, err = ps.RandPeersOfChain(context.TODO(), chain, 10)
+	require.NoError(t, err)
+	require.Len(t, peers, 0)
+
+	_, err = ps.Entry(context.TODO(), pk)
+	require.Error(t, err)
+}
+
+// randPeerEntry generates a signed peer entry of a random public key which
+// hosts the chain of given genesis hash on 'tcpAddr'.
+func randPeerEntry(t *testing.T, chain cipher.SHA256, tcpAddr string) (cxspec.SignedPeerEntry, cipher.PubKey) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain[:]): {
+				DmsgAddr: dmsg.Addr{PK: pk, Port: 9090},
+				TCPAddr:  tcpAddr,
+			},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry, pk
+}
+
+func TestBboltPeersStore_RemoveEntry(t *testing.T) {
+	db, err := OpenBboltDB(filepath.Join(testBboltMaintenanceDir(t), "peers.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+
+	ps, err := NewBboltPeersStore(db, time.Minute)
+	require.NoError(t, err)
+
+	chain1 := cipher.SumSHA256([]byte("chain1"))
+	chain2 := cipher.SumSHA256([]byte("chain2"))
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  time.Now().Unix(),
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain1[:]): {TCPAddr: "127.0.0.1:6001"},
+			hex.EncodeToString(chain2[:]): {TCPAddr: "127.0.0.1:6002"},
+		},
+	}
+	signed, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+	require.NoError(t, ps.UpdateEntry(context.TODO(), signed))
+
+	other, _ := randPeerEntry(t, chain2, "127.0.0.1:6003")
+	require.NoError(t, ps.UpdateEntry(context.TODO(), other))
+
+	// Leaving a chain keeps the entry.
+	removed, err := ps.RemoveEntry(context.TODO(), pk, []cipher.SHA256{chain1})
+	require.NoError(t, err)
+	require.Equal(t, map[cipher.SHA256]cxspec.CXChainAddresses{
+		chain1: entry.CXChains[hex.EncodeToString(chain1[:])],
+	}, removed)
+
+	chains, err := ps.Chains(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, []cipher.SHA256{chain2}, chains)
+
+	_, err = ps.Entry(context.TODO(), pk)
+	require.NoError(t, err)
+
+	// Only the remaining chain is served.
+	served, err := ps.ChainsOfEntry(context.TODO(), pk)
+	require.NoError(t, err)
+	require.Equal(t, []cipher.SHA256{chain2}, served)
+
+	// Leaving all chains removes the entry.
+	removed, err = ps.RemoveEntry(context.TODO(), pk, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[cipher.SHA256]cxspec.CXChainAddresses{
+		chain2: entry.CXChains[hex.EncodeToString(chain2[:])],
+	}, removed)
+
+	_, err = ps.Entry(context.TODO(), pk)
+	require.Error(t, err)
+	_, err = ps.RemoveEntry(context.TODO(), pk, nil)
+	require.Equal(t, ErrPeerNotExist, err)
+	_, err = ps.ChainsOfEntry(context.TODO(), pk)
+	require.Equal(t, ErrPeerNotExist, err)
+
+	// Addresses of other peers are kept.
+	peers, err := ps.PeersOfChain(context.TODO(), chain2)
+	require.NoError(t, err)
+	require.Equal(t, []cxspec.CXChainAddresses{other.Entry.CXChains[hex.EncodeToString(chain2[:])]}, peers)
+
+	drifts, err := ReconcileBboltCounts(db)
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+	"go.etcd.io/bbolt"
+)
+
+// NormalizeCoinTicker normalizes a coin ticker in the same way as cxspec.New.
+func NormalizeCoinTicker(ticker string) string {
+	return strings.ToUpper(strings.Replace(ticker, " ", "", -1))
+}
+
+// NormalizeCoinName normalizes a coin name in the same way as cxspec.New.
+func NormalizeCoinName(coin string) string {
+	return strings.ToLower(strings.Replace(coin, " ", "", -1))
+}
+
+// NormalizeChainPubKey normalizes a hex encoded chain public key.
+func NormalizeChainPubKey(pk string) string {
+	return strings.ToLower(strings.TrimSpace(pk))
+}
+
+// specIndex is a secondary index of chain specs stored in bbolt.
+type specIndex struct {
+	bucket []byte
+	field  func(spec cxspec.ChainSpec) string // obtains the normalized index key
+}
+
+var (
+	specTickerIndex = specIndex{
+		bucket: specTickerIndexBucket,
+		field:  func(spec cxspec.ChainSpec) string { return NormalizeCoinTicker(spec.CoinTicker) },
+	}
+	specCoinNameIndex = specIndex{
+		bucket: specCoinNameIndexBucket,
+		field:  func(spec cxspec.ChainSpec) string { return NormalizeCoinName(spec.CoinName) },
+	}
+	specChainPKIndex = specIndex{
+		bucket: specChainPKIndexBucket,
+		field:  func(spec cxspec.ChainSpec) string { return NormalizeChainPubKey(spec.ChainPubKey) },
+	}
+
+	specIndexes = []specIndex{specTickerIndex, specCoinNameIndex, specChainPKIndex}
+)
+
+// bboltIndexSpec adds the chain spec of genesis hash 'hash' to all indexes.
+// Empty fields are not indexed.
+func bboltIndexSpec(tx *bbolt.Tx, hash cipher.SHA256, spec cxspec.ChainSpec) error {
+	for _, idx := range specIndexes {
+		key := idx.field(spec)
+		if key == "" {
+			continue
+		}
+
+		b, err := tx.Bucket(idx.bucket).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(hash[:], []byte{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bboltUnindexSpec removes the chain spec of genesis hash 'hash' from all
+// indexes. Index keys that no longer refer to any chain spec are removed.
+func bboltUnindexSpec(tx *bbolt.Tx, hash cipher.SHA256, spec cxspec.ChainSpec) error {
+	for _, idx := range specIndexes {
+		key := []byte(idx.field(spec))
+		if len(key) == 0 {
+			continue
+		}
+
+		b := tx.Bucket(idx.bucket).Bucket(key)
+		if b == nil {
+			continue
+		}
+
+		if err := b.Delete(hash[:]); err != nil {
+			return err
+		}
+
+		if k, _ := b.Cursor().First(); k == nil {
+			if err := tx.Bucket(idx.bucket).DeleteBucket(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// bboltInitSpecIndexes creates the index buckets. If any index bucket is
+// missing, all indexes are rebuilt from the chain spec bucket.
+func bboltInitSpecIndexes(tx *bbolt.Tx) error {
+	missing := false
+
+	for _, idx := range specIndexes {
+		if tx.Bucket(idx.bucket) != nil {
+			continue
+		}
+		if _, err := tx.CreateBucket(idx.bucket); err != nil {
+			return err
+		}
+		missing = true
+	}
+
+	if !missing {
+		return nil
+	}
+
+	return bboltRebuildSpecIndexes(tx)
+}
+
+// bboltRebuildSpecIndexes clears and repopulates all indexes.
+func bboltRebuildSpecIndexes(tx *bbolt.Tx) error {
+	for _, idx := range specIndexes {
+		if err := tx.DeleteBucket(idx.bucket); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(idx.bucket); err != nil {
+			return err
+		}
+	}
+
+	var hashes []cipher.SHA256
+
+	err := tx.Bucket(specBucket).ForEach(func(k, _ []byte) error {
+		var hash cipher.SHA256
+		copy(hash[:], k)
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		var spec cxspec.SignedChainSpec
+		if err := bboltChainSpecByGenesisHash(tx, hash, &spec); err != nil {
+			return err
+		}
+
+		if err := bboltIndexSpec(tx, hash, spec.Spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bboltSpecQueryBucket returns the bucket whose keys are the genesis hashes of
+// the candidate specs of 'q'. If 'q' filters on an indexed field, the index
+// bucket of the filter value is returned (nil if there are no candidates).
+// Otherwise (or if the normalized filter value is empty), the chain spec bucket
+// is returned.
+func bboltSpecQueryBucket(tx *bbolt.Tx, q SpecQuery) (b *bbolt.Bucket, indexed bool) {
+	var (
+		idx specIndex
+		key string
+	)
+
+	switch {
+	case q.ChainPubKey != "":
+		idx, key = specChainPKIndex, NormalizeChainPubKey(q.ChainPubKey)
+	case q.CoinTicker != "":
+		idx, key = specTickerIndex, NormalizeCoinTicker(q.CoinTicker)
+	case q.CoinName != "":
+		idx, key = specCoinNameIndex, NormalizeCoinName(q.CoinName)
+	}
+
+	if key == "" {
+		return tx.Bucket(specBucket), false
+	}
+
+	return tx.Bucket(idx.bucket).Bucket([]byte(key)), true
+}
+
+// bboltSpecQueryValue obtains the encoded chain spec of a key obtained from a
+// bucket returned by bboltSpecQueryBucket.
+func bboltSpecQueryValue(tx *bbolt.Tx, indexed bool, k, v []byte) ([]byte, error) {
+	if !indexed {
+		return v, nil
+	}
+
+	if v = tx.Bucket(specBucket).Get(k); v == nil {
+		return nil, ErrBboltInvalidValue
+	}
+	return v, nil
+}
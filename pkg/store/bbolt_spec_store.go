@@ -1,10 +1,12 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/skycoin/cx-chains/src/cx/cxspec"
 	"github.com/skycoin/skycoin/src/cipher"
@@ -17,19 +19,9 @@ type BboltSpecStore struct {
 }
 
 // NewBboltSpecStore creates a new BboltSpecStore with a given database file.
+// The database is migrated to the current schema version.
 func NewBboltSpecStore(db *bbolt.DB) (*BboltSpecStore, error) {
-	updateFunc := func(tx *bbolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(specBucket); err != nil {
-			return err
-		}
-
-		if _, err := tx.CreateBucketIfNotExists(countBucket); err != nil {
-			return err
-		}
-		return nil
-	}
-
-	if err := db.Update(updateFunc); err != nil {
+	if _, err := MigrateBboltDB(db, false); err != nil {
 		return nil, err
 	}
 
@@ -84,33 +76,162 @@ func (s *BboltSpecStore) ChainSpec(ctx context.Context, hash cipher.SHA256) (cxs
 	return out, nil
 }
 
-// AddSpec implements SpecStore.
-func (s *BboltSpecStore) AddSpec(ctx context.Context, spec cxspec.SignedChainSpec) error {
-	b, err := json.Marshal(spec)
+// QuerySpecs implements SpecStore.
+func (s *BboltSpecStore) QuerySpecs(ctx context.Context, q SpecQuery) (SpecPage, error) {
+	if err := q.check(); err != nil {
+		return SpecPage{}, err
+	}
+
+	cur, err := q.decodeCursor()
 	if err != nil {
-		return fmt.Errorf("failed to encode chain spec: %w", err)
+		return SpecPage{}, err
 	}
 
-	genBlock, err := spec.Spec.GenerateGenesisBlock()
+	var page SpecPage
+
+	action := func() error {
+		return s.db.View(func(tx *bbolt.Tx) error {
+			var err error
+			if q.SortBy == SortByGenesisTimestamp {
+				page, err = bboltQuerySpecsByTimestamp(tx, q, cur)
+			} else {
+				page, err = bboltQuerySpecsByKey(tx, q, cur)
+			}
+			return err
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return SpecPage{}, err
+	}
+
+	return page, nil
+}
+
+// AddSpec implements SpecStore.
+func (s *BboltSpecStore) AddSpec(ctx context.Context, spec cxspec.SignedChainSpec) error {
+	hash, err := SpecGenesisHash(spec)
 	if err != nil {
 		return err
 	}
-	hash := genBlock.HashHeader()
 
 	action := func() error {
 		return s.db.Update(func(tx *bbolt.Tx) error {
 			specV := tx.Bucket(specBucket).Get(hash[:])
 			if specV != nil {
-				return errors.New("attempted to add chain spec with reused chain genesis hash")
+				return fmt.Errorf("attempted to add chain spec with reused chain genesis hash: %w",
+					ErrBboltObjectAlreadyExists)
 			}
 
-			return tx.Bucket(specBucket).Put(hash[:], b)
+			if _, err := bboltPutSpecRevision(tx, hash, spec); err != nil {
+				return err
+			}
+
+			if err := bboltIndexSpec(tx, hash, spec.Spec); err != nil {
+				return err
+			}
+
+			return incrementObjectCount(tx, specBucket, 1)
 		})
 	}
 
 	return doAsync(ctx, action)
 }
 
+// ReviseSpec implements SpecStore.
+func (s *BboltSpecStore) ReviseSpec(ctx context.Context, spec cxspec.SignedChainSpec) (uint64, error) {
+	hash, err := SpecGenesisHash(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	var rev uint64
+
+	action := func() error {
+		return s.db.Update(func(tx *bbolt.Tx) error {
+			var prev cxspec.SignedChainSpec
+			if err := bboltChainSpecByGenesisHash(tx, hash, &prev); err != nil {
+				return err
+			}
+
+			// Indexed fields are immutable, so indexes need not be updated.
+			if err := CheckSpecRevision(prev.Spec, spec.Spec); err != nil {
+				return err
+			}
+			if err := bboltCheckSpecReplay(tx, hash, spec); err != nil {
+				return err
+			}
+
+			var err error
+			rev, err = bboltPutSpecRevision(tx, hash, spec)
+			return err
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return 0, err
+	}
+
+	return rev, nil
+}
+
+// SpecRevisions implements SpecStore.
+func (s *BboltSpecStore) SpecRevisions(ctx context.Context, hash cipher.SHA256) ([]SpecRevision, error) {
+	var out []SpecRevision
+
+	action := func() error {
+		return s.db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(specRevisionBucket).Bucket(hash[:])
+			if b == nil {
+				return ErrBboltObjectNotExist
+			}
+
+			return b.ForEach(func(_, v []byte) error {
+				var rev SpecRevision
+				if err := json.Unmarshal(v, &rev); err != nil {
+					return err
+				}
+
+				out = append(out, rev)
+				return nil
+			})
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// SpecRevision implements SpecStore.
+func (s *BboltSpecStore) SpecRevision(ctx context.Context, hash cipher.SHA256, rev uint64) (SpecRevision, error) {
+	var out SpecRevision
+
+	action := func() error {
+		return s.db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket(specRevisionBucket).Bucket(hash[:])
+			if b == nil {
+				return ErrBboltObjectNotExist
+			}
+
+			v := b.Get(encodeRevision(rev))
+			if v == nil {
+				return ErrBboltObjectNotExist
+			}
+
+			return json.Unmarshal(v, &out)
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return SpecRevision{}, err
+	}
+
+	return out, nil
+}
+
 // DelSpec implements SpecStore.
 func (s *BboltSpecStore) DelSpec(ctx context.Context, hash cipher.SHA256) error {
 	action := func() error {
@@ -120,17 +241,109 @@ func (s *BboltSpecStore) DelSpec(ctx context.Context, hash cipher.SHA256) error
 				return err
 			}
 
-			return tx.Bucket(specBucket).Delete(hash[:])
+			if tx.Bucket(specRevisionBucket).Bucket(hash[:]) != nil {
+				if err := tx.Bucket(specRevisionBucket).DeleteBucket(hash[:]); err != nil {
+					return err
+				}
+			}
+
+			if err := bboltUnindexSpec(tx, hash, spec.Spec); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(specBucket).Delete(hash[:]); err != nil {
+				return err
+			}
+
+			return decrementObjectCount(tx, specBucket, 1)
 		})
 	}
 
 	return doAsync(ctx, action)
 }
 
+// SpecCount implements SpecStore.
+func (s *BboltSpecStore) SpecCount(ctx context.Context) (uint64, error) {
+	var n uint64
+
+	action := func() error {
+		return s.db.View(func(tx *bbolt.Tx) error {
+			n = objectCount(tx, specBucket)
+			return nil
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// SpecHashes implements SpecStore.
+func (s *BboltSpecStore) SpecHashes(ctx context.Context) ([]cipher.SHA256, error) {
+	var out []cipher.SHA256
+
+	action := func() error {
+		return s.db.View(func(tx *bbolt.Tx) error {
+			out = make([]cipher.SHA256, 0, objectCount(tx, specBucket))
+
+			c := tx.Bucket(specBucket).Cursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				var hash cipher.SHA256
+				if len(k) != len(hash) {
+					return ErrBboltInvalidValue
+				}
+				copy(hash[:], k)
+				out = append(out, hash)
+			}
+			return nil
+		})
+	}
+
+	if err := doAsync(ctx, action); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
 /*
 	<<< HELPER FUNCTIONS >>>
 */
 
+// SpecGenesisHash returns the genesis hash of the chain of 'spec'.
+func SpecGenesisHash(spec cxspec.SignedChainSpec) (cipher.SHA256, error) {
+	genBlock, err := spec.Spec.GenerateGenesisBlock()
+	if err != nil {
+		return cipher.SHA256{}, err
+	}
+
+	return genBlock.HashHeader(), nil
+}
+
+// bboltCheckSpecReplay ensures that 'spec' was not stored as an earlier
+// revision of the chain spec of genesis hash 'hash'.
+func bboltCheckSpecReplay(tx *bbolt.Tx, hash cipher.SHA256, spec cxspec.SignedChainSpec) error {
+	b := tx.Bucket(specRevisionBucket).Bucket(hash[:])
+	if b == nil {
+		return nil
+	}
+
+	specHash := spec.Spec.SpecHash()
+
+	return b.ForEach(func(_, v []byte) error {
+		var rev SpecRevision
+		if err := json.Unmarshal(v, &rev); err != nil {
+			return err
+		}
+		if rev.Spec.Sig == spec.Sig || rev.Spec.Spec.SpecHash() == specHash {
+			return fmt.Errorf("%w as revision %d", ErrReplayedSpecRevision, rev.Revision)
+		}
+		return nil
+	})
+}
+
 func bboltChainSpecByGenesisHash(tx *bbolt.Tx, hash cipher.SHA256, spec *cxspec.SignedChainSpec) error {
 	v := tx.Bucket(specBucket).Get(hash[:])
 	if v == nil {
@@ -139,3 +352,203 @@ func bboltChainSpecByGenesisHash(tx *bbolt.Tx, hash cipher.SHA256, spec *cxspec.
 
 	return json.Unmarshal(v, spec)
 }
+
+// bboltQuerySpecsByKey queries chain specs in database key order. Iteration
+// starts after the cursor and stops once a spec beyond the limit is found.
+func bboltQuerySpecsByKey(tx *bbolt.Tx, q SpecQuery, cur *specCursor) (SpecPage, error) {
+	b, indexed := bboltSpecQueryBucket(tx, q)
+	if b == nil {
+		return SpecPage{}, nil
+	}
+
+	c := b.Cursor()
+
+	first, next := c.First, c.Next
+	if q.Desc {
+		first, next = c.Last, c.Prev
+	}
+
+	k, v := first()
+	if cur != nil {
+		k, v = c.Seek(cur.hash[:])
+		switch {
+		case q.Desc && k == nil:
+			k, v = c.Last()
+		case q.Desc:
+			k, v = c.Prev()
+		case k != nil && bytes.Equal(k, cur.hash[:]):
+			k, v = c.Next()
+		}
+	}
+
+	var entries []SpecEntry
+
+	for ; k != nil; k, v = next() {
+		if q.Limit > 0 && len(entries) > q.Limit {
+			break
+		}
+
+		v, err := bboltSpecQueryValue(tx, indexed, k, v)
+		if err != nil {
+			return SpecPage{}, err
+		}
+
+		var spec cxspec.SignedChainSpec
+		if err := json.Unmarshal(v, &spec); err != nil {
+			return SpecPage{}, err
+		}
+
+		if !q.Match(spec.Spec) {
+			continue
+		}
+
+		e := SpecEntry{Spec: spec}
+		copy(e.GenesisHash[:], k)
+		entries = append(entries, e)
+	}
+
+	return paginateSpecEntries(q, entries), nil
+}
+
+// bboltQuerySpecsByTimestamp queries chain specs in genesis timestamp order.
+// As the order differs from the database key order, all matching specs are
+// loaded and sorted.
+func bboltQuerySpecsByTimestamp(tx *bbolt.Tx, q SpecQuery, cur *specCursor) (SpecPage, error) {
+	b, indexed := bboltSpecQueryBucket(tx, q)
+	if b == nil {
+		return SpecPage{}, nil
+	}
+
+	var entries []SpecEntry
+
+	eachFunc := func(k, v []byte) error {
+		v, err := bboltSpecQueryValue(tx, indexed, k, v)
+		if err != nil {
+			return err
+		}
+
+		var spec cxspec.SignedChainSpec
+		if err := json.Unmarshal(v, &spec); err != nil {
+			return err
+		}
+
+		if !q.Match(spec.Spec) {
+			return nil
+		}
+
+		e := SpecEntry{Spec: spec}
+		copy(e.GenesisHash[:], k)
+
+		if cur != nil {
+			if c := cur.cmp(e); (!q.Desc && c >= 0) || (q.Desc && c <= 0) {
+				return nil
+			}
+		}
+
+		entries = append(entries, e)
+		return nil
+	}
+
+	if err := b.ForEach(eachFunc); err != nil {
+		return SpecPage{}, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if q.Desc {
+			return lessByGenesisTimestamp(entries[j], entries[i])
+		}
+		return lessByGenesisTimestamp(entries[i], entries[j])
+	})
+
+	return paginateSpecEntries(q, entries), nil
+}
+
+// bboltPutSpecRevision stores 'spec' as the latest revision of the chain of
+// genesis hash 'hash'. The resultant revision number is returned.
+func bboltPutSpecRevision(tx *bbolt.Tx, hash cipher.SHA256, spec cxspec.SignedChainSpec) (uint64, error) {
+	b, err := tx.Bucket(specRevisionBucket).CreateBucketIfNotExists(hash[:])
+	if err != nil {
+		return 0, err
+	}
+
+	var revN uint64 = 1
+	if k, _ := b.Cursor().Last(); k != nil {
+		if len(k) != 8 {
+			return 0, ErrBboltInvalidValue
+		}
+		revN = binaryEnc.Uint64(k) + 1
+	}
+
+	rev := SpecRevision{
+		Revision: revN,
+		Created:  time.Now().UTC().Unix(),
+		Spec:     spec,
+	}
+
+	revB, err := json.Marshal(rev)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode chain spec revision: %w", err)
+	}
+
+	specB, err := json.Marshal(spec)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode chain spec: %w", err)
+	}
+
+	if err := b.Put(encodeRevision(revN), revB); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Bucket(specBucket).Put(hash[:], specB); err != nil {
+		return 0, err
+	}
+
+	return revN, nil
+}
+
+// bboltBackfillSpecRevisions stores specs that have no revision history as
+// their first revision. This is needed for databases created before revisions
+// were introduced.
+func bboltBackfillSpecRevisions(tx *bbolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(specRevisionBucket); err != nil {
+		return err
+	}
+
+	var missing []cipher.SHA256
+
+	err := tx.Bucket(specBucket).ForEach(func(k, _ []byte) error {
+		if tx.Bucket(specRevisionBucket).Bucket(k) == nil {
+			var hash cipher.SHA256
+			copy(hash[:], k)
+			missing = append(missing, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range missing {
+		var spec cxspec.SignedChainSpec
+		if err := bboltChainSpecByGenesisHash(tx, hash, &spec); err != nil {
+			return err
+		}
+
+		if _, err := bboltPutSpecRevision(tx, hash, spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bboltInitSpecCount initializes the spec count if it has never been set. This
+// is needed for databases created before specs were counted.
+func bboltInitSpecCount(tx *bbolt.Tx) error {
+	if tx.Bucket(countBucket).Get(specBucket) != nil {
+		return nil
+	}
+
+	n := uint64(tx.Bucket(specBucket).Stats().KeyN)
+	return incrementObjectCount(tx, specBucket, n)
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func TestBboltSpecStore_QuerySpecs(t *testing.T) {
+	const n = 10
+
+	ss := testBboltSpecStore(t, "TestBboltSpecStore_QuerySpecs")
+
+	// Genesis timestamps are assigned in reverse order of coin names so that
+	// timestamp order differs from database key order.
+	all := make([]SpecEntry, n)
+	for i := range all {
+		spec := randSignedSpec(t, fmt.Sprintf("coin%d", i), fmt.Sprintf("COIN%d", i%2), uint64(1000-i))
+		require.NoError(t, ss.AddSpec(context.TODO(), spec))
+
+		hash, err := SpecGenesisHash(spec)
+		require.NoError(t, err)
+		all[i] = SpecEntry{GenesisHash: hash, Spec: spec}
+	}
+
+	byKey := append([]SpecEntry(nil), all...)
+	sort.Slice(byKey, func(i, j int) bool {
+		return byKey[i].GenesisHash.Hex() < byKey[j].GenesisHash.Hex()
+	})
+
+	hashes, err := ss.SpecHashes(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, hashes, n)
+	for i, e := range byKey {
+		require.Equal(t, e.GenesisHash, hashes[i])
+	}
+
+	byTimestamp := append([]SpecEntry(nil), all...)
+	sort.Slice(byTimestamp, func(i, j int) bool {
+		return lessByGenesisTimestamp(byTimestamp[i], byTimestamp[j])
+	})
+
+	cases := []struct {
+		name  string
+		q     SpecQuery
+		exp   []SpecEntry
+		pages int
+	}{
+		{"key_order", SpecQuery{Limit: 3}, byKey, 4},
+		{"key_order_desc", SpecQuery{Limit: 3, Desc: true}, reverseSpecEntries(byKey), 4},
+		{"timestamp_order", SpecQuery{Limit: 4, SortBy: SortByGenesisTimestamp}, byTimestamp, 3},
+		{"timestamp_order_desc", SpecQuery{Limit: 4, SortBy: SortByGenesisTimestamp, Desc: true}, reverseSpecEntries(byTimestamp), 3},
+		{"no_limit", SpecQuery{}, byKey, 1},
+		{"exact_limit", SpecQuery{Limit: n}, byKey, 1},
+		{"filter_ticker", SpecQuery{Limit: 2, CoinTicker: "coin1"}, filterSpecEntries(byKey, "COIN1"), 3},
+		{"filter_name", SpecQuery{CoinName: "COIN3"}, filterSpecEntries(byKey, "coin3"), 1},
+		{"filter_no_match", SpecQuery{SpecEra: "unknown"}, nil, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				got   []SpecEntry
+				pages int
+				q     = tc.q
+			)
+
+			for {
+				page, err := ss.QuerySpecs(context.TODO(), q)
+				require.NoError(t, err)
+				if q.Limit > 0 {
+					require.LessOrEqual(t, len(page.Entries), q.Limit)
+				}
+
+				got = append(got, page.Entries...)
+				pages++
+
+				if page.NextCursor == "" {
+					break
+				}
+				q.Cursor = page.NextCursor
+			}
+
+			require.Equal(t, tc.pages, pages)
+			require.Len(t, got, len(tc.exp))
+			for i := range tc.exp {
+				require.Equal(t, tc.exp[i].GenesisHash, got[i].GenesisHash)
+				require.Equal(t, tc.exp[i].Spec.Sig, got[i].Spec.Sig)
+			}
+		})
+	}
+
+	t.Run("invalid_query", func(t *testing.T) {
+		_, err := ss.QuerySpecs(context.TODO(), SpecQuery{Limit: -1})
+		require.True(t, errors.Is(err, ErrInvalidSpecQuery))
+
+		_, err = ss.QuerySpecs(context.TODO(), SpecQuery{SortBy: "coin_name"})
+		require.True(t, errors.Is(err, ErrInvalidSpecQuery))
+
+		_, err = ss.QuerySpecs(context.TODO(), SpecQuery{Cursor: "zz"})
+		require.True(t, errors.Is(err, ErrInvalidSpecQuery))
+
+		// Cursors of one sort field cannot be used with another.
+		page, err := ss.QuerySpecs(context.TODO(), SpecQuery{Limit: 1})
+		require.NoError(t, err)
+		_, err = ss.QuerySpecs(context.TODO(), SpecQuery{SortBy: SortByGenesisTimestamp, Cursor: page.NextCursor})
+		require.True(t, errors.Is(err, ErrInvalidSpecQuery))
+	})
+}
+
+func TestBboltSpecStore_Indexes(t *testing.T) {
+	ss := testBboltSpecStore(t, "TestBboltSpecStore_Indexes")
+
+	sky1 := randSignedSpec(t, "skycoin", "SKY", 1)
+	sky2 := randSignedSpec(t, "skycoin two", "sky", 2)
+	btc := randSignedSpec(t, "bitcoin", "BTC", 3)
+
+	for _, spec := range []cxspec.SignedChainSpec{sky1, sky2, btc} {
+		require.NoError(t, ss.AddSpec(context.TODO(), spec))
+	}
+
+	requireQueryLen := func(t *testing.T, q SpecQuery, n int) {
+		page, err := ss.QuerySpecs(context.TODO(), q)
+		require.NoError(t, err)
+		require.Len(t, page.Entries, n)
+		for _, e := range page.Entries {
+			require.True(t, q.Match(e.Spec.Spec))
+		}
+	}
+
+	requireIndexed := func(t *testing.T) {
+		requireQueryLen(t, SpecQuery{CoinTicker: " sky"}, 2)
+		requireQueryLen(t, SpecQuery{CoinTicker: "btc"}, 1)
+		requireQueryLen(t, SpecQuery{CoinName: "Skycoin Two"}, 1)
+		requireQueryLen(t, SpecQuery{ChainPubKey: strings.ToUpper(sky1.Spec.ChainPubKey)}, 1)
+		requireQueryLen(t, SpecQuery{CoinTicker: "SKY", CoinName: "bitcoin"}, 0)
+		requireQueryLen(t, SpecQuery{CoinTicker: "ETH"}, 0)
+	}
+
+	t.Run("add", requireIndexed)
+
+	t.Run("rebuild_missing", func(t *testing.T) {
+		// Databases of schema versions before indexes have no index buckets.
+		require.NoError(t, ss.db.Update(func(tx *bbolt.Tx) error {
+			if err := tx.DeleteBucket(specTickerIndexBucket); err != nil {
+				return err
+			}
+			return bboltSetSchemaVersion(tx, 3)
+		}))
+
+		ss2, err := NewBboltSpecStore(ss.db)
+		require.NoError(t, err)
+		ss = ss2
+
+		requireIndexed(t)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for _, spec := range []cxspec.SignedChainSpec{sky1, sky2} {
+			hash, err := SpecGenesisHash(spec)
+			require.NoError(t, err)
+			require.NoError(t, ss.DelSpec(context.TODO(), hash))
+		}
+
+		requireQueryLen(t, SpecQuery{CoinTicker: "SKY"}, 0)
+		requireQueryLen(t, SpecQuery{CoinTicker: "BTC"}, 1)
+
+		// Index keys without specs should be removed.
+		require.NoError(t, ss.db.View(func(tx *bbolt.Tx) error {
+			require.Nil(t, tx.Bucket(specTickerIndexBucket).Bucket([]byte("SKY")))
+			require.Nil(t, tx.Bucket(specCoinNameIndexBucket).Bucket([]byte("skycoin")))
+			require.NotNil(t, tx.Bucket(specTickerIndexBucket).Bucket([]byte("BTC")))
+			return nil
+		}))
+	})
+}
+
+func testBboltSpecStore(t *testing.T, name string) *BboltSpecStore {
+	tempFilename := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%d.db", name, time.Now().UnixNano()))
+
+	db, err := OpenBboltDB(tempFilename)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.Remove(tempFilename))
+	})
+
+	ss, err := NewBboltSpecStore(db)
+	require.NoError(t, err)
+
+	return ss
+}
+
+// randSignedSpec generates a signed chain spec with a random chain key.
+func randSignedSpec(t *testing.T, coin, ticker string, genesisTS uint64) cxspec.SignedChainSpec {
+	pk, sk := cipher.GenerateKeyPair()
+
+	spec, err := cxspec.New(coin, ticker, sk, cipher.AddressFromPubKey(pk), nil)
+	require.NoError(t, err)
+	spec.GenesisTimestamp = genesisTS
+	require.NoError(t, spec.Sign(sk))
+
+	signedSpec, err := cxspec.MakeSignedChainSpec(*spec, sk)
+	require.NoError(t, err)
+
+	return signedSpec
+}
+
+func reverseSpecEntries(entries []SpecEntry) []SpecEntry {
+	out := make([]SpecEntry, len(entries))
+	for i, e := range entries {
+		out[len(entries)-1-i] = e
+	}
+	return out
+}
+
+func filterSpecEntries(entries []SpecEntry, v string) []SpecEntry {
+	var out []SpecEntry
+	for _, e := range entries {
+		if e.Spec.Spec.CoinTicker == v || e.Spec.Spec.CoinName == v {
+			out = append(out, e)
+		}
+	}
+	return out
+}
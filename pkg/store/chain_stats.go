@@ -0,0 +1,73 @@
+package store
+
+import (
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+)
+
+// AnnounceRateWindow is the window over which ChainStats.AnnounceRate is
+// measured.
+const AnnounceRateWindow = 10 * time.Minute
+
+const announceRateMinutes = int64(AnnounceRateWindow / time.Minute)
+
+// ChainStats contains statistics of the live peers of a chain.
+type ChainStats struct {
+	Peers        int     `json:"peers"`         // Number of live peers.
+	DmsgOnly     int     `json:"dmsg_only"`     // Number of live peers without a TCP address.
+	TCP          int     `json:"tcp"`           // Number of live peers with a TCP address.
+	FirstSeen    int64   `json:"first_seen"`    // Unix time the earliest live peer was first seen (0 if unknown).
+	LastSeen     int64   `json:"last_seen"`     // Unix time the latest live peer was last seen (0 if unknown).
+	AnnounceRate float64 `json:"announce_rate"` // Announcements per minute over the last AnnounceRateWindow.
+	BestHeight   uint64  `json:"best_height"`   // Highest head block height reported by live peers (0 if unknown).
+}
+
+// AddPeer adds a live peer of 'addrs'. A 'firstSeen' of 0 is unknown.
+func (cs *ChainStats) AddPeer(addrs cxspec.CXChainAddresses, firstSeen, lastSeen int64) {
+	cs.Peers++
+	if addrs.TCPAddr == "" {
+		cs.DmsgOnly++
+	} else {
+		cs.TCP++
+	}
+
+	if firstSeen != 0 && (cs.FirstSeen == 0 || firstSeen < cs.FirstSeen) {
+		cs.FirstSeen = firstSeen
+	}
+	if lastSeen > cs.LastSeen {
+		cs.LastSeen = lastSeen
+	}
+}
+
+// announceCounter counts the announcements of a chain in per-minute buckets
+// which cover AnnounceRateWindow.
+type announceCounter struct {
+	minutes [announceRateMinutes]int64 // unix minute of each bucket
+	counts  [announceRateMinutes]uint64
+}
+
+// add counts an announcement at unix time 'now'.
+func (c *announceCounter) add(now int64) {
+	m := now / 60
+	i := m % announceRateMinutes
+	if c.minutes[i] != m {
+		c.minutes[i] = m
+		c.counts[i] = 0
+	}
+	c.counts[i]++
+}
+
+// rate returns the announcements per minute within AnnounceRateWindow before
+// unix time 'now'.
+func (c *announceCounter) rate(now int64) float64 {
+	m := now / 60
+
+	var n uint64
+	for i, bm := range c.minutes {
+		if age := m - bm; age >= 0 && age < announceRateMinutes {
+			n += c.counts[i]
+		}
+	}
+	return float64(n) / float64(announceRateMinutes)
+}
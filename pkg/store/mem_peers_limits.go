@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+)
+
+// EvictionPolicy determines which peers are evicted from a MemoryPeersStore
+// when a capacity limit is reached.
+type EvictionPolicy string
+
+// Eviction policies.
+const (
+	EvictOldest      EvictionPolicy = "oldest"       // Peers which were seen least recently are evicted first.
+	EvictLowestScore EvictionPolicy = "lowest-score" // Peers of lowest reachability score are evicted first.
+)
+
+// ParseEvictionPolicy parses an EvictionPolicy from a string.
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	switch p := EvictionPolicy(s); p {
+	case EvictOldest, EvictLowestScore:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid eviction policy '%s'", s)
+	}
+}
+
+// Default memory peers store limits.
+const (
+	DefaultMaxEntries       = 100000
+	DefaultMaxChains        = 10000
+	DefaultMaxPeersPerChain = 1000
+)
+
+// MemoryPeersLimits are the capacity limits of a MemoryPeersStore.
+// A limit of 0 (or less) is unlimited.
+type MemoryPeersLimits struct {
+	MaxEntries       int            // Maximum number of peer entries.
+	MaxChains        int            // Maximum number of chains.
+	MaxPeersPerChain int            // Maximum number of addresses of a single chain.
+	Eviction         EvictionPolicy // Policy which selects the peers to evict.
+}
+
+// reachScore scores 'addrs' by reachability. Reachable TCP addresses score
+// highest, followed by dmsg-only and unprobed addresses, and unreachable
+// addresses score lowest.
+func reachScore(r Reachability, addrs cxspec.CXChainAddresses) int {
+	if r == nil || addrs.TCPAddr == "" {
+		return 1
+	}
+	switch ok, probed := r.Reachable(addrs.TCPAddr); {
+	case ok:
+		return 2
+	case !probed:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// evictBefore reports whether a peer of 'score' and 'lastSeen' should be
+// evicted before a peer of 'score2' and 'lastSeen2' under policy 'p'.
+// Ties of score are broken by last_seen.
+func (p EvictionPolicy) evictBefore(score int, lastSeen int64, score2 int, lastSeen2 int64) bool {
+	if p == EvictLowestScore && score != score2 {
+		return score < score2
+	}
+	return lastSeen < lastSeen2
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,141 +15,743 @@ import (
 
 var (
 	randInst = rand.New(rand.NewSource(int64(binaryEnc.Uint64(cipher.RandByte(8)))))
+	randMx   sync.Mutex
 )
 
+// randIntn is a concurrency-safe wrapper of randInst.Intn.
+func randIntn(n int) int {
+	randMx.Lock()
+	v := randInst.Intn(n)
+	randMx.Unlock()
+	return v
+}
+
+// chainAggregate contains the addresses of peers of a single chain.
+// Addresses are kept in a slice (alongside an index map) so that uniform
+// random samples can be obtained in O(max).
 type chainAggregate struct {
-	m  map[cxspec.CXChainAddresses]int64 // value: last_seen timestamp
-	mx sync.Mutex
+	peers      []aggregatePeer
+	index      map[cxspec.CXChainAddresses]int // value: index of 'peers'
+	announces  announceCounter
+	lastUpdate int64 // unix time of the last announcement
+	mx         sync.Mutex
+}
+
+type aggregatePeer struct {
+	addrs     cxspec.CXChainAddresses
+	firstSeen int64  // first_seen timestamp
+	lastSeen  int64  // last_seen timestamp
+	height    uint64 // head block height reported by the peer status
 }
 
 func newChainAggregate() *chainAggregate {
-	return &chainAggregate{m: make(map[cxspec.CXChainAddresses]int64, 1)}
+	return &chainAggregate{
+		peers: make([]aggregatePeer, 0, 1),
+		index: make(map[cxspec.CXChainAddresses]int, 1),
+	}
 }
 
-func (ca *chainAggregate) Update(addrs cxspec.CXChainAddresses) {
+// Update adds or refreshes 'addrs' at unix time 'now'.
+func (ca *chainAggregate) Update(addrs cxspec.CXChainAddresses, now int64) {
 	ca.mx.Lock()
-	ca.m[addrs] = time.Now().Unix()
+	if i, ok := ca.index[addrs]; ok {
+		ca.peers[i].lastSeen = now
+	} else {
+		ca.index[addrs] = len(ca.peers)
+		ca.peers = append(ca.peers, aggregatePeer{addrs: addrs, firstSeen: now, lastSeen: now})
+	}
+	ca.announces.add(now)
+	ca.lastUpdate = now
 	ca.mx.Unlock()
 }
 
-func (ca *chainAggregate) Rand(max int) []cxspec.CXChainAddresses {
-	out := make([]cxspec.CXChainAddresses, 0, max)
+// SetHeight sets the head block height of 'addrs' if it is aggregated.
+func (ca *chainAggregate) SetHeight(addrs cxspec.CXChainAddresses, height uint64) {
 	ca.mx.Lock()
+	if i, ok := ca.index[addrs]; ok {
+		ca.peers[i].height = height
+	}
+	ca.mx.Unlock()
+}
+
+// Has returns whether 'addrs' is aggregated.
+func (ca *chainAggregate) Has(addrs cxspec.CXChainAddresses) bool {
+	ca.mx.Lock()
+	_, ok := ca.index[addrs]
+	ca.mx.Unlock()
+
+	return ok
+}
 
-	// determine skip range
-	var skipN = 0
-	if skipMax := len(ca.m) - max; skipMax > 0 {
-		skipN = randInst.Intn(skipMax)
+// Remove removes 'addrs' and returns whether it was aggregated.
+func (ca *chainAggregate) Remove(addrs cxspec.CXChainAddresses) bool {
+	ca.mx.Lock()
+	defer ca.mx.Unlock()
+
+	i, ok := ca.index[addrs]
+	if ok {
+		ca.remove(i)
 	}
+	return ok
+}
 
-	// populate results
-	i := 0
-	for addrs := range ca.m {
-		if i++; i < skipN {
-			continue
-		}
-		if out = append(out, addrs); len(out) >= max {
-			break
+// Evict removes the first address to be evicted under policy 'p' and returns
+// it. False is returned if there are no addresses.
+func (ca *chainAggregate) Evict(p EvictionPolicy, r Reachability) (cxspec.CXChainAddresses, bool) {
+	ca.mx.Lock()
+	defer ca.mx.Unlock()
+
+	if len(ca.peers) == 0 {
+		return cxspec.CXChainAddresses{}, false
+	}
+
+	victim, victimScore := 0, reachScore(r, ca.peers[0].addrs)
+	for i := 1; i < len(ca.peers); i++ {
+		score := reachScore(r, ca.peers[i].addrs)
+		if p.evictBefore(score, ca.peers[i].lastSeen, victimScore, ca.peers[victim].lastSeen) {
+			victim, victimScore = i, score
 		}
 	}
 
+	addrs := ca.peers[victim].addrs
+	ca.remove(victim)
+	return addrs, true
+}
+
+// Rand returns a uniform random sample (without replacement) of up to 'max'
+// addresses. This is done with a partial Fisher-Yates shuffle of the
+// underlying slice.
+func (ca *chainAggregate) Rand(max int) []cxspec.CXChainAddresses {
+	ca.mx.Lock()
+	defer ca.mx.Unlock()
+
+	n := len(ca.peers)
+	if max > n {
+		max = n
+	}
+	if max < 0 {
+		max = 0
+	}
+
+	out := make([]cxspec.CXChainAddresses, max)
+	for i := 0; i < max; i++ {
+		j := i + randIntn(n-i)
+		ca.swap(i, j)
+		out[i] = ca.peers[i].addrs
+	}
+
+	return out
+}
+
+func (ca *chainAggregate) All() []cxspec.CXChainAddresses {
+	ca.mx.Lock()
+	out := make([]cxspec.CXChainAddresses, len(ca.peers))
+	for i, p := range ca.peers {
+		out[i] = p.addrs
+	}
 	ca.mx.Unlock()
+
 	return out
 }
 
-func (ca *chainAggregate) GarbageCollect(timeout time.Duration) int {
-	now := time.Now().Unix()
+// Infos returns what is known about the aggregated peers.
+func (ca *chainAggregate) Infos() []PeerInfo {
+	ca.mx.Lock()
+	out := make([]PeerInfo, len(ca.peers))
+	for i, p := range ca.peers {
+		out[i] = PeerInfo{Addrs: p.addrs, LastSeen: p.lastSeen, Height: p.height}
+	}
+	ca.mx.Unlock()
+
+	return out
+}
+
+func (ca *chainAggregate) Len() int {
+	ca.mx.Lock()
+	n := len(ca.peers)
+	ca.mx.Unlock()
+
+	return n
+}
+
+// LastUpdate returns the unix time of the last announcement.
+func (ca *chainAggregate) LastUpdate() int64 {
+	ca.mx.Lock()
+	t := ca.lastUpdate
+	ca.mx.Unlock()
+
+	return t
+}
+
+// Stats returns the statistics of the aggregated peers at unix time 'now'.
+func (ca *chainAggregate) Stats(now int64) ChainStats {
+	ca.mx.Lock()
+	var stats ChainStats
+	for _, p := range ca.peers {
+		stats.AddPeer(p.addrs, p.firstSeen, p.lastSeen)
+		if p.height > stats.BestHeight {
+			stats.BestHeight = p.height
+		}
+	}
+	stats.AnnounceRate = ca.announces.rate(now)
+	ca.mx.Unlock()
+
+	return stats
+}
+
+// GarbageCollect removes addresses which have timed out at unix time 'now'
+// and returns the addresses removed.
+func (ca *chainAggregate) GarbageCollect(timeout time.Duration, now int64) []cxspec.CXChainAddresses {
 	timeoutS := int64(timeout.Seconds())
 
 	ca.mx.Lock()
-	for addrs, lastSeen := range ca.m {
-		if lastSeen+timeoutS < now {
-			delete(ca.m, addrs)
+	var removed []cxspec.CXChainAddresses
+	for i := len(ca.peers) - 1; i >= 0; i-- {
+		if ca.peers[i].lastSeen+timeoutS < now {
+			removed = append(removed, ca.peers[i].addrs)
+			ca.remove(i)
 		}
 	}
-	size := len(ca.m)
 	ca.mx.Unlock()
 
-	return size
+	return removed
 }
 
+// swap swaps peers of indexes 'i' and 'j' while keeping the index consistent.
+// The caller is expected to hold the lock.
+func (ca *chainAggregate) swap(i, j int) {
+	if i == j {
+		return
+	}
+	ca.peers[i], ca.peers[j] = ca.peers[j], ca.peers[i]
+	ca.index[ca.peers[i].addrs] = i
+	ca.index[ca.peers[j].addrs] = j
+}
+
+// remove removes the peer of index 'i' by swapping it with the last peer.
+// The caller is expected to hold the lock.
+func (ca *chainAggregate) remove(i int) {
+	last := len(ca.peers) - 1
+	ca.swap(i, last)
+	delete(ca.index, ca.peers[last].addrs)
+	ca.peers[last] = aggregatePeer{}
+	ca.peers = ca.peers[:last]
+}
+
+// entryEvictionDivisor divides MemoryPeersLimits.MaxEntries into the number of
+// entries which are evicted at once when the limit is reached (1%), so that
+// entries are not scanned on every new entry.
+const entryEvictionDivisor = 100
+
+// entryEvictionBatch returns the number of entries which are evicted at once
+// when the entry limit 'max' is reached. It is at least 1.
+func entryEvictionBatch(max int) int {
+	if batch := max / entryEvictionDivisor; batch > 1 {
+		return batch
+	}
+	return 1
+}
+
+// memPeerEntry is a peer entry of a MemoryPeersStore.
+type memPeerEntry struct {
+	entry   cxspec.SignedPeerEntry
+	status  *SignedPeerStatus // status which extends the entry (nil if not reported)
+	updated int64             // unix time the entry was last updated
+}
+
+// memEvictions contains the addresses evicted from a MemoryPeersStore.
+type memEvictions map[cipher.SHA256][]cxspec.CXChainAddresses // key: chain genesis hash
+
+func (e memEvictions) add(hash cipher.SHA256, addrs ...cxspec.CXChainAddresses) {
+	if len(addrs) > 0 {
+		e[hash] = append(e[hash], addrs...)
+	}
+}
+
+func (e memEvictions) count() int {
+	n := 0
+	for _, addrs := range e {
+		n += len(addrs)
+	}
+	return n
+}
+
+// notify calls 'h' with the evicted addresses of each chain.
+func (e memEvictions) notify(h EvictionHandler) {
+	if h == nil {
+		return
+	}
+	for hash, addrs := range e {
+		h(hash, addrs)
+	}
+}
+
+// MemoryPeersStore is a PeersStore which keeps peers in memory. Its size can be
+// bounded with SetLimits.
 type MemoryPeersStore struct {
 	timeout    time.Duration
-	entries    map[cipher.PubKey]cxspec.SignedPeerEntry
+	limits     MemoryPeersLimits
+	now        func() time.Time
+	entries    map[cipher.PubKey]memPeerEntry
 	aggregates map[cipher.SHA256]*chainAggregate
 	mx         sync.Mutex
+
+	reach     Reachability
+	reachMode ReachabilityMode
+	onEvict   EvictionHandler
 }
 
+// NewMemoryPeersStore creates a MemoryPeersStore. Entries time out after
+// 'timeout', and 'size' is the expected number of entries and chains.
+// The store is unlimited until SetLimits is called.
 func NewMemoryPeersStore(timeout time.Duration, size int) *MemoryPeersStore {
 	return &MemoryPeersStore{
 		timeout:    timeout,
-		entries:    make(map[cipher.PubKey]cxspec.SignedPeerEntry, size),
+		now:        time.Now,
+		entries:    make(map[cipher.PubKey]memPeerEntry, size),
 		aggregates: make(map[cipher.SHA256]*chainAggregate, size),
 	}
 }
 
+// SetLimits sets the capacity limits of the store. When a limit is reached,
+// peers are evicted as per 'l.Eviction' to make room for new peers, and the
+// eviction handler is called with the evicted addresses. It should be called
+// before the store is in use.
+func (ps *MemoryPeersStore) SetLimits(l MemoryPeersLimits) {
+	ps.mx.Lock()
+	ps.limits = l
+	ps.mx.Unlock()
+}
+
 func (ps *MemoryPeersStore) UpdateEntry(_ context.Context, entry cxspec.SignedPeerEntry) error {
 	pk := entry.Entry.PublicKey
 
+	chains := make(map[cipher.SHA256]cxspec.CXChainAddresses, len(entry.Entry.CXChains))
+	for hashStr, addrs := range entry.Entry.CXChains {
+		var hash cipher.SHA256
+		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+			return fmt.Errorf("internal database error: %w", err)
+		}
+		chains[hash] = addrs
+	}
+
 	ps.mx.Lock()
 
 	// check 'last_seen' value
 	oldEntry, ok := ps.entries[pk]
-	if ok && entry.Entry.LastSeen <= oldEntry.Entry.LastSeen {
-		return fmt.Errorf("updated entry's 'last_seen' field should be higher than that of last entry '%d'", oldEntry.Entry.LastSeen)
+	if ok && entry.Entry.LastSeen <= oldEntry.entry.Entry.LastSeen {
+		ps.mx.Unlock()
+		return fmt.Errorf("updated entry's 'last_seen' field should be higher than that of last entry '%d'", oldEntry.entry.Entry.LastSeen)
 	}
 
-	ps.entries[pk] = entry
+	now := ps.now().Unix()
+	evictions := make(memEvictions)
 
-	for hashStr, addrs := range entry.Entry.CXChains {
-		var hash cipher.SHA256
-		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
-			return fmt.Errorf("internal database error: %w", err)
+	if max := ps.limits.MaxEntries; !ok && max > 0 && len(ps.entries) >= max {
+		n := len(ps.entries) - max + 1
+		if batch := entryEvictionBatch(max); batch > n {
+			n = batch
 		}
+		ps.evictEntries(n, evictions)
+	}
+	ps.entries[pk] = memPeerEntry{entry: entry, updated: now}
+
+	// Heights reported by the status of the old entry are outdated.
+	if oldEntry.status != nil {
+		ps.setHeights(oldEntry.entry, oldEntry.status, false)
+	}
 
+	for hash, addrs := range chains {
 		aggregate, ok := ps.aggregates[hash]
 		if !ok {
+			// The chains of the entry are never evicted to make room for
+			// one another. If only those are left, the chain is not stored.
+			if max := ps.limits.MaxChains; max > 0 && !ps.evictChains(len(ps.aggregates)-max+1, chains, evictions) {
+				continue
+			}
 			// create if not exist
 			aggregate = newChainAggregate()
 			ps.aggregates[hash] = aggregate
 		}
 
-		aggregate.Update(addrs)
+		if max := ps.limits.MaxPeersPerChain; max > 0 && !aggregate.Has(addrs) {
+			for aggregate.Len() >= max {
+				evicted, _ := aggregate.Evict(ps.limits.Eviction, ps.reach)
+				evictions.add(hash, evicted)
+			}
+		}
+
+		aggregate.Update(addrs, now)
 	}
 
+	onEvict := ps.onEvict
 	ps.mx.Unlock()
+
+	evictions.notify(onEvict)
 	return nil
 }
 
+// evictEntries evicts the first 'n' entries to be evicted under the eviction
+// policy, alongside their addresses. As all entries are scanned to select the
+// victims, entries should be evicted in batches.
+// The caller is expected to hold the lock.
+func (ps *MemoryPeersStore) evictEntries(n int, evictions memEvictions) {
+	type candidate struct {
+		pk      cipher.PubKey
+		score   int
+		updated int64
+	}
+
+	candidates := make([]candidate, 0, len(ps.entries))
+	for pk, e := range ps.entries {
+		score := 0
+		if ps.limits.Eviction == EvictLowestScore {
+			for _, addrs := range e.entry.Entry.CXChains {
+				if s := reachScore(ps.reach, addrs); s > score {
+					score = s
+				}
+			}
+		}
+		candidates = append(candidates, candidate{pk: pk, score: score, updated: e.updated})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		return ps.limits.Eviction.evictBefore(ci.score, ci.updated, cj.score, cj.updated)
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+
+	for _, c := range candidates[:n] {
+		for hashStr, addrs := range ps.entries[c.pk].entry.Entry.CXChains {
+			var hash cipher.SHA256
+			if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+				continue
+			}
+			aggregate, ok := ps.aggregates[hash]
+			if !ok || !aggregate.Remove(addrs) {
+				continue
+			}
+			evictions.add(hash, addrs)
+			if aggregate.Len() == 0 {
+				delete(ps.aggregates, hash)
+			}
+		}
+		delete(ps.entries, c.pk)
+	}
+}
+
+// evictChains evicts the 'n' chains which were announced least recently,
+// alongside their addresses. Chains within 'keep' are not evicted. It returns
+// false if fewer than 'n' chains could be evicted.
+// The caller is expected to hold the lock.
+func (ps *MemoryPeersStore) evictChains(n int, keep map[cipher.SHA256]cxspec.CXChainAddresses, evictions memEvictions) bool {
+	for ; n > 0; n-- {
+		var (
+			victim     cipher.SHA256
+			victimSeen int64
+			found      bool
+		)
+		for hash, aggregate := range ps.aggregates {
+			if _, ok := keep[hash]; ok {
+				continue
+			}
+			if seen := aggregate.LastUpdate(); !found || seen < victimSeen {
+				victim, victimSeen, found = hash, seen, true
+			}
+		}
+		if !found {
+			return false
+		}
+
+		evictions.add(victim, ps.aggregates[victim].All()...)
+		delete(ps.aggregates, victim)
+	}
+	return true
+}
+
 func (ps *MemoryPeersStore) Entry(_ context.Context, pk cipher.PubKey) (cxspec.SignedPeerEntry, error) {
 	ps.mx.Lock()
 	defer ps.mx.Unlock()
 
-	entry, ok := ps.entries[pk]
-	if !ok {
+	e, ok := ps.entries[pk]
+	if !ok || ps.expired(e.updated, ps.now().Unix()) {
 		return cxspec.SignedPeerEntry{}, fmt.Errorf("entry of pk '%s' has timed out or does not exist", pk.Hex())
 	}
 
-	return entry, nil
+	return e.entry, nil
+}
+
+// UpdateStatus implements PeersStore.
+func (ps *MemoryPeersStore) UpdateStatus(_ context.Context, status SignedPeerStatus) error {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	e, ok := ps.entries[status.Status.PublicKey]
+	if !ok || ps.expired(e.updated, ps.now().Unix()) {
+		return ErrPeerNotExist
+	}
+	if e.entry.Entry.LastSeen != status.Status.LastSeen {
+		return ErrStaleStatus
+	}
+
+	ps.setHeights(e.entry, &status, true)
+	e.status = &status
+	ps.entries[status.Status.PublicKey] = e
+	return nil
+}
+
+// setHeights sets the heights of the addresses of 'entry' to those reported by
+// 'status', or resets them to 0 if 'set' is false.
+// The caller is expected to hold the lock.
+func (ps *MemoryPeersStore) setHeights(entry cxspec.SignedPeerEntry, status *SignedPeerStatus, set bool) {
+	for hashStr, cs := range status.Status.Chains {
+		var hash cipher.SHA256
+		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+			continue
+		}
+		aggregate, ok := ps.aggregates[hash]
+		if !ok {
+			continue
+		}
+
+		var height uint64
+		if set {
+			height = cs.Height
+		}
+		aggregate.SetHeight(entry.Entry.CXChains[hashStr], height)
+	}
+}
+
+// Status implements PeersStore.
+func (ps *MemoryPeersStore) Status(_ context.Context, pk cipher.PubKey) (*SignedPeerStatus, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	e, ok := ps.entries[pk]
+	if !ok || ps.expired(e.updated, ps.now().Unix()) {
+		return nil, ErrPeerNotExist
+	}
+
+	return e.status, nil
+}
+
+// ChainsOfEntry implements PeersStore.
+func (ps *MemoryPeersStore) ChainsOfEntry(_ context.Context, pk cipher.PubKey) ([]cipher.SHA256, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	e, ok := ps.entries[pk]
+	if !ok || ps.expired(e.updated, ps.now().Unix()) {
+		return nil, ErrPeerNotExist
+	}
+
+	out := make([]cipher.SHA256, 0, len(e.entry.Entry.CXChains))
+	for hashStr, addrs := range e.entry.Entry.CXChains {
+		var hash cipher.SHA256
+		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+			return nil, fmt.Errorf("internal database error: %w", err)
+		}
+		if aggregate, ok := ps.aggregates[hash]; ok && aggregate.Has(addrs) {
+			out = append(out, hash)
+		}
+	}
+
+	return out, nil
+}
+
+// RemoveEntry implements PeersStore.
+func (ps *MemoryPeersStore) RemoveEntry(_ context.Context, pk cipher.PubKey, chains []cipher.SHA256) (map[cipher.SHA256]cxspec.CXChainAddresses, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	e, ok := ps.entries[pk]
+	if !ok || ps.expired(e.updated, ps.now().Unix()) {
+		return nil, ErrPeerNotExist
+	}
+
+	leave := make(map[cipher.SHA256]struct{}, len(chains))
+	for _, hash := range chains {
+		leave[hash] = struct{}{}
+	}
+
+	removed := make(map[cipher.SHA256]cxspec.CXChainAddresses)
+	for hashStr, addrs := range e.entry.Entry.CXChains {
+		var hash cipher.SHA256
+		if _, err := hex.Decode(hash[:], []byte(hashStr)); err != nil {
+			return nil, fmt.Errorf("internal database error: %w", err)
+		}
+		if _, ok := leave[hash]; len(leave) > 0 && !ok {
+			continue
+		}
+
+		aggregate, ok := ps.aggregates[hash]
+		if !ok || !aggregate.Remove(addrs) {
+			continue
+		}
+		removed[hash] = addrs
+		if aggregate.Len() == 0 {
+			delete(ps.aggregates, hash)
+		}
+	}
+
+	if len(leave) == 0 {
+		delete(ps.entries, pk)
+	}
+
+	return removed, nil
+}
+
+// expired returns whether an object last updated at unix time 'updated' has
+// timed out at unix time 'now'.
+func (ps *MemoryPeersStore) expired(updated, now int64) bool {
+	return updated+int64(ps.timeout.Seconds()) < now
+}
+
+// SetReachability sets the reachability source and mode used by
+// RandPeersOfChain. It should be called before the store is in use.
+func (ps *MemoryPeersStore) SetReachability(r Reachability, mode ReachabilityMode) {
+	ps.mx.Lock()
+	ps.reach = r
+	ps.reachMode = mode
+	ps.mx.Unlock()
+}
+
+// SetEvictionHandler sets the handler which is called with the addresses
+// evicted on GarbageCollect, or to enforce the limits. It should be called
+// before the store is in use.
+func (ps *MemoryPeersStore) SetEvictionHandler(h EvictionHandler) {
+	ps.mx.Lock()
+	ps.onEvict = h
+	ps.mx.Unlock()
 }
 
 func (ps *MemoryPeersStore) RandPeersOfChain(_ context.Context, hash cipher.SHA256, max int) ([]cxspec.CXChainAddresses, error) {
 	ps.mx.Lock()
 	aggregate, ok := ps.aggregates[hash]
+	reach, reachMode := ps.reach, ps.reachMode
 	ps.mx.Unlock()
 
 	if !ok {
 		return []cxspec.CXChainAddresses{}, nil
 	}
 
-	out := aggregate.Rand(max)
+	if reach == nil || reachMode == ReachabilityIgnore {
+		return aggregate.Rand(max), nil
+	}
+
+	return SelectReachable(aggregate.All(), max, reach, reachMode), nil
+}
+
+// QueryPeersOfChain implements PeersStore.
+func (ps *MemoryPeersStore) QueryPeersOfChain(ctx context.Context, hash cipher.SHA256, q PeerQuery) ([]cxspec.CXChainAddresses, error) {
+	if q.MinHeight == 0 && (q.Strategy == "" || q.Strategy == StrategyRandom) {
+		return ps.RandPeersOfChain(ctx, hash, q.Max)
+	}
+
+	ps.mx.Lock()
+	aggregate, ok := ps.aggregates[hash]
+	reach, reachMode := ps.reach, ps.reachMode
+	ps.mx.Unlock()
+
+	var infos []PeerInfo
+	if ok {
+		infos = aggregate.Infos()
+	}
+
+	return SelectPeers(infos, q, reach, reachMode)
+}
+
+func (ps *MemoryPeersStore) PeersOfChain(_ context.Context, hash cipher.SHA256) ([]cxspec.CXChainAddresses, error) {
+	ps.mx.Lock()
+	aggregate, ok := ps.aggregates[hash]
+	ps.mx.Unlock()
+
+	if !ok {
+		return []cxspec.CXChainAddresses{}, nil
+	}
+
+	return aggregate.All(), nil
+}
+
+func (ps *MemoryPeersStore) Chains(_ context.Context) ([]cipher.SHA256, error) {
+	ps.mx.Lock()
+	out := make([]cipher.SHA256, 0, len(ps.aggregates))
+	for hash := range ps.aggregates {
+		out = append(out, hash)
+	}
+	ps.mx.Unlock()
+
+	return out, nil
+}
+
+func (ps *MemoryPeersStore) Stats(_ context.Context) (PeersStats, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	stats := PeersStats{
+		Entries: len(ps.entries),
+		Chains:  make(map[cipher.SHA256]int, len(ps.aggregates)),
+	}
+	for hash, aggregate := range ps.aggregates {
+		stats.Chains[hash] = aggregate.Len()
+	}
+
+	return stats, nil
+}
+
+func (ps *MemoryPeersStore) ChainStats(_ context.Context) (map[cipher.SHA256]ChainStats, error) {
+	ps.mx.Lock()
+	now := ps.now().Unix()
+	aggregates := make(map[cipher.SHA256]*chainAggregate, len(ps.aggregates))
+	for hash, aggregate := range ps.aggregates {
+		aggregates[hash] = aggregate
+	}
+	ps.mx.Unlock()
+
+	out := make(map[cipher.SHA256]ChainStats, len(aggregates))
+	for hash, aggregate := range aggregates {
+		out[hash] = aggregate.Stats(now)
+	}
+
 	return out, nil
 }
 
-func (ps *MemoryPeersStore) GarbageCollect(_ context.Context) {
+// StatsOfChain implements PeersStore.
+func (ps *MemoryPeersStore) StatsOfChain(_ context.Context, hash cipher.SHA256) (ChainStats, bool, error) {
+	ps.mx.Lock()
+	now := ps.now().Unix()
+	aggregate, ok := ps.aggregates[hash]
+	ps.mx.Unlock()
+
+	if !ok {
+		return ChainStats{}, false, nil
+	}
+
+	return aggregate.Stats(now), true, nil
+}
+
+// GarbageCollect removes timed out addresses and entries, alongside chains
+// which have no addresses left. The number of removed addresses is returned.
+func (ps *MemoryPeersStore) GarbageCollect(_ context.Context) int {
 	ps.mx.Lock()
-	for _, aggregate := range ps.aggregates {
-		aggregate.GarbageCollect(ps.timeout)
+	now := ps.now().Unix()
+	evictions := make(memEvictions)
+	for hash, aggregate := range ps.aggregates {
+		evictions.add(hash, aggregate.GarbageCollect(ps.timeout, now)...)
+		if aggregate.Len() == 0 {
+			delete(ps.aggregates, hash)
+		}
+	}
+	for pk, e := range ps.entries {
+		if ps.expired(e.updated, now) {
+			delete(ps.entries, pk)
+		}
 	}
+	onEvict := ps.onEvict
 	ps.mx.Unlock()
+
+	evictions.notify(onEvict)
+	return evictions.count()
 }
@@ -0,0 +1,470 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/stretchr/testify/require"
+)
+
+// chiSquareCritical19 is the critical value of the chi-square distribution
+// with 19 degrees of freedom at p = 0.00001.
+const chiSquareCritical19 = 57.87
+
+func TestChainAggregate_Rand(t *testing.T) {
+	for _, n := range []int{0, 1, 5, 20} {
+		for _, max := range []int{0, 1, 5, 20, 30} {
+			t.Run(fmt.Sprintf("n=%d_max=%d", n, max), func(t *testing.T) {
+				ca, _ := testChainAggregate(n)
+
+				expLen := max
+				if expLen > n {
+					expLen = n
+				}
+
+				for i := 0; i < 100; i++ {
+					out := ca.Rand(max)
+					require.Len(t, out, expLen)
+
+					seen := make(map[cxspec.CXChainAddresses]struct{}, len(out))
+					for _, addrs := range out {
+						_, dup := seen[addrs]
+						require.False(t, dup, "sample should not contain duplicates")
+						seen[addrs] = struct{}{}
+					}
+				}
+				requireConsistentIndex(t, ca)
+			})
+		}
+	}
+}
+
+// TestChainAggregate_Rand_Fairness ensures that every address is equally
+// likely to be sampled, and equally likely to be sampled first.
+func TestChainAggregate_Rand_Fairness(t *testing.T) {
+	const (
+		n     = 20
+		max   = 5
+		draws = 20000
+	)
+
+	ca, all := testChainAggregate(n)
+
+	included := make(map[cxspec.CXChainAddresses]int, n)
+	first := make(map[cxspec.CXChainAddresses]int, n)
+
+	for i := 0; i < draws; i++ {
+		out := ca.Rand(max)
+		require.Len(t, out, max)
+
+		first[out[0]]++
+		for _, addrs := range out {
+			included[addrs]++
+		}
+	}
+
+	t.Run("inclusion", func(t *testing.T) {
+		exp := float64(draws*max) / n
+		x2 := chiSquare(all, included, exp)
+		t.Logf("chi-square: %.2f", x2)
+		require.Less(t, x2, chiSquareCritical19)
+	})
+
+	t.Run("first_position", func(t *testing.T) {
+		exp := float64(draws) / n
+		x2 := chiSquare(all, first, exp)
+		t.Logf("chi-square: %.2f", x2)
+		require.Less(t, x2, chiSquareCritical19)
+	})
+}
+
+func TestChainAggregate_GarbageCollect(t *testing.T) {
+	const n = 50
+
+	ca, all := testChainAggregate(n)
+
+	// Mark every third address as timed out.
+	old := time.Now().Add(-time.Hour).Unix()
+	expired := make(map[cxspec.CXChainAddresses]struct{})
+	for i, addrs := range all {
+		if i%3 == 0 {
+			ca.peers[ca.index[addrs]].lastSeen = old
+			expired[addrs] = struct{}{}
+		}
+	}
+
+	removed := ca.GarbageCollect(time.Minute, time.Now().Unix())
+	require.Len(t, removed, len(expired))
+	for _, addrs := range removed {
+		_, ok := expired[addrs]
+		require.True(t, ok, "only timed out addresses should be removed")
+	}
+	requireConsistentIndex(t, ca)
+
+	size := ca.Len()
+	require.Equal(t, n-len(expired), size)
+
+	for _, addrs := range ca.All() {
+		_, ok := expired[addrs]
+		require.False(t, ok, "timed out address should be removed")
+	}
+
+	// Samples should still be of full size after removal.
+	require.Len(t, ca.Rand(n), size)
+}
+
+func TestChainAggregate_Stats(t *testing.T) {
+	ca, all := testChainAggregate(4)
+	now := time.Now().Unix()
+	ca.Update(cxspec.CXChainAddresses{}, now)
+	ca.Update(all[0], now)
+
+	// The first peer was first seen long ago, the second was seen last.
+	ca.peers[ca.index[all[0]]].firstSeen = 1000
+	ca.peers[ca.index[all[1]]].lastSeen = now + 3600
+
+	stats := ca.Stats(now)
+	require.Equal(t, 5, stats.Peers)
+	require.Equal(t, 1, stats.DmsgOnly)
+	require.Equal(t, 4, stats.TCP)
+	require.Equal(t, int64(1000), stats.FirstSeen)
+	require.Equal(t, ca.peers[ca.index[all[1]]].lastSeen, stats.LastSeen)
+	require.InDelta(t, 0.6, stats.AnnounceRate, 1e-9)
+}
+
+func TestAnnounceCounter(t *testing.T) {
+	var c announceCounter
+	now := time.Now().Unix()
+
+	for i := int64(0); i < announceRateMinutes; i++ {
+		c.add(now + i*60)
+		c.add(now + i*60)
+	}
+	end := now + (announceRateMinutes-1)*60
+	require.Equal(t, 2.0, c.rate(end))
+
+	// Buckets older than the window are not counted.
+	require.InDelta(t, 1.8, c.rate(end+60), 1e-9)
+	require.Zero(t, c.rate(end+int64(AnnounceRateWindow.Seconds())))
+
+	// Reused buckets restart their count.
+	c.add(end + 60)
+	require.InDelta(t, 1.9, c.rate(end+60), 1e-9)
+}
+
+func TestMemoryPeersStore_GarbageCollect(t *testing.T) {
+	const timeout = time.Minute
+
+	now := time.Now()
+	ps := NewMemoryPeersStore(timeout, 0)
+	ps.now = func() time.Time { return now }
+
+	chain := cipher.SumSHA256([]byte("chain"))
+	entry := testMemPeerEntry(0, now.Unix(), chain)
+	require.NoError(t, ps.UpdateEntry(context.TODO(), entry))
+
+	now = now.Add(timeout / 2)
+	entry2 := testMemPeerEntry(1, now.Unix(), chain)
+	require.NoError(t, ps.UpdateEntry(context.TODO(), entry2))
+
+	// Timed out entries are not returned, even before garbage collection.
+	now = now.Add(timeout/2 + 2*time.Second)
+	_, err := ps.Entry(context.TODO(), entry.Entry.PublicKey)
+	require.Error(t, err)
+	_, err = ps.Entry(context.TODO(), entry2.Entry.PublicKey)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, ps.GarbageCollect(context.TODO()))
+	require.Len(t, ps.entries, 1)
+	require.Contains(t, ps.entries, entry2.Entry.PublicKey)
+	require.Equal(t, 1, ps.aggregates[chain].Len())
+
+	// Chains without addresses are removed.
+	now = now.Add(timeout)
+	require.Equal(t, 1, ps.GarbageCollect(context.TODO()))
+	require.Empty(t, ps.entries)
+	require.Empty(t, ps.aggregates)
+}
+
+func TestMemoryPeersStore_Eviction(t *testing.T) {
+	chain := cipher.SumSHA256([]byte("chain"))
+
+	t.Run(string(EvictOldest), func(t *testing.T) {
+		now := time.Now()
+		ps := NewMemoryPeersStore(time.Hour, 0)
+		ps.now = func() time.Time { return now }
+		ps.SetLimits(MemoryPeersLimits{MaxEntries: 3, Eviction: EvictOldest})
+
+		var evicted []cxspec.CXChainAddresses
+		ps.SetEvictionHandler(func(_ cipher.SHA256, addrs []cxspec.CXChainAddresses) {
+			evicted = append(evicted, addrs...)
+		})
+
+		entries := make([]cxspec.SignedPeerEntry, 4)
+		for i := range entries {
+			now = now.Add(time.Second)
+			entries[i] = testMemPeerEntry(i, now.Unix(), chain)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), entries[i]))
+		}
+
+		// Refreshed entries are not evicted.
+		now = now.Add(time.Second)
+		entries[1].Entry.LastSeen++
+		require.NoError(t, ps.UpdateEntry(context.TODO(), entries[1]))
+
+		now = now.Add(time.Second)
+		require.NoError(t, ps.UpdateEntry(context.TODO(), testMemPeerEntry(4, now.Unix(), chain)))
+
+		require.Len(t, ps.entries, 3)
+		require.NotContains(t, ps.entries, entries[0].Entry.PublicKey)
+		require.NotContains(t, ps.entries, entries[2].Entry.PublicKey)
+		require.Equal(t, []cxspec.CXChainAddresses{
+			testMemAddrs(entries[0], chain),
+			testMemAddrs(entries[2], chain),
+		}, evicted)
+		require.Equal(t, 3, ps.aggregates[chain].Len())
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		const max = 300
+
+		now := time.Now()
+		ps := NewMemoryPeersStore(time.Hour, 0)
+		ps.now = func() time.Time { return now }
+		ps.SetLimits(MemoryPeersLimits{MaxEntries: max, Eviction: EvictOldest})
+
+		entries := make([]cxspec.SignedPeerEntry, max+1)
+		for i := range entries {
+			now = now.Add(time.Second)
+			entries[i] = testMemPeerEntry(i, now.Unix(), chain)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), entries[i]))
+		}
+
+		// A batch of the oldest entries is evicted at once.
+		require.Len(t, ps.entries, max-entryEvictionBatch(max)+1)
+		for i, e := range entries {
+			_, ok := ps.entries[e.Entry.PublicKey]
+			require.Equal(t, i >= entryEvictionBatch(max), ok, "entry %d", i)
+		}
+	})
+
+	t.Run("batch_small_limit", func(t *testing.T) {
+		for max, batch := range map[int]int{1: 1, 10: 1, 99: 1, 100: 1, 250: 2, 100000: 1000} {
+			require.Equal(t, batch, entryEvictionBatch(max), "max %d", max)
+		}
+	})
+
+	t.Run("chains", func(t *testing.T) {
+		chainA := cipher.SumSHA256([]byte("a"))
+		chainB := cipher.SumSHA256([]byte("b"))
+		chainC := cipher.SumSHA256([]byte("c"))
+
+		// Chains are iterated in random order, so repeat to cover both orders.
+		for i := 0; i < 20; i++ {
+			now := time.Now()
+			ps := NewMemoryPeersStore(time.Hour, 0)
+			ps.now = func() time.Time { return now }
+			ps.SetLimits(MemoryPeersLimits{MaxChains: 2})
+
+			now = now.Add(time.Second)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), testMemPeerEntry(0, now.Unix(), chainA)))
+			now = now.Add(time.Second)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), testMemPeerEntry(1, now.Unix(), chainB)))
+
+			// Chain A is the least recently announced, but it is announced
+			// alongside the new chain C, so chain B is evicted instead.
+			now = now.Add(time.Second)
+			entry := testMemPeerEntry(2, now.Unix(), chainA)
+			entry.Entry.CXChains[hex.EncodeToString(chainC[:])] = testMemAddrs(entry, chainA)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), entry))
+
+			require.Len(t, ps.aggregates, 2)
+			require.Contains(t, ps.aggregates, chainA)
+			require.Contains(t, ps.aggregates, chainC)
+			require.Equal(t, 2, ps.aggregates[chainA].Len())
+
+			// An entry with more chains than the limit keeps the chains
+			// which were stored first, rather than evicting its own.
+			now = now.Add(time.Second)
+			entry = testMemPeerEntry(3, now.Unix(), chainA)
+			entry.Entry.CXChains[hex.EncodeToString(chainB[:])] = testMemAddrs(entry, chainA)
+			entry.Entry.CXChains[hex.EncodeToString(chainC[:])] = testMemAddrs(entry, chainA)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), entry))
+
+			require.Len(t, ps.aggregates, 2)
+			require.NotContains(t, ps.aggregates, chainB)
+		}
+	})
+
+	t.Run(string(EvictLowestScore), func(t *testing.T) {
+		now := time.Now()
+		ps := NewMemoryPeersStore(time.Hour, 0)
+		ps.now = func() time.Time { return now }
+		ps.SetLimits(MemoryPeersLimits{MaxPeersPerChain: 3, Eviction: EvictLowestScore})
+
+		entries := make([]cxspec.SignedPeerEntry, 3)
+		for i := range entries {
+			now = now.Add(time.Second)
+			entries[i] = testMemPeerEntry(i, now.Unix(), chain)
+			require.NoError(t, ps.UpdateEntry(context.TODO(), entries[i]))
+		}
+
+		// The newest peer is unreachable, so it is evicted before older
+		// peers which are reachable.
+		reach := testReachability{
+			testMemAddrs(entries[0], chain).TCPAddr: true,
+			testMemAddrs(entries[1], chain).TCPAddr: true,
+			testMemAddrs(entries[2], chain).TCPAddr: false,
+		}
+		ps.SetReachability(reach, ReachabilityPrefer)
+
+		now = now.Add(time.Second)
+		entry := testMemPeerEntry(3, now.Unix(), chain)
+		require.NoError(t, ps.UpdateEntry(context.TODO(), entry))
+
+		all, err := ps.PeersOfChain(context.TODO(), chain)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []cxspec.CXChainAddresses{
+			testMemAddrs(entries[0], chain),
+			testMemAddrs(entries[1], chain),
+			testMemAddrs(entry, chain),
+		}, all)
+	})
+}
+
+// TestMemoryPeersStore_Churn ensures that the limits bound the size of the
+// store while peers and chains come and go.
+func TestMemoryPeersStore_Churn(t *testing.T) {
+	const (
+		timeout = time.Minute
+		pks     = 2000
+		chains  = 40
+		updates = 10000
+	)
+
+	limits := MemoryPeersLimits{MaxEntries: 200, MaxChains: 10, MaxPeersPerChain: 15}
+
+	for _, policy := range []EvictionPolicy{EvictOldest, EvictLowestScore} {
+		t.Run(string(policy), func(t *testing.T) {
+			now := time.Now()
+			ps := NewMemoryPeersStore(timeout, 0)
+			ps.now = func() time.Time { return now }
+			limits.Eviction = policy
+			ps.SetLimits(limits)
+			ps.SetReachability(testReachability{}, ReachabilityPrefer)
+
+			rng := rand.New(rand.NewSource(1))
+			lastSeen := make(map[int]int64, pks)
+
+			for i := 0; i < updates; i++ {
+				now = now.Add(100 * time.Millisecond)
+
+				n := rng.Intn(pks)
+				lastSeen[n]++
+				chain := cipher.SumSHA256([]byte{byte(rng.Intn(chains))})
+				require.NoError(t, ps.UpdateEntry(context.TODO(), testMemPeerEntry(n, lastSeen[n], chain)))
+
+				require.LessOrEqual(t, len(ps.entries), limits.MaxEntries)
+				require.LessOrEqual(t, len(ps.aggregates), limits.MaxChains)
+				for _, ca := range ps.aggregates {
+					require.LessOrEqual(t, ca.Len(), limits.MaxPeersPerChain)
+					require.LessOrEqual(t, cap(ca.peers), 2*limits.MaxPeersPerChain)
+				}
+
+				if i%1000 == 0 {
+					ps.GarbageCollect(context.TODO())
+				}
+			}
+
+			for _, ca := range ps.aggregates {
+				requireConsistentIndex(t, ca)
+			}
+
+			// Everything is removed once timed out.
+			now = now.Add(timeout + time.Second)
+			ps.GarbageCollect(context.TODO())
+			require.Empty(t, ps.entries)
+			require.Empty(t, ps.aggregates)
+		})
+	}
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	for _, p := range []EvictionPolicy{EvictOldest, EvictLowestScore} {
+		p2, err := ParseEvictionPolicy(string(p))
+		require.NoError(t, err)
+		require.Equal(t, p, p2)
+	}
+	_, err := ParseEvictionPolicy("newest")
+	require.Error(t, err)
+}
+
+// testReachability reports TCP addresses of true values as reachable, and of
+// false values as unreachable. Other addresses are not probed.
+type testReachability map[string]bool
+
+func (r testReachability) Reachable(tcpAddr string) (reachable, probed bool) {
+	reachable, probed = r[tcpAddr]
+	return reachable, probed
+}
+
+// testMemPeerEntry returns an unsigned peer entry of the n-th public key which
+// hosts the chain of genesis hash 'chain'. The memory store does not verify
+// signatures.
+func testMemPeerEntry(n int, lastSeen int64, chain cipher.SHA256) cxspec.SignedPeerEntry {
+	var pk cipher.PubKey
+	binaryEnc.PutUint64(pk[1:], uint64(n))
+
+	return cxspec.SignedPeerEntry{
+		Entry: cxspec.PeerEntry{
+			PublicKey: pk,
+			LastSeen:  lastSeen,
+			CXChains: map[string]cxspec.CXChainAddresses{
+				hex.EncodeToString(chain[:]): {
+					DmsgAddr: dmsg.Addr{PK: pk, Port: 9090},
+					TCPAddr:  fmt.Sprintf("127.0.0.1:%d", 10000+n),
+				},
+			},
+		},
+	}
+}
+
+func testMemAddrs(entry cxspec.SignedPeerEntry, chain cipher.SHA256) cxspec.CXChainAddresses {
+	return entry.Entry.CXChains[hex.EncodeToString(chain[:])]
+}
+
+func testChainAggregate(n int) (*chainAggregate, []cxspec.CXChainAddresses) {
+	ca := newChainAggregate()
+	all := make([]cxspec.CXChainAddresses, n)
+	now := time.Now().Unix()
+
+	for i := range all {
+		all[i] = cxspec.CXChainAddresses{TCPAddr: fmt.Sprintf("127.0.0.1:%d", 6000+i)}
+		ca.Update(all[i], now)
+	}
+
+	return ca, all
+}
+
+func requireConsistentIndex(t *testing.T, ca *chainAggregate) {
+	require.Len(t, ca.index, len(ca.peers))
+	for i, p := range ca.peers {
+		require.Equal(t, i, ca.index[p.addrs])
+	}
+}
+
+func chiSquare(all []cxspec.CXChainAddresses, counts map[cxspec.CXChainAddresses]int, exp float64) float64 {
+	var x2 float64
+	for _, addrs := range all {
+		d := float64(counts[addrs]) - exp
+		x2 += d * d / exp
+	}
+	return x2
+}
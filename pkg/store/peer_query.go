@@ -0,0 +1,171 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+)
+
+// PeerStrategy determines which peers are selected, and in which order, when
+// peers of a chain are queried.
+type PeerStrategy string
+
+// Peer selection strategies.
+const (
+	StrategyRandom    PeerStrategy = "random"         // Peers are selected at random.
+	StrategyFreshest  PeerStrategy = "freshest"       // Peers which announced most recently are selected first.
+	StrategyDiverse   PeerStrategy = "diverse"        // Peers are spread across IP subnets.
+	StrategyReachable PeerStrategy = "reachable-only" // Only peers which were reachable on the last probing round are selected.
+	StrategyHighest   PeerStrategy = "highest-height" // Peers which report the highest head block are selected first.
+)
+
+// DefaultPeerStrategy is the default PeerStrategy.
+const DefaultPeerStrategy = StrategyRandom
+
+// ErrNoReachability is returned when StrategyReachable is requested from a
+// store which does not probe peers.
+var ErrNoReachability = errors.New("peer strategy 'reachable-only' requires peers to be probed")
+
+// peerOrders order shuffled peers by the preference of each PeerStrategy.
+var peerOrders = map[PeerStrategy]func(infos []PeerInfo) []PeerInfo{
+	StrategyRandom:    func(infos []PeerInfo) []PeerInfo { return infos },
+	StrategyFreshest:  orderFreshest,
+	StrategyDiverse:   orderDiverse,
+	StrategyReachable: func(infos []PeerInfo) []PeerInfo { return infos },
+	StrategyHighest:   orderHighest,
+}
+
+// ParsePeerStrategy parses a PeerStrategy from a string.
+func ParsePeerStrategy(s string) (PeerStrategy, error) {
+	if _, ok := peerOrders[PeerStrategy(s)]; !ok {
+		return "", fmt.Errorf("invalid peer strategy '%s'", s)
+	}
+	return PeerStrategy(s), nil
+}
+
+// PeerQuery selects peers of a chain.
+type PeerQuery struct {
+	Max       int          // Maximum number of peers.
+	MinHeight uint64       // Minimum head block height reported by peer statuses (0 matches peers without status).
+	Strategy  PeerStrategy // Selection strategy (StrategyRandom if empty).
+}
+
+// PeerInfo contains the addresses of a live peer of a chain alongside what is
+// known about the peer.
+type PeerInfo struct {
+	Addrs    cxspec.CXChainAddresses
+	LastSeen int64  // Unix time the addresses were last announced.
+	Height   uint64 // Head block height reported by the peer status (0 if unknown).
+}
+
+// SelectPeers selects the peers of 'infos' which match 'q', while taking
+// reachability into account. Reachable peers are ordered before unreachable
+// peers as per 'mode', while keeping the order of q.Strategy otherwise. The
+// contents of 'infos' are reordered.
+//
+// ErrNoReachability is returned for StrategyReachable if 'r' is nil, as
+// nothing is known to be reachable without probing.
+func SelectPeers(infos []PeerInfo, q PeerQuery, r Reachability, mode ReachabilityMode) ([]cxspec.CXChainAddresses, error) {
+	strategy := q.Strategy
+	if strategy == "" {
+		strategy = StrategyRandom
+	}
+	order, ok := peerOrders[strategy]
+	if !ok {
+		return nil, fmt.Errorf("invalid peer strategy '%s'", strategy)
+	}
+
+	if strategy == StrategyReachable {
+		if r == nil {
+			return nil, ErrNoReachability
+		}
+		mode = ReachabilityRequire
+	}
+
+	matched := infos[:0]
+	for _, info := range infos {
+		if info.Height >= q.MinHeight {
+			matched = append(matched, info)
+		}
+	}
+
+	// Ties of the strategy are broken at random.
+	for i := range matched {
+		j := i + randIntn(len(matched)-i)
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	matched = order(matched)
+
+	addrs := make([]cxspec.CXChainAddresses, len(matched))
+	for i, info := range matched {
+		addrs[i] = info.Addrs
+	}
+
+	return orderReachable(addrs, q.Max, r, mode), nil
+}
+
+// orderFreshest orders peers by most recent last_seen.
+func orderFreshest(infos []PeerInfo) []PeerInfo {
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].LastSeen > infos[j].LastSeen })
+	return infos
+}
+
+// orderHighest orders peers by highest reported head block.
+func orderHighest(infos []PeerInfo) []PeerInfo {
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].Height > infos[j].Height })
+	return infos
+}
+
+// orderDiverse orders peers in rounds which contain a single peer of each
+// subnet, so that the first peers are of as many subnets as possible. This
+// makes it harder for a single network operator to fill a peer list.
+func orderDiverse(infos []PeerInfo) []PeerInfo {
+	var keys []string
+	subnets := make(map[string][]PeerInfo)
+	for _, info := range infos {
+		key := subnetOf(info.Addrs)
+		if _, ok := subnets[key]; !ok {
+			keys = append(keys, key)
+		}
+		subnets[key] = append(subnets[key], info)
+	}
+
+	out := make([]PeerInfo, 0, len(infos))
+	for len(out) < len(infos) {
+		for _, key := range keys {
+			if s := subnets[key]; len(s) > 0 {
+				out = append(out, s[0])
+				subnets[key] = s[1:]
+			}
+		}
+	}
+	return out
+}
+
+// subnetOf returns the subnet of the TCP address of 'addrs': the /16 of IPv4
+// addresses and the /32 of IPv6 addresses. Peers announcing host names share a
+// single subnet with dmsg-only peers, as their networks are unknown, and a
+// distinct host name is cheap to obtain.
+func subnetOf(addrs cxspec.CXChainAddresses) string {
+	if addrs.TCPAddr == "" {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addrs.TCPAddr)
+	if err != nil {
+		host = addrs.TCPAddr
+	}
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return ip.Mask(net.CIDRMask(16, 32)).String()
+	default:
+		return ip.Mask(net.CIDRMask(32, 128)).String()
+	}
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPeers(t *testing.T) {
+	// testInfos returns peers of which the i-th peer announced at time i and
+	// reports height n-i. Peers of the same subnet are adjacent.
+	testInfos := func() []PeerInfo {
+		const subnets, perSubnet = 4, 3
+
+		infos := make([]PeerInfo, 0, subnets*perSubnet)
+		for s := 0; s < subnets; s++ {
+			for p := 0; p < perSubnet; p++ {
+				i := len(infos)
+				infos = append(infos, PeerInfo{
+					Addrs:    cxspec.CXChainAddresses{TCPAddr: fmt.Sprintf("10.%d.0.%d:6001", s, p)},
+					LastSeen: int64(i),
+					Height:   uint64(subnets*perSubnet - i),
+				})
+			}
+		}
+		return infos
+	}
+	tcpAddrs := func(addrs []cxspec.CXChainAddresses) []string {
+		out := make([]string, len(addrs))
+		for i, a := range addrs {
+			out[i] = a.TCPAddr
+		}
+		return out
+	}
+
+	t.Run("random", func(t *testing.T) {
+		out := selectPeers(t, testInfos(), PeerQuery{Max: 5}, nil, ReachabilityIgnore)
+		require.Len(t, out, 5)
+
+		out = selectPeers(t, testInfos(), PeerQuery{Max: 20, MinHeight: 10}, nil, ReachabilityIgnore)
+		require.ElementsMatch(t, []string{"10.0.0.0:6001", "10.0.0.1:6001", "10.0.0.2:6001"}, tcpAddrs(out))
+	})
+
+	t.Run("freshest", func(t *testing.T) {
+		out := selectPeers(t, testInfos(), PeerQuery{Max: 3, Strategy: StrategyFreshest}, nil, ReachabilityIgnore)
+		require.Equal(t, []string{"10.3.0.2:6001", "10.3.0.1:6001", "10.3.0.0:6001"}, tcpAddrs(out))
+	})
+
+	t.Run("highest_height", func(t *testing.T) {
+		out := selectPeers(t, testInfos(), PeerQuery{Max: 3, Strategy: StrategyHighest}, nil, ReachabilityIgnore)
+		require.Equal(t, []string{"10.0.0.0:6001", "10.0.0.1:6001", "10.0.0.2:6001"}, tcpAddrs(out))
+	})
+
+	t.Run("diverse", func(t *testing.T) {
+		out := selectPeers(t, testInfos(), PeerQuery{Max: 4, Strategy: StrategyDiverse}, nil, ReachabilityIgnore)
+		require.Len(t, out, 4)
+
+		subnets := make(map[string]struct{})
+		for _, addrs := range out {
+			subnets[subnetOf(addrs)] = struct{}{}
+		}
+		require.Len(t, subnets, 4)
+
+		// All peers are selected eventually.
+		out = selectPeers(t, testInfos(), PeerQuery{Max: 20, Strategy: StrategyDiverse}, nil, ReachabilityIgnore)
+		require.Len(t, out, 12)
+	})
+
+	t.Run("diverse_host_names", func(t *testing.T) {
+		// Peers announcing host names cannot fill a peer list by using a
+		// distinct host name each.
+		infos := []PeerInfo{testInfos()[0], testInfos()[3]}
+		for i := 0; i < 10; i++ {
+			infos = append(infos, PeerInfo{
+				Addrs: cxspec.CXChainAddresses{TCPAddr: fmt.Sprintf("node%d.example.com:6001", i)},
+			})
+		}
+
+		out := selectPeers(t, infos, PeerQuery{Max: 3, Strategy: StrategyDiverse}, nil, ReachabilityIgnore)
+		require.Contains(t, tcpAddrs(out), "10.0.0.0:6001")
+		require.Contains(t, tcpAddrs(out), "10.1.0.0:6001")
+	})
+
+	t.Run("reachable_only", func(t *testing.T) {
+		r := testReachability{"10.0.0.0:6001": true, "10.1.0.0:6001": false}
+		out := selectPeers(t, testInfos(), PeerQuery{Max: 20, Strategy: StrategyReachable}, r, ReachabilityIgnore)
+		require.Equal(t, []string{"10.0.0.0:6001"}, tcpAddrs(out))
+
+		// Nothing is known to be reachable without probing.
+		_, err := SelectPeers(testInfos(), PeerQuery{Max: 20, Strategy: StrategyReachable}, nil, ReachabilityIgnore)
+		require.True(t, errors.Is(err, ErrNoReachability))
+	})
+
+	t.Run("prefer_reachable", func(t *testing.T) {
+		// Reachable peers are ordered first, while keeping the strategy order.
+		r := testReachability{"10.1.0.0:6001": true, "10.2.0.0:6001": true}
+		out := selectPeers(t, testInfos(), PeerQuery{Max: 3, Strategy: StrategyFreshest}, r, ReachabilityPrefer)
+		require.Equal(t, []string{"10.2.0.0:6001", "10.1.0.0:6001", "10.3.0.2:6001"}, tcpAddrs(out))
+	})
+}
+
+func selectPeers(t *testing.T, infos []PeerInfo, q PeerQuery, r Reachability, mode ReachabilityMode) []cxspec.CXChainAddresses {
+	out, err := SelectPeers(infos, q, r, mode)
+	require.NoError(t, err)
+	return out
+}
+
+func TestParsePeerStrategy(t *testing.T) {
+	for _, s := range []PeerStrategy{StrategyRandom, StrategyFreshest, StrategyDiverse, StrategyReachable, StrategyHighest} {
+		p, err := ParsePeerStrategy(string(s))
+		require.NoError(t, err)
+		require.Equal(t, s, p)
+	}
+
+	_, err := ParsePeerStrategy("")
+	require.Error(t, err)
+	_, err = ParsePeerStrategy("newest")
+	require.Error(t, err)
+}
+
+func TestSubnetOf(t *testing.T) {
+	cases := []struct {
+		tcpAddr string
+		exp     string
+	}{
+		{tcpAddr: "", exp: ""},
+		{tcpAddr: "192.168.10.1:6001", exp: "192.168.0.0"},
+		{tcpAddr: "192.168.200.7:6001", exp: "192.168.0.0"},
+		{tcpAddr: "[2001:db8:1:2::1]:6001", exp: "2001:db8::"},
+		{tcpAddr: "node.example.com:6001", exp: ""},
+		{tcpAddr: "other.example.org:6001", exp: ""},
+	}
+
+	for _, c := range cases {
+		require.Equal(t, c.exp, subnetOf(cxspec.CXChainAddresses{TCPAddr: c.tcpAddr}), c.tcpAddr)
+	}
+}
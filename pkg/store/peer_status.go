@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+)
+
+// MaxPeerVersionLen is the maximum length of PeerStatus.Version.
+const MaxPeerVersionLen = 64
+
+// ErrStaleStatus occurs when a peer status does not extend the current entry of
+// its peer.
+var ErrStaleStatus = errors.New("peer status does not extend the current peer entry")
+
+// PeerStatus is an optional extension of a peer entry which reports the state
+// of the chains hosted by the peer. A status extends the entry of the same
+// public key and 'last_seen'.
+type PeerStatus struct {
+	PublicKey cipher.PubKey          `json:"public_key"` // Public key of the peer.
+	LastSeen  int64                  `json:"last_seen"`  // 'last_seen' of the extended peer entry.
+	Version   string                 `json:"version"`    // Node software version.
+	Chains    map[string]ChainStatus `json:"chains"`     // Key: genesis hash (hex representation).
+}
+
+// ChainStatus is the state of a chain hosted by a peer.
+type ChainStatus struct {
+	Height   uint64 `json:"height"`    // Height of the head block.
+	HeadHash string `json:"head_hash"` // Hash of the head block (hex representation).
+}
+
+// Check checks the validity of the PeerStatus as an extension of 'entry'.
+func (s *PeerStatus) Check(entry cxspec.PeerEntry) error {
+	if s.PublicKey != entry.PublicKey {
+		return fmt.Errorf("status is of public key '%s' (expected '%s')", s.PublicKey.Hex(), entry.PublicKey.Hex())
+	}
+	if s.LastSeen != entry.LastSeen {
+		return fmt.Errorf("status is of 'last_seen' %d (expected %d)", s.LastSeen, entry.LastSeen)
+	}
+	if len(s.Version) > MaxPeerVersionLen {
+		return fmt.Errorf("status version is longer than %d characters", MaxPeerVersionLen)
+	}
+
+	for hashStr, cs := range s.Chains {
+		if _, ok := entry.CXChains[hashStr]; !ok {
+			return fmt.Errorf("status of chain '%s' which is not listed in the entry", hashStr)
+		}
+		if b, err := hex.DecodeString(cs.HeadHash); err != nil || len(b) != len(cipher.SHA256{}) {
+			return fmt.Errorf("status of chain '%s' has invalid head hash '%s'", hashStr, cs.HeadHash)
+		}
+	}
+
+	return nil
+}
+
+func (s *PeerStatus) payload() []byte {
+	b, err := json.Marshal(s)
+	if err != nil {
+		panic(err) // This should never happen.
+	}
+	return b
+}
+
+// SignedPeerStatus contains a PeerStatus alongside a signature generated by the
+// secret key of the peer.
+type SignedPeerStatus struct {
+	Status PeerStatus `json:"status"`
+	Sig    cipher.Sig `json:"sig"`
+}
+
+// MakeSignedPeerStatus generates a signed peer status from a PeerStatus and
+// the secret key of the peer.
+func MakeSignedPeerStatus(status PeerStatus, sk cipher.SecKey) (SignedPeerStatus, error) {
+	sig, err := cipher.SignPayload(status.payload(), sk)
+	if err != nil {
+		return SignedPeerStatus{}, err
+	}
+
+	return SignedPeerStatus{Status: status, Sig: sig}, nil
+}
+
+// Verify checks the validity of the SignedPeerStatus as an extension of
+// 'entry'.
+func (ss *SignedPeerStatus) Verify(entry cxspec.PeerEntry) error {
+	if err := ss.Status.Check(entry); err != nil {
+		return err
+	}
+
+	return cipher.VerifyPubKeySignedPayload(ss.Status.PublicKey, ss.Sig, ss.Status.payload())
+}
+
+// height returns the head block height of the chain of 'hashStr', and whether
+// the chain is reported.
+func (ss *SignedPeerStatus) height(hashStr string) (uint64, bool) {
+	if ss == nil {
+		return 0, false
+	}
+	cs, ok := ss.Status.Chains[hashStr]
+	return cs.Height, ok
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/dmsg/cipher"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedPeerStatus_Verify(t *testing.T) {
+	chain := cipher.SumSHA256([]byte("chain"))
+	entry, sk := testStatusPeerEntry(t, chain, "127.0.0.1:6001", time.Now().Unix())
+
+	cases := []struct {
+		name   string
+		modify func(s *PeerStatus)
+		resign bool
+		ok     bool
+	}{
+		{name: "valid", modify: func(*PeerStatus) {}, resign: true, ok: true},
+		{name: "forged", modify: func(s *PeerStatus) { s.Version = "v9.9.9" }},
+		{name: "other_last_seen", modify: func(s *PeerStatus) { s.LastSeen-- }, resign: true},
+		{name: "other_chain", modify: func(s *PeerStatus) {
+			other := cipher.SumSHA256([]byte("other"))
+			s.Chains[hex.EncodeToString(other[:])] = ChainStatus{Height: 1, HeadHash: hex.EncodeToString(chain[:])}
+		}, resign: true},
+		{name: "invalid_head_hash", modify: func(s *PeerStatus) {
+			s.Chains[hex.EncodeToString(chain[:])] = ChainStatus{Height: 1, HeadHash: "abc"}
+		}, resign: true},
+		{name: "long_version", modify: func(s *PeerStatus) {
+			s.Version = strings.Repeat("v", MaxPeerVersionLen+1)
+		}, resign: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status := testPeerStatus(t, entry.Entry, sk, chain, 10)
+			c.modify(&status.Status)
+			if c.resign {
+				var err error
+				status, err = MakeSignedPeerStatus(status.Status, sk)
+				require.NoError(t, err)
+			}
+
+			if c.ok {
+				require.NoError(t, status.Verify(entry.Entry))
+			} else {
+				require.Error(t, status.Verify(entry.Entry))
+			}
+		})
+	}
+}
+
+func TestPeersStore_Status(t *testing.T) {
+	const timeout = time.Minute
+
+	stores := map[string]func(t *testing.T) PeersStore{
+		"memory": func(t *testing.T) PeersStore {
+			return NewMemoryPeersStore(timeout, 0)
+		},
+		"bbolt": func(t *testing.T) PeersStore {
+			db, err := OpenBboltDB(filepath.Join(testBboltMaintenanceDir(t), "peers.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+
+			ps, err := NewBboltPeersStore(db, timeout)
+			require.NoError(t, err)
+			return ps
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+			ps := newStore(t)
+
+			chain := cipher.SumSHA256([]byte("chain"))
+			now := time.Now().Unix()
+
+			type peer struct {
+				entry cxspec.SignedPeerEntry
+				sk    cipher.SecKey
+			}
+			peers := make([]peer, 3)
+			for i := range peers {
+				entry, sk := testStatusPeerEntry(t, chain, fmt.Sprintf("127.0.0.1:%d", 6001+i), now)
+				peers[i] = peer{entry: entry, sk: sk}
+			}
+
+			// Statuses of unknown peers are rejected.
+			err := ps.UpdateStatus(ctx, testPeerStatus(t, peers[0].entry.Entry, peers[0].sk, chain, 10))
+			require.True(t, errors.Is(err, ErrPeerNotExist))
+
+			for _, p := range peers {
+				require.NoError(t, ps.UpdateEntry(ctx, p.entry))
+
+				status, err := ps.Status(ctx, p.entry.Entry.PublicKey)
+				require.NoError(t, err)
+				require.Nil(t, status)
+			}
+
+			// Statuses which do not extend the current entry are rejected.
+			stale := peers[0].entry.Entry
+			stale.LastSeen--
+			err = ps.UpdateStatus(ctx, testPeerStatus(t, stale, peers[0].sk, chain, 10))
+			require.True(t, errors.Is(err, ErrStaleStatus))
+
+			// The third peer does not report a status.
+			status0 := testPeerStatus(t, peers[0].entry.Entry, peers[0].sk, chain, 10)
+			status1 := testPeerStatus(t, peers[1].entry.Entry, peers[1].sk, chain, 20)
+			require.NoError(t, ps.UpdateStatus(ctx, status0))
+			require.NoError(t, ps.UpdateStatus(ctx, status1))
+
+			status, err := ps.Status(ctx, peers[1].entry.Entry.PublicKey)
+			require.NoError(t, err)
+			require.Equal(t, &status1, status)
+			require.NoError(t, status.Verify(peers[1].entry.Entry))
+
+			requireQueryLen := func(minHeight uint64, exp int) {
+				addrs, err := ps.QueryPeersOfChain(ctx, chain, PeerQuery{Max: 10, MinHeight: minHeight})
+				require.NoError(t, err)
+				require.Len(t, addrs, exp, "min_height %d", minHeight)
+			}
+			requireBestHeight := func(exp uint64) {
+				stats, err := ps.ChainStats(ctx)
+				require.NoError(t, err)
+				require.Equal(t, exp, stats[chain].BestHeight)
+
+				cs, ok, err := ps.StatsOfChain(ctx, chain)
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, stats[chain], cs)
+			}
+
+			requireQueryLen(0, 3)
+			requireQueryLen(10, 2)
+			requireQueryLen(15, 1)
+			requireQueryLen(21, 0)
+			requireBestHeight(20)
+
+			// Updating the entry removes the status.
+			entry1, err := cxspec.MakeSignedPeerEntry(func() cxspec.PeerEntry {
+				e := peers[1].entry.Entry
+				e.LastSeen++
+				return e
+			}(), peers[1].sk)
+			require.NoError(t, err)
+			require.NoError(t, ps.UpdateEntry(ctx, entry1))
+
+			status, err = ps.Status(ctx, peers[1].entry.Entry.PublicKey)
+			require.NoError(t, err)
+			require.Nil(t, status)
+
+			requireQueryLen(15, 0)
+			requireQueryLen(10, 1)
+			requireBestHeight(10)
+		})
+	}
+}
+
+// testStatusPeerEntry generates a signed peer entry alongside the secret key
+// of its peer.
+func testStatusPeerEntry(t *testing.T, chain cipher.SHA256, tcpAddr string, lastSeen int64) (cxspec.SignedPeerEntry, cipher.SecKey) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	entry := cxspec.PeerEntry{
+		PublicKey: pk,
+		LastSeen:  lastSeen,
+		CXChains: map[string]cxspec.CXChainAddresses{
+			hex.EncodeToString(chain[:]): {TCPAddr: tcpAddr},
+		},
+	}
+
+	signedEntry, err := cxspec.MakeSignedPeerEntry(entry, sk)
+	require.NoError(t, err)
+
+	return signedEntry, sk
+}
+
+// testPeerStatus generates a signed status which extends 'entry' and reports
+// 'height' for 'chain'.
+func testPeerStatus(t *testing.T, entry cxspec.PeerEntry, sk cipher.SecKey, chain cipher.SHA256, height uint64) SignedPeerStatus {
+	head := cipher.SumSHA256([]byte(entry.PublicKey.Hex()))
+
+	status, err := MakeSignedPeerStatus(PeerStatus{
+		PublicKey: entry.PublicKey,
+		LastSeen:  entry.LastSeen,
+		Version:   "v0.1.0",
+		Chains: map[string]ChainStatus{
+			hex.EncodeToString(chain[:]): {Height: height, HeadHash: hex.EncodeToString(head[:])},
+		},
+	}, sk)
+	require.NoError(t, err)
+
+	return status
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+)
+
+// Reachability reports whether announced TCP addresses are reachable.
+type Reachability interface {
+	// Reachable returns whether 'tcpAddr' is reachable, and whether it has
+	// been probed at all.
+	Reachable(tcpAddr string) (reachable, probed bool)
+}
+
+// ReachabilityMode determines how peer reachability affects peer selection.
+type ReachabilityMode string
+
+// Reachability modes.
+const (
+	ReachabilityIgnore  ReachabilityMode = "off"     // Reachability is not considered.
+	ReachabilityPrefer  ReachabilityMode = "prefer"  // Reachable peers are selected first.
+	ReachabilityRequire ReachabilityMode = "require" // Only reachable peers are selected.
+)
+
+// ParseReachabilityMode parses a ReachabilityMode from a string.
+func ParseReachabilityMode(s string) (ReachabilityMode, error) {
+	switch m := ReachabilityMode(s); m {
+	case ReachabilityIgnore, ReachabilityPrefer, ReachabilityRequire:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid reachability mode '%s'", s)
+	}
+}
+
+// SelectReachable selects up to 'max' random peers from 'all' while taking
+// reachability into account. The contents of 'all' are reordered.
+func SelectReachable(all []cxspec.CXChainAddresses, max int, r Reachability, mode ReachabilityMode) []cxspec.CXChainAddresses {
+	shuffleAddrs(all, len(all))
+	return orderReachable(all, max, r, mode)
+}
+
+// orderReachable selects up to 'max' peers from 'all', where reachable peers
+// are ordered first as per 'mode'. The order of 'all' is kept otherwise.
+func orderReachable(all []cxspec.CXChainAddresses, max int, r Reachability, mode ReachabilityMode) []cxspec.CXChainAddresses {
+	if r == nil || mode == ReachabilityIgnore {
+		return truncateAddrs(all, max)
+	}
+
+	var reachable, unprobed, unreachable []cxspec.CXChainAddresses
+	for _, addrs := range all {
+		ok, probed := r.Reachable(addrs.TCPAddr)
+		switch {
+		case ok:
+			reachable = append(reachable, addrs)
+		case !probed:
+			unprobed = append(unprobed, addrs)
+		default:
+			unreachable = append(unreachable, addrs)
+		}
+	}
+
+	if mode == ReachabilityRequire {
+		return truncateAddrs(reachable, max)
+	}
+
+	out := append(reachable, unprobed...)
+	out = append(out, unreachable...)
+	return truncateAddrs(out, max)
+}
+
+// shuffleAddrs moves 'n' uniformly selected random elements to the start of
+// 'addrs' with a partial Fisher-Yates shuffle.
+func shuffleAddrs(addrs []cxspec.CXChainAddresses, n int) {
+	if n > len(addrs) {
+		n = len(addrs)
+	}
+	for i := 0; i < n; i++ {
+		j := i + randIntn(len(addrs)-i)
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	}
+}
+
+func truncateAddrs(addrs []cxspec.CXChainAddresses, max int) []cxspec.CXChainAddresses {
+	if max < 0 {
+		max = 0
+	}
+	if max > len(addrs) {
+		max = len(addrs)
+	}
+	return addrs[:max]
+}
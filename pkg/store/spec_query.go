@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// ErrInvalidSpecQuery occurs when a SpecQuery has invalid values.
+var ErrInvalidSpecQuery = errors.New("invalid spec query")
+
+// SpecSortField is a field that chain specs can be sorted by.
+type SpecSortField string
+
+// Spec sort fields.
+const (
+	SortByGenesisHash      SpecSortField = ""                  // Database key order.
+	SortByGenesisTimestamp SpecSortField = "genesis_timestamp" // Genesis timestamp, then genesis hash.
+)
+
+// ParseSpecSortField parses a SpecSortField from a string.
+func ParseSpecSortField(s string) (SpecSortField, error) {
+	switch f := SpecSortField(s); f {
+	case SortByGenesisHash, SortByGenesisTimestamp:
+		return f, nil
+	case "genesis_hash":
+		return SortByGenesisHash, nil
+	default:
+		return "", fmt.Errorf("%w: unknown sort field '%s'", ErrInvalidSpecQuery, s)
+	}
+}
+
+// SpecQuery filters, sorts and paginates chain specs.
+// Empty filter fields match all chain specs. Filter values are normalized in
+// the same way as the fields of chain specs (see NormalizeCoinTicker,
+// NormalizeCoinName and NormalizeChainPubKey).
+type SpecQuery struct {
+	CoinTicker  string // Only include specs of this coin ticker.
+	CoinName    string // Only include specs of this coin name.
+	ChainPubKey string // Only include specs of this chain public key (hex).
+	SpecEra     string // Only include specs of this spec era.
+
+	SortBy SpecSortField // Field to sort by.
+	Desc   bool          // Sort in descending order.
+
+	Cursor string // Opaque cursor returned by a previous query (empty for the first page).
+	Limit  int    // Maximum number of specs to return (0 for no limit).
+}
+
+// Match returns true if 'spec' matches the filters of the query.
+func (q SpecQuery) Match(spec cxspec.ChainSpec) bool {
+	return matchFilter(q.CoinTicker, spec.CoinTicker, NormalizeCoinTicker) &&
+		matchFilter(q.CoinName, spec.CoinName, NormalizeCoinName) &&
+		matchFilter(q.ChainPubKey, spec.ChainPubKey, NormalizeChainPubKey) &&
+		matchFilter(q.SpecEra, spec.SpecEra, strings.ToLower)
+}
+
+// SpecEntry is a signed chain spec alongside it's genesis hash.
+type SpecEntry struct {
+	GenesisHash cipher.SHA256
+	Spec        cxspec.SignedChainSpec
+}
+
+// SpecPage is a page of chain specs resulting from a SpecQuery.
+type SpecPage struct {
+	Entries    []SpecEntry
+	NextCursor string // Cursor of the next page (empty if this is the last page).
+}
+
+/*
+	<<< HELPER FUNCTIONS >>>
+*/
+
+func matchFilter(filter, v string, normalize func(string) string) bool {
+	return filter == "" || normalize(filter) == normalize(v)
+}
+
+// specCursor is the decoded form of SpecQuery.Cursor.
+// Cursors of queries sorted by genesis timestamp are prefixed with the
+// timestamp of the last returned spec.
+type specCursor struct {
+	timestamp uint64
+	hash      cipher.SHA256
+}
+
+func (q SpecQuery) check() error {
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidSpecQuery)
+	}
+	if _, err := ParseSpecSortField(string(q.SortBy)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (q SpecQuery) encodeCursor(e SpecEntry) string {
+	if q.SortBy == SortByGenesisTimestamp {
+		b := make([]byte, 8, 8+len(e.GenesisHash))
+		binaryEnc.PutUint64(b, e.Spec.Spec.GenesisTimestamp)
+		return hex.EncodeToString(append(b, e.GenesisHash[:]...))
+	}
+	return e.GenesisHash.Hex()
+}
+
+// decodeCursor decodes the query cursor. A nil cursor is returned if the query
+// has no cursor.
+func (q SpecQuery) decodeCursor() (*specCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	b, err := hex.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode cursor: %v", ErrInvalidSpecQuery, err)
+	}
+
+	var cur specCursor
+	hashLen := len(cipher.SHA256{})
+
+	switch {
+	case q.SortBy == SortByGenesisTimestamp && len(b) == 8+hashLen:
+		cur.timestamp = binaryEnc.Uint64(b[:8])
+		copy(cur.hash[:], b[8:])
+	case q.SortBy == SortByGenesisHash && len(b) == hashLen:
+		copy(cur.hash[:], b)
+	default:
+		return nil, fmt.Errorf("%w: cursor does not belong to sort field '%s'", ErrInvalidSpecQuery, q.SortBy)
+	}
+
+	return &cur, nil
+}
+
+// cmp compares the cursor position with the given spec entry in genesis
+// timestamp order. The result is negative if the cursor is before 'e', zero if
+// the cursor points at 'e', and positive if the cursor is after 'e'.
+func (c specCursor) cmp(e SpecEntry) int {
+	if ts := e.Spec.Spec.GenesisTimestamp; c.timestamp != ts {
+		if c.timestamp < ts {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(c.hash[:], e.GenesisHash[:])
+}
+
+// lessByGenesisTimestamp returns true if 'a' is before 'b' in genesis
+// timestamp order.
+func lessByGenesisTimestamp(a, b SpecEntry) bool {
+	return specCursor{timestamp: a.Spec.Spec.GenesisTimestamp, hash: a.GenesisHash}.cmp(b) < 0
+}
+
+// paginateSpecEntries truncates sorted spec entries to the query limit. The
+// next cursor is set if entries are truncated.
+func paginateSpecEntries(q SpecQuery, entries []SpecEntry) SpecPage {
+	if q.Limit == 0 || len(entries) <= q.Limit {
+		return SpecPage{Entries: entries}
+	}
+
+	entries = entries[:q.Limit]
+	return SpecPage{
+		Entries:    entries,
+		NextCursor: q.encodeCursor(entries[len(entries)-1]),
+	}
+}
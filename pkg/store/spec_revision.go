@@ -0,0 +1,59 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/cx-chains/src/cx/cxspec"
+)
+
+// ErrImmutableSpecField occurs when a chain spec revision attempts to change a
+// field that defines the chain's genesis or identity.
+var ErrImmutableSpecField = errors.New("chain spec revision changes immutable field")
+
+// ErrReplayedSpecRevision occurs when a chain spec revision was already stored
+// as an earlier revision. Storing it again would roll the chain spec back.
+var ErrReplayedSpecRevision = fmt.Errorf("chain spec revision was already stored: %w", ErrBboltObjectAlreadyExists)
+
+// SpecRevision is a revision of a chain spec.
+type SpecRevision struct {
+	Revision uint64                 `json:"revision"` // Revision number (starting from 1).
+	Created  int64                  `json:"created"`  // Time in which the revision was stored (in seconds, UTC time).
+	Spec     cxspec.SignedChainSpec `json:"signed_spec"`
+}
+
+// CheckSpecRevision ensures that 'next' is a valid revision of 'prev'.
+// Only the protocol and node parameters of a chain spec can be revised.
+func CheckSpecRevision(prev, next cxspec.ChainSpec) error {
+	type field struct {
+		name       string
+		prev, next interface{}
+	}
+
+	fields := []field{
+		{"spec_era", prev.SpecEra, next.SpecEra},
+		{"chain_pubkey", prev.ChainPubKey, next.ChainPubKey},
+		{"coin_name", prev.CoinName, next.CoinName},
+		{"coin_ticker", prev.CoinTicker, next.CoinTicker},
+		{"coin_hours_name", prev.CoinHoursName, next.CoinHoursName},
+		{"coin_hours_ticker", prev.CoinHoursTicker, next.CoinHoursTicker},
+		{"genesis_address", prev.GenesisAddr, next.GenesisAddr},
+		{"genesis_signature", prev.GenesisSig, next.GenesisSig},
+		{"genesis_coin_volume", prev.GenesisCoinVolume, next.GenesisCoinVolume},
+		{"genesis_program_state", prev.GenesisProgState, next.GenesisProgState},
+		{"genesis_timestamp", prev.GenesisTimestamp, next.GenesisTimestamp},
+		{"max_coin_supply", prev.MaxCoinSupply, next.MaxCoinSupply},
+	}
+
+	for _, f := range fields {
+		if f.prev != f.next {
+			return fmt.Errorf("%w '%s'", ErrImmutableSpecField, f.name)
+		}
+	}
+
+	if prev.SpecHash() == next.SpecHash() {
+		return fmt.Errorf("chain spec revision is identical to current revision: %w", ErrBboltObjectAlreadyExists)
+	}
+
+	return nil
+}
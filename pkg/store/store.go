@@ -2,26 +2,83 @@ package store
 
 import (
 	"context"
+	"errors"
 
 	"github.com/skycoin/cx-chains/src/cx/cxspec"
 	cipher2 "github.com/skycoin/dmsg/cipher"
 	"github.com/skycoin/skycoin/src/cipher"
 )
 
+// ErrReadOnly occurs when attempting to write to a read-only store.
+var ErrReadOnly = errors.New("store is read-only")
+
+// ErrPeerNotExist occurs when a peer entry does not exist or has timed out.
+var ErrPeerNotExist = errors.New("peer entry does not exist")
+
 // SpecStore represents a chain spec database implementation.
 type SpecStore interface {
 	ChainSpecAll(ctx context.Context) ([]cxspec.SignedChainSpec, error)
 	ChainSpec(ctx context.Context, hash cipher.SHA256) (cxspec.SignedChainSpec, error)
+	QuerySpecs(ctx context.Context, q SpecQuery) (SpecPage, error)
 	AddSpec(ctx context.Context, spec cxspec.SignedChainSpec) error
+	ReviseSpec(ctx context.Context, spec cxspec.SignedChainSpec) (uint64, error)
+	SpecRevisions(ctx context.Context, hash cipher.SHA256) ([]SpecRevision, error)
+	SpecRevision(ctx context.Context, hash cipher.SHA256, rev uint64) (SpecRevision, error)
 	DelSpec(ctx context.Context, hash cipher.SHA256) error
+	SpecCount(ctx context.Context) (uint64, error)
+	// SpecHashes returns the genesis hashes of all chain specs, without
+	// decoding the specs.
+	SpecHashes(ctx context.Context) ([]cipher.SHA256, error)
 }
 
 // PeersStore represents a peers database implementation.
 type PeersStore interface {
 	UpdateEntry(ctx context.Context, entry cxspec.SignedPeerEntry) error
 	Entry(ctx context.Context, pk cipher2.PubKey) (cxspec.SignedPeerEntry, error)
+	// RemoveEntry removes the addresses of the peer of 'pk' from the given
+	// chains. If 'chains' is empty, the peer is removed from all chains
+	// alongside its entry. Chains which the entry does not list are ignored.
+	// The removed addresses are returned, keyed by chain. ErrPeerNotExist is
+	// returned if the entry does not exist or has timed out. As the entry is
+	// signed, it is kept as is when only some chains are left (see
+	// ChainsOfEntry).
+	RemoveEntry(ctx context.Context, pk cipher2.PubKey, chains []cipher2.SHA256) (map[cipher2.SHA256]cxspec.CXChainAddresses, error)
+	// ChainsOfEntry returns the chains of the entry of the peer of 'pk' which
+	// the peer still serves, that is, the chains it has not left and from
+	// which it was not evicted. ErrPeerNotExist is returned if the entry does
+	// not exist or has timed out.
+	ChainsOfEntry(ctx context.Context, pk cipher2.PubKey) ([]cipher2.SHA256, error)
+	// UpdateStatus sets the status of the peer of the status' public key. The
+	// status should be verified, and should extend the current entry of the
+	// peer (ErrStaleStatus is returned otherwise). The status is removed when
+	// the entry is updated.
+	UpdateStatus(ctx context.Context, status SignedPeerStatus) error
+	// Status returns the status which extends the current entry of the peer of
+	// 'pk', or nil if there is none.
+	Status(ctx context.Context, pk cipher2.PubKey) (*SignedPeerStatus, error)
 	RandPeersOfChain(ctx context.Context, hash cipher2.SHA256, max int) ([]cxspec.CXChainAddresses, error)
-	GarbageCollect(ctx context.Context)
+	QueryPeersOfChain(ctx context.Context, hash cipher2.SHA256, q PeerQuery) ([]cxspec.CXChainAddresses, error)
+	PeersOfChain(ctx context.Context, hash cipher2.SHA256) ([]cxspec.CXChainAddresses, error)
+	Chains(ctx context.Context) ([]cipher2.SHA256, error)
+	SetReachability(r Reachability, mode ReachabilityMode)
+	SetEvictionHandler(h EvictionHandler)
+	Stats(ctx context.Context) (PeersStats, error)
+	ChainStats(ctx context.Context) (map[cipher2.SHA256]ChainStats, error)
+	// StatsOfChain returns the statistics of the peers of a single chain, and
+	// whether the chain has peers.
+	StatsOfChain(ctx context.Context, hash cipher2.SHA256) (ChainStats, bool, error)
+	GarbageCollect(ctx context.Context) (evicted int)
+}
+
+// EvictionHandler is called on GarbageCollect with the timed out addresses
+// which were evicted from the chain of genesis hash 'hash'. Stores with
+// capacity limits also call it with the addresses evicted to enforce them.
+type EvictionHandler func(hash cipher2.SHA256, evicted []cxspec.CXChainAddresses)
+
+// PeersStats contains counts of objects within a PeersStore.
+type PeersStats struct {
+	Entries int                    // Number of peer entries.
+	Chains  map[cipher2.SHA256]int // Number of peers of each chain.
 }
 
 // DeleteProblematicSpecs removes problematic specs.